@@ -0,0 +1,179 @@
+// Package admin implements the admin HTTP side-server, exposing
+// the profiling, the runtime state, the caches and the configuration
+// of the service.
+package admin
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/metrics"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+)
+
+// the configuration keys containing one of these words are redacted
+var secretKeyWords = []string{"secret", "password", "token", "key", "credential"}
+
+const redactedValue = "[REDACTED]"
+
+var publishOnce sync.Once
+
+type Options struct {
+	// Spotify is the spotify client whose state is exposed
+	Spotify myspotify.MySpotify
+
+	// Settings returns the effective configuration
+	Settings func() map[string]interface{}
+
+	// Metrics are served in the prometheus format, when provided
+	Metrics *metrics.Metrics
+
+	Logger *slog.Logger
+}
+
+type admin struct {
+	spotify   myspotify.MySpotify
+	settings  func() map[string]interface{}
+	logger    *slog.Logger
+	startTime time.Time
+}
+
+// NewHandler creates the admin HTTP handler
+func NewHandler(opt Options) http.Handler {
+	a := &admin{
+		spotify:   opt.Spotify,
+		settings:  opt.Settings,
+		logger:    opt.Logger,
+		startTime: time.Now(),
+	}
+
+	publishOnce.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() interface{} {
+			return runtime.NumGoroutine()
+		}))
+	})
+
+	mux := http.NewServeMux()
+
+	// profiling, without the command line which holds the secret flags
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// runtime counters
+	mux.HandleFunc("/debug/vars", handleVars)
+
+	if opt.Metrics != nil {
+		mux.Handle("/metrics", opt.Metrics.Handler())
+	}
+
+	mux.HandleFunc("/state", a.handleState)
+	mux.HandleFunc("/caches", a.handleCaches)
+	mux.HandleFunc("/caches/flush", a.handleCachesFlush)
+	mux.HandleFunc("/config", a.handleConfig)
+
+	return mux
+}
+
+func (a *admin) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.Error("failed to write admin response", "error", err)
+	}
+}
+
+// handleVars serves the expvar variables as expvar.Handler does,
+// but the command line, which holds the secret flags
+func handleVars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key == "cmdline" {
+			return
+		}
+		if !first {
+			fmt.Fprintf(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
+
+func (a *admin) handleState(w http.ResponseWriter, r *http.Request) {
+	state := a.spotify.State()
+
+	a.writeJSON(w, map[string]interface{}{
+		"uptime":     time.Since(a.startTime).String(),
+		"goroutines": runtime.NumGoroutine(),
+		"spotify": map[string]interface{}{
+			"tokenExpiry":    state.TokenExpiry,
+			"tokenExpiresIn": time.Until(state.TokenExpiry).String(),
+			"refreshCount":   state.RefreshCount,
+		},
+		"caches": state.CacheSizes,
+	})
+}
+
+func (a *admin) handleCaches(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, a.spotify.State().CacheSizes)
+}
+
+func (a *admin) handleCachesFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if err := a.spotify.FlushCache(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.writeJSON(w, a.spotify.State().CacheSizes)
+}
+
+func (a *admin) handleConfig(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, redact(a.settings()))
+}
+
+// redact replaces the values of the secret configuration keys
+func redact(settings map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		if nested, check := value.(map[string]interface{}); check {
+			out[key] = redact(nested)
+			continue
+		}
+
+		out[key] = value
+		if isSecretKey(key) && fmt.Sprint(value) != "" {
+			out[key] = redactedValue
+		}
+	}
+
+	return out
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range secretKeyWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+
+	return false
+}
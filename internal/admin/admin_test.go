@@ -0,0 +1,40 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/musicresearcher/internal/admin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHandler() http.Handler {
+	return admin.NewHandler(admin.Options{
+		Settings: func() map[string]interface{} { return map[string]interface{}{} },
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+}
+
+func TestVars_withoutCmdline(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	newHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/vars", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var vars map[string]interface{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &vars))
+	assert.Contains(t, vars, "memstats")
+	assert.Contains(t, vars, "goroutines")
+	assert.NotContains(t, vars, "cmdline")
+}
+
+func TestPprof_withoutCmdline(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	newHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/cmdline", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,216 @@
+// Package auth authenticates the callers of the service with API keys,
+// read from the request metadata and checked against a key store.
+// Each key grants scopes, and is limited to a daily request quota.
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/planetfall/musicresearcher/internal/logging"
+	"github.com/planetfall/musicresearcher/internal/metrics"
+	"github.com/planetfall/musicresearcher/pkg/extension"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// APIKeyMetadataKey is the metadata key of the API key, which can
+	// also be given as a bearer token of the authorization metadata
+	APIKeyMetadataKey        = "x-api-key"
+	authorizationMetadataKey = "authorization"
+	bearerPrefix             = "bearer "
+
+	// KeyIDKey is the log attribute of the key ID
+	KeyIDKey = "key_id"
+
+	// the key ID recorded for the requests without a valid key
+	anonymousKeyID = "anonymous"
+
+	// the health checks are always allowed, for the probes
+	healthServicePrefix = "/grpc.health.v1.Health/"
+)
+
+// methodScopes lists the scope required by each method,
+// the unlisted methods requiring the admin scope
+var methodScopes = map[string]string{
+	"/musicresearcher.MusicResearcher/Search":       ScopeSearch,
+	"/musicresearcher.MusicResearcher/GetGenreList": ScopeSearch,
+	extension.SuggestMethod:                         ScopeSearch,
+	extension.GetArtistMethod:                       ScopeSearch,
+	extension.GetAlbumMethod:                        ScopeSearch,
+	extension.LookupMethod:                          ScopeSearch,
+	extension.ExportPlaylistMethod:                  ScopeSearch,
+}
+
+var methodScopesMu sync.RWMutex
+
+// SetMethodScope sets the scope required by a method, for the methods
+// of the packages the auth package cannot import
+func SetMethodScope(fullMethod string, scope string) {
+	methodScopesMu.Lock()
+	defer methodScopesMu.Unlock()
+
+	methodScopes[fullMethod] = scope
+}
+
+type keyIDContextKey struct{}
+
+type refundContextKey struct{}
+
+// KeyID returns the ID of the key authenticating the request, if any
+func KeyID(ctx context.Context) string {
+	keyID, _ := ctx.Value(keyIDContextKey{}).(string)
+	return keyID
+}
+
+// Refund gives back the quota consumed by the request, for the
+// interceptors rejecting it after the authentication, such as the
+// rate limiter. The quota is given back once.
+func Refund(ctx context.Context) {
+	if refund, check := ctx.Value(refundContextKey{}).(func()); check {
+		refund()
+	}
+}
+
+func requiredScope(fullMethod string) string {
+	methodScopesMu.RLock()
+	defer methodScopesMu.RUnlock()
+
+	if scope, check := methodScopes[fullMethod]; check {
+		return scope
+	}
+
+	return ScopeAdmin
+}
+
+// returns the API key of the incoming metadata, if any
+func apiKeyFromMetadata(ctx context.Context) string {
+	md, check := metadata.FromIncomingContext(ctx)
+	if !check {
+		return ""
+	}
+
+	if values := md.Get(APIKeyMetadataKey); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+
+	for _, value := range md.Get(authorizationMetadataKey) {
+		if len(value) > len(bearerPrefix) &&
+			strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+			return strings.TrimSpace(value[len(bearerPrefix):])
+		}
+	}
+
+	return ""
+}
+
+// authorize checks the API key of the request against the store
+// and the scope, returning the ID of the key and the refund of its quota
+func (s *Store) authorize(ctx context.Context, scope string) (string, func(), error) {
+	apiKey := apiKeyFromMetadata(ctx)
+	if apiKey == "" {
+		return anonymousKeyID, nil, status.Errorf(codes.Unauthenticated,
+			"missing API key, expected in the `%s` metadata", APIKeyMetadataKey)
+	}
+
+	entry, check := s.authenticate(apiKey)
+	if !check {
+		return anonymousKeyID, nil, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+
+	keyID := entry.key.ID
+	if !entry.key.hasScope(scope) {
+		return keyID, nil, status.Errorf(codes.PermissionDenied,
+			"the API key does not grant the `%s` scope", scope)
+	}
+
+	day, check := s.consume(entry)
+	if !check {
+		return keyID, nil, status.Error(codes.ResourceExhausted,
+			"the daily quota of the API key is exhausted")
+	}
+
+	var once sync.Once
+	refund := func() {
+		once.Do(func() { s.refund(entry, day) })
+	}
+
+	return keyID, refund, nil
+}
+
+// UnaryServerInterceptor rejects the requests without a valid API key
+// granting the method scope, and records the key ID of the requests
+// in the logs and the metrics
+func UnaryServerInterceptor(store *Store, m *metrics.Metrics,
+	logger *slog.Logger) grpc.UnaryServerInterceptor {
+
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+			return handler(ctx, req)
+		}
+
+		keyID, refund, err := store.authorize(ctx, requiredScope(info.FullMethod))
+		logging.AddAttrs(ctx, slog.String(KeyIDKey, keyID))
+		if err != nil {
+			logger.WarnContext(ctx, "request rejected",
+				"method", info.FullMethod, "error", err)
+			m.ObserveKeyRequest(keyID, info.FullMethod, status.Code(err).String())
+			return nil, err
+		}
+
+		ctx = context.WithValue(ctx, keyIDContextKey{}, keyID)
+		ctx = context.WithValue(ctx, refundContextKey{}, refund)
+		resp, err := handler(ctx, req)
+		m.ObserveKeyRequest(keyID, info.FullMethod, status.Code(err).String())
+
+		return resp, err
+	}
+}
+
+// the HTTP status of the authorization errors
+var httpStatusCodes = map[codes.Code]int{
+	codes.Unauthenticated:   http.StatusUnauthorized,
+	codes.PermissionDenied:  http.StatusForbidden,
+	codes.ResourceExhausted: http.StatusTooManyRequests,
+}
+
+// HTTPHandler rejects the HTTP requests without a valid API key granting
+// the scope, read from the X-Api-Key header or as a bearer token
+func HTTPHandler(store *Store, scope string, next http.Handler,
+	logger *slog.Logger) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md := metadata.MD{}
+		for _, key := range []string{APIKeyMetadataKey, authorizationMetadataKey} {
+			if values := r.Header.Values(key); len(values) > 0 {
+				md.Set(key, values...)
+			}
+		}
+		ctx := metadata.NewIncomingContext(r.Context(), md)
+
+		keyID, _, err := store.authorize(ctx, scope)
+		logging.AddAttrs(ctx, slog.String(KeyIDKey, keyID))
+		if err != nil {
+			logger.WarnContext(ctx, "request rejected",
+				"path", r.URL.Path, "error", err)
+
+			st := status.Convert(err)
+			if st.Code() == codes.Unauthenticated {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, st.Message(), httpStatusCodes[st.Code()])
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
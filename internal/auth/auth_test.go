@@ -0,0 +1,140 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/musicresearcher/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	searchMethod = "/musicresearcher.MusicResearcher/Search"
+	adminMethod  = "/musicresearcher.MusicResearcher/Unknown"
+	healthMethod = "/grpc.health.v1.Health/Check"
+)
+
+func call(t *testing.T, store *auth.Store, method string, md metadata.MD) (string, error) {
+	interceptor := auth.UnaryServerInterceptor(store, nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	keyID := ""
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			keyID = auth.KeyID(ctx)
+			return nil, nil
+		})
+
+	return keyID, err
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+
+	hash := sha256.Sum256([]byte("admin-key"))
+	store, err := auth.NewStore([]auth.Key{{
+		ID: "search-1", Key: "search-key", Scopes: []string{auth.ScopeSearch}, DailyQuota: 2,
+	}, {
+		ID: "admin-1", KeyHash: hex.EncodeToString(hash[:]), Scopes: []string{auth.ScopeAdmin},
+	}})
+	assert.Nil(t, err)
+
+	// missing and invalid keys
+	_, err = call(t, store, searchMethod, metadata.MD{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = call(t, store, searchMethod, metadata.Pairs(auth.APIKeyMetadataKey, "wrong"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// health checks are allowed
+	_, err = call(t, store, healthMethod, metadata.MD{})
+	assert.Nil(t, err)
+
+	// scopes
+	keyID, err := call(t, store, searchMethod, metadata.Pairs(auth.APIKeyMetadataKey, "search-key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "search-1", keyID)
+	_, err = call(t, store, adminMethod, metadata.Pairs(auth.APIKeyMetadataKey, "search-key"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	keyID, err = call(t, store, adminMethod, metadata.Pairs("authorization", "Bearer admin-key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "admin-1", keyID)
+
+	// quota
+	_, err = call(t, store, searchMethod, metadata.Pairs(auth.APIKeyMetadataKey, "search-key"))
+	assert.Nil(t, err)
+	_, err = call(t, store, searchMethod, metadata.Pairs(auth.APIKeyMetadataKey, "search-key"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestSetMethodScope(t *testing.T) {
+
+	store, err := auth.NewStore([]auth.Key{{
+		ID: "search-1", Key: "search-key", Scopes: []string{auth.ScopeSearch},
+	}})
+	assert.Nil(t, err)
+
+	method := "/musicresearcher.Test/Query"
+	_, err = call(t, store, method, metadata.Pairs(auth.APIKeyMetadataKey, "search-key"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	auth.SetMethodScope(method, auth.ScopeSearch)
+	_, err = call(t, store, method, metadata.Pairs(auth.APIKeyMetadataKey, "search-key"))
+	assert.Nil(t, err)
+}
+
+func TestHTTPHandler(t *testing.T) {
+
+	store, err := auth.NewStore([]auth.Key{{
+		ID: "search-1", Key: "search-key", Scopes: []string{auth.ScopeSearch},
+	}, {
+		ID: "admin-1", Key: "admin-key", Scopes: []string{auth.ScopeAdmin},
+	}})
+	assert.Nil(t, err)
+
+	handler := auth.HTTPHandler(store, auth.ScopeAdmin,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "flushed")
+		}),
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	serve := func(header string, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/caches/flush", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusForbidden, serve("X-Api-Key", "search-key").Code)
+
+	w = serve("Authorization", "Bearer admin-key")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "flushed", w.Body.String())
+}
+
+func TestParseEnv(t *testing.T) {
+
+	_, err := auth.ParseEnv("key-1:secret:search|admin:100, key-2:other:search")
+	assert.Nil(t, err)
+
+	_, err = auth.ParseEnv("key-1:secret")
+	assert.NotNil(t, err)
+
+	_, err = auth.ParseEnv("key-1:secret:search,key-1:other:search")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// the scopes granted to the API keys
+const (
+	// ScopeSearch grants the search, the suggestions and the genre list
+	ScopeSearch = "search"
+	// ScopeAdmin grants every method
+	ScopeAdmin = "admin"
+)
+
+// Key is an API key, as configured in the key store
+type Key struct {
+	ID string `yaml:"id"`
+
+	// Key is the API key in clear, or KeyHash its sha256 hex digest
+	Key     string `yaml:"key"`
+	KeyHash string `yaml:"keyHash"`
+
+	Scopes []string `yaml:"scopes"`
+
+	// DailyQuota is the number of requests allowed per UTC day,
+	// unlimited when 0
+	DailyQuota int64 `yaml:"dailyQuota"`
+}
+
+func (k *Key) hasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+type keyEntry struct {
+	key  Key
+	hash []byte
+
+	day   string
+	count int64
+}
+
+// Store holds the API keys and their daily usage
+type Store struct {
+	mu      sync.Mutex
+	entries []*keyEntry
+	now     func() time.Time
+}
+
+func hashKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// NewStore creates a key store, validating the keys
+func NewStore(keys []Key) (*Store, error) {
+	s := &Store{
+		entries: make([]*keyEntry, 0, len(keys)),
+		now:     time.Now,
+	}
+
+	ids := make(map[string]struct{})
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("key without id")
+		}
+		if _, check := ids[key.ID]; check {
+			return nil, fmt.Errorf("duplicated key id `%s`", key.ID)
+		}
+		ids[key.ID] = struct{}{}
+
+		var hash []byte
+		switch {
+		case key.KeyHash != "":
+			decoded, err := hex.DecodeString(key.KeyHash)
+			if err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("invalid key hash for key `%s`", key.ID)
+			}
+			hash = decoded
+		case key.Key != "":
+			hash = hashKey(key.Key)
+		default:
+			return nil, fmt.Errorf("no key nor key hash for key `%s`", key.ID)
+		}
+
+		// the clear key is not kept in memory
+		key.Key = ""
+		s.entries = append(s.entries, &keyEntry{key: key, hash: hash})
+	}
+
+	return s, nil
+}
+
+type keyFile struct {
+	Keys []Key `yaml:"keys"`
+}
+
+// LoadFile loads the key store from a YAML or JSON file
+// holding a `keys` list
+func LoadFile(path string) (*Store, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %v", err)
+	}
+
+	var file keyFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("yaml.Unmarshal: %v", err)
+	}
+
+	return NewStore(file.Keys)
+}
+
+// ParseEnv loads the key store from a list of `id:key:scope1|scope2:quota`
+// entries separated by commas, the quota being optional
+func ParseEnv(value string) (*Store, error) {
+	keys := make([]Key, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) < 3 || len(parts) > 4 {
+			return nil, fmt.Errorf("invalid key entry, expected id:key:scopes[:quota]")
+		}
+
+		key := Key{
+			ID:     parts[0],
+			Key:    parts[1],
+			Scopes: strings.Split(parts[2], "|"),
+		}
+
+		if len(parts) == 4 {
+			quota, err := strconv.ParseInt(parts[3], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quota for key `%s`: %v", key.ID, err)
+			}
+			key.DailyQuota = quota
+		}
+
+		keys = append(keys, key)
+	}
+
+	return NewStore(keys)
+}
+
+// authenticate returns the key matching the clear API key
+func (s *Store) authenticate(apiKey string) (*keyEntry, bool) {
+	hash := hashKey(apiKey)
+
+	var found *keyEntry
+	for _, entry := range s.entries {
+		// every key is compared, in constant time
+		if subtle.ConstantTimeCompare(entry.hash, hash) == 1 {
+			found = entry
+		}
+	}
+
+	return found, found != nil
+}
+
+// consume counts a request of the key, returning the day it was
+// counted on, and false when its daily quota is exhausted
+func (s *Store) consume(entry *keyEntry) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := s.now().UTC().Format(time.DateOnly)
+	if entry.day != day {
+		entry.day = day
+		entry.count = 0
+	}
+
+	if entry.key.DailyQuota > 0 && entry.count >= entry.key.DailyQuota {
+		return day, false
+	}
+	entry.count++
+
+	return day, true
+}
+
+// refund gives back a request counted by consume on the day,
+// nothing being given back once the quota was reset
+func (s *Store) refund(entry *keyEntry, day string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.day == day && entry.count > 0 {
+		entry.count--
+	}
+}
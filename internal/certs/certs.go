@@ -0,0 +1,233 @@
+// Package certs serves the TLS and mutual-TLS credentials of the service.
+// The certificates are reloaded when their files change, so that they can
+// be renewed without restart, and the identity of the clients is taken
+// from the subject of their certificate.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientSubjectKey is the log attribute of the client certificate subject
+const ClientSubjectKey = "client_subject"
+
+// Options configures the TLS credentials
+type Options struct {
+	// CertFile and KeyFile are the PEM server certificate and key
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is the PEM bundle of the CAs trusted for the client
+	// certificates, the clients must present one when provided (mTLS)
+	ClientCAFile string
+}
+
+// Enabled checks if the TLS is configured
+func (opt Options) Enabled() bool {
+	return opt.CertFile != "" || opt.KeyFile != ""
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader holds the current TLS config, reloaded on file change
+type Reloader struct {
+	opt    Options
+	logger *slog.Logger
+
+	mu     sync.RWMutex
+	config *tls.Config
+	stamps map[string]fileStamp
+}
+
+// NewReloader loads the certificates
+func NewReloader(opt Options, logger *slog.Logger) (*Reloader, error) {
+	if opt.CertFile == "" || opt.KeyFile == "" {
+		return nil, fmt.Errorf("both the certificate and the key files are required")
+	}
+
+	r := &Reloader{
+		opt:    opt,
+		logger: logger,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.opt.CertFile, r.opt.KeyFile}
+	if r.opt.ClientCAFile != "" {
+		files = append(files, r.opt.ClientCAFile)
+	}
+
+	return files
+}
+
+func statFiles(files []string) (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("os.Stat: %v", err)
+		}
+		stamps[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return stamps, nil
+}
+
+// load reads the files and replaces the current config
+func (r *Reloader) load() error {
+	stamps, err := statFiles(r.files())
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opt.CertFile, r.opt.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls.LoadX509KeyPair: %v", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if r.opt.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opt.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("os.ReadFile: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", r.opt.ClientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.config = config
+	r.stamps = stamps
+
+	return nil
+}
+
+// changed checks if a file changed since the last load
+func (r *Reloader) changed() bool {
+	stamps, err := statFiles(r.files())
+	if err != nil {
+		// a file being replaced, checked again on the next tick
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for file, stamp := range stamps {
+		if r.stamps[file] != stamp {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watch reloads the certificates when their files change,
+// until the context is done
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !r.changed() {
+			continue
+		}
+
+		// the previous certificates are kept on failure
+		if err := r.load(); err != nil {
+			r.logger.Error("failed to reload the certificates", "error", err)
+			continue
+		}
+		r.logger.Info("certificates reloaded")
+	}
+}
+
+// TLSConfig returns a TLS config serving the current certificates
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return r.config, nil
+		},
+	}
+}
+
+// Identity returns the subject of the verified client certificate
+// of the request, its common name when set
+func Identity(ctx context.Context) string {
+	p, check := peer.FromContext(ctx)
+	if !check {
+		return ""
+	}
+
+	tlsInfo, check := p.AuthInfo.(credentials.TLSInfo)
+	if !check || len(tlsInfo.State.VerifiedChains) == 0 ||
+		len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	subject := tlsInfo.State.VerifiedChains[0][0].Subject
+	if subject.CommonName != "" {
+		return subject.CommonName
+	}
+
+	return subject.String()
+}
+
+// UnaryServerInterceptor adds the client certificate subject
+// to the log lines of the request
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		if identity := Identity(ctx); identity != "" {
+			logging.AddAttrs(ctx, slog.String(ClientSubjectKey, identity))
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,157 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/certs"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// issues a certificate, self-signed when the parent is nil
+func issue(t *testing.T, commonName string, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeFile(t *testing.T, path string, content []byte) {
+	assert.Nil(t, os.WriteFile(path, content, 0600))
+}
+
+// handshakes a client with the server config, returning
+// the certificate presented by the server
+func handshake(t *testing.T, serverConfig *tls.Config,
+	clientConfig *tls.Config) (*x509.Certificate, tls.ConnectionState, error) {
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lis.Close()
+
+	clientConn, err := net.Dial("tcp", lis.Addr().String())
+	assert.Nil(t, err)
+	defer clientConn.Close()
+	serverConn, err := lis.Accept()
+	assert.Nil(t, err)
+	defer serverConn.Close()
+
+	server := tls.Server(serverConn, serverConfig)
+	serverErr := make(chan error, 1)
+	go func() { serverErr <- server.Handshake() }()
+
+	client := tls.Client(clientConn, clientConfig)
+	if err := client.Handshake(); err != nil {
+		return nil, tls.ConnectionState{}, err
+	}
+	if err := <-serverErr; err != nil {
+		return nil, tls.ConnectionState{}, err
+	}
+
+	return client.ConnectionState().PeerCertificates[0], server.ConnectionState(), nil
+}
+
+func TestReloader(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server-key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+
+	ca, caKey, caPem, _ := issue(t, "test ca", nil, nil)
+	_, _, serverPem, serverKeyPem := issue(t, "server-1", ca, caKey)
+	_, _, clientPem, clientKeyPem := issue(t, "batch-job", ca, caKey)
+	writeFile(t, certFile, serverPem)
+	writeFile(t, keyFile, serverKeyPem)
+	writeFile(t, caFile, caPem)
+
+	reloader, err := certs.NewReloader(certs.Options{
+		CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, err := tls.X509KeyPair(clientPem, clientKeyPem)
+	assert.Nil(t, err)
+	clientConfig := &tls.Config{
+		RootCAs:      roots,
+		ServerName:   "localhost",
+		Certificates: []tls.Certificate{clientCert},
+	}
+
+	// the client identity is the subject of its certificate
+	serverCert, state, err := handshake(t, reloader.TLSConfig(), clientConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "server-1", serverCert.Subject.CommonName)
+	ctxGiven := peer.NewContext(context.Background(),
+		&peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	assert.Equal(t, "batch-job", certs.Identity(ctxGiven))
+
+	// the client certificate is required
+	_, _, err = handshake(t, reloader.TLSConfig(), &tls.Config{
+		RootCAs: roots, ServerName: "localhost",
+	})
+	assert.NotNil(t, err)
+
+	// the renewed server certificate is served without restart
+	_, _, serverPem, serverKeyPem = issue(t, "server-2", ca, caKey)
+	writeFile(t, keyFile, serverKeyPem)
+	writeFile(t, certFile, append(serverPem, '\n'))
+	assert.Eventually(t, func() bool {
+		serverCert, _, err := handshake(t, reloader.TLSConfig(), clientConfig)
+		return err == nil && serverCert.Subject.CommonName == "server-2"
+	}, time.Second, 20*time.Millisecond)
+}
+
+func TestIdentity_withoutTLS(t *testing.T) {
+
+	assert.Equal(t, "", certs.Identity(context.Background()))
+}
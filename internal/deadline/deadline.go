@@ -0,0 +1,109 @@
+// Package deadline enforces a default deadline on the requests
+// received without one, so that no request is held open forever.
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Options configures the default deadlines
+type Options struct {
+	// Default is the deadline of the methods not listed in Methods,
+	// no deadline is enforced when not positive
+	Default time.Duration
+
+	// Methods holds the deadline of each method, by full method
+	// name (/package.Service/Method) or by method name alone
+	Methods map[string]time.Duration
+}
+
+// ParseMethods parses the `Method=duration` entries separated by commas,
+// such as `Search=8s,Suggest=1s`
+func ParseMethods(value string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		method, rawTimeout, check := strings.Cut(entry, "=")
+		if !check || method == "" {
+			return nil, fmt.Errorf("invalid entry `%s`, expected Method=duration", entry)
+		}
+
+		timeout, err := time.ParseDuration(rawTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("time.ParseDuration: %v", err)
+		}
+		out[method] = timeout
+	}
+
+	return out, nil
+}
+
+// timeout returns the default deadline of the method
+func (opt Options) timeout(fullMethod string) time.Duration {
+	if timeout, check := opt.Methods[fullMethod]; check {
+		return timeout
+	}
+
+	methodName := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	if timeout, check := opt.Methods[methodName]; check {
+		return timeout
+	}
+
+	return opt.Default
+}
+
+// Deadlines holds the default deadlines, which can be replaced at runtime
+type Deadlines struct {
+	opt atomic.Pointer[Options]
+}
+
+// New creates the default deadlines
+func New(opt Options) *Deadlines {
+	d := &Deadlines{}
+	d.Set(opt)
+
+	return d
+}
+
+// Set replaces the default deadlines, applied from the next requests
+func (d *Deadlines) Set(opt Options) {
+	d.opt.Store(&opt)
+}
+
+// UnaryServerInterceptor sets the default deadline of the method
+// on the requests received without deadline
+func (d *Deadlines) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		if _, check := ctx.Deadline(); check {
+			return handler(ctx, req)
+		}
+
+		timeout := d.opt.Load().timeout(info.FullMethod)
+		if timeout <= 0 {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return handler(ctx, req)
+	}
+}
+
+// UnaryServerInterceptor sets fixed default deadlines
+func UnaryServerInterceptor(opt Options) grpc.UnaryServerInterceptor {
+	return New(opt).UnaryServerInterceptor()
+}
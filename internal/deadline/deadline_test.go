@@ -0,0 +1,70 @@
+package deadline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/deadline"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+// returns the deadline seen by the handler, from now
+func call(interceptor grpc.UnaryServerInterceptor, ctx context.Context,
+	method string) (time.Duration, bool) {
+
+	var timeout time.Duration
+	var check bool
+	_, _ = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			var dl time.Time
+			dl, check = ctx.Deadline()
+			timeout = time.Until(dl)
+			return nil, nil
+		})
+
+	return timeout, check
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+
+	methodsGiven, err := deadline.ParseMethods("Search=8s, /musicresearcher.MusicResearcherExtension/Suggest=1s")
+	assert.Nil(t, err)
+
+	interceptor := deadline.UnaryServerInterceptor(deadline.Options{
+		Default: 10 * time.Second,
+		Methods: methodsGiven,
+	})
+
+	timeout, check := call(interceptor, context.Background(),
+		"/musicresearcher.MusicResearcher/Search")
+	assert.True(t, check)
+	assert.InDelta(t, 8*time.Second, timeout, float64(time.Second))
+
+	timeout, check = call(interceptor, context.Background(),
+		"/musicresearcher.MusicResearcherExtension/Suggest")
+	assert.True(t, check)
+	assert.InDelta(t, time.Second, timeout, float64(100*time.Millisecond))
+
+	timeout, check = call(interceptor, context.Background(),
+		"/musicresearcher.MusicResearcher/GetGenreList")
+	assert.True(t, check)
+	assert.InDelta(t, 10*time.Second, timeout, float64(time.Second))
+
+	// the deadline of the client is kept
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	timeout, check = call(interceptor, ctx, "/musicresearcher.MusicResearcher/Search")
+	assert.True(t, check)
+	assert.InDelta(t, 30*time.Second, timeout, float64(time.Second))
+}
+
+func TestParseMethods_withInvalidEntry(t *testing.T) {
+
+	_, err := deadline.ParseMethods("Search")
+	assert.NotNil(t, err)
+
+	_, err = deadline.ParseMethods("Search=fast")
+	assert.NotNil(t, err)
+}
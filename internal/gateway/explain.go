@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// the header of the relevance scores, from the x-explain trailer
+const explainHeader = "X-Explain"
+
+// addScores adds the relevance score of each track of the search
+// results, under its `score` field, when the search was explained.
+// The pb.Track message has no such field, the scores being otherwise
+// only returned in the x-explain trailer.
+func addScores(header http.Header, body []byte) ([]byte, error) {
+	entries := header.Values(explainHeader)
+	if len(entries) == 0 {
+		return body, nil
+	}
+
+	scores := make(map[string]json.RawMessage, len(entries))
+	for _, entry := range entries {
+		var score struct {
+			TrackID string `json:"trackId"`
+		}
+		if err := json.Unmarshal([]byte(entry), &score); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+		scores[score.TrackID] = json.RawMessage(entry)
+	}
+
+	var results map[string]json.RawMessage
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+
+	var tracks []map[string]json.RawMessage
+	if err := json.Unmarshal(results["tracks"], &tracks); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+
+	for _, track := range tracks {
+		var id string
+		if err := json.Unmarshal(track["ID"], &id); err != nil {
+			continue
+		}
+		if score, check := scores[id]; check {
+			track["score"] = score
+		}
+	}
+
+	encoded, err := json.Marshal(tracks)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %v", err)
+	}
+	results["tracks"] = encoded
+
+	return json.Marshal(results)
+}
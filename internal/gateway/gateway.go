@@ -0,0 +1,310 @@
+// Package gateway implements the REST/JSON API of the MusicResearcher
+// service. The HTTP requests are mapped onto the gRPC handlers, going
+// through the same interceptors, and the messages are encoded with protojson.
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/internal/graph"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	searchPath  = "/v1/search"
+	genresPath  = "/v1/genres"
+	openAPIPath = "/v1/openapi.json"
+
+	// GraphQLPath serves the GraphQL API
+	GraphQLPath = "/graphql"
+
+	searchMethod       = "/musicresearcher.MusicResearcher/Search"
+	getGenreListMethod = "/musicresearcher.MusicResearcher/GetGenreList"
+)
+
+// the query parameters forwarded as request metadata, e.g. `?dedup=popular`
+var metadataQueryParams = []string{"dedup", "explain", "rerank", "offset"}
+
+type Options struct {
+	Server pb.MusicResearcherServer
+
+	// Interceptors are applied around the handlers, in order,
+	// as for the gRPC requests
+	Interceptors []grpc.UnaryServerInterceptor
+
+	Logger *slog.Logger
+
+	// Graph serves the GraphQL API, disabled when nil
+	Graph *graph.Schema
+}
+
+type gateway struct {
+	server      pb.MusicResearcherServer
+	interceptor grpc.UnaryServerInterceptor
+	logger      *slog.Logger
+	graph       *graph.Schema
+
+	marshaler protojson.MarshalOptions
+}
+
+// NewHandler creates the REST/JSON HTTP handler
+func NewHandler(opt Options) http.Handler {
+	g := &gateway{
+		server:      opt.Server,
+		interceptor: chainInterceptors(opt.Interceptors),
+		logger:      opt.Logger,
+		graph:       opt.Graph,
+		marshaler:   protojson.MarshalOptions{EmitUnpopulated: true},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(searchPath, g.handleSearch)
+	mux.HandleFunc(genresPath, g.handleGenres)
+	mux.HandleFunc(openAPIPath, g.handleOpenAPI)
+	if g.graph != nil {
+		mux.HandleFunc(GraphQLPath, g.handleGraphQL)
+	}
+
+	return mux
+}
+
+// chains the interceptors, the first one being the outermost
+func chainInterceptors(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// stream records the header and the trailer set by the handlers,
+// sent back as HTTP headers
+type stream struct {
+	mu     sync.Mutex
+	method string
+	md     metadata.MD
+}
+
+func (s *stream) Method() string { return s.method }
+
+func (s *stream) SetHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.md = metadata.Join(s.md, md)
+	return nil
+}
+
+func (s *stream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *stream) SetTrailer(md metadata.MD) error { return s.SetHeader(md) }
+
+// builds the incoming metadata from the HTTP headers and the query parameters
+func incomingMetadata(r *http.Request) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range r.Header {
+		md.Append(strings.ToLower(key), values...)
+	}
+
+	query := r.URL.Query()
+	for _, param := range metadataQueryParams {
+		if value := query.Get(param); value != "" {
+			md.Set("x-"+param, value)
+		}
+	}
+
+	return md
+}
+
+// invoke calls the handler through the interceptors, and writes its response
+func (g *gateway) invoke(w http.ResponseWriter, r *http.Request,
+	method string, req proto.Message,
+	handler func(context.Context, proto.Message) (proto.Message, error)) {
+
+	g.invokeWith(w, r, method, req, handler, nil)
+}
+
+// invokeWith is invoke, the encoded response being passed to decorate
+// when set, along with the headers written from the metadata
+func (g *gateway) invokeWith(w http.ResponseWriter, r *http.Request,
+	method string, req proto.Message,
+	handler func(context.Context, proto.Message) (proto.Message, error),
+	decorate func(header http.Header, body []byte) ([]byte, error)) {
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		g.writeMessage(w, http.StatusMethodNotAllowed,
+			status.New(codes.Unimplemented, "method not allowed").Proto())
+		return
+	}
+
+	resp, err := g.call(w, r, method, req,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return handler(ctx, req.(proto.Message))
+		})
+	if err != nil {
+		g.writeError(w, err)
+		return
+	}
+
+	body, err := g.marshaler.Marshal(resp.(proto.Message))
+	if err == nil && decorate != nil {
+		body, err = decorate(w.Header(), body)
+	}
+	if err != nil {
+		g.logger.Error("failed to marshal response", "error", err)
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	g.writeBody(w, http.StatusOK, body)
+}
+
+// call calls the handler through the interceptors,
+// the header and the trailer it sets being written as HTTP headers
+func (g *gateway) call(w http.ResponseWriter, r *http.Request,
+	method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+
+	st := &stream{method: method}
+	ctx := metadata.NewIncomingContext(r.Context(), incomingMetadata(r))
+	ctx = grpc.NewContextWithServerTransportStream(ctx, st)
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		p := &peer.Peer{Addr: addr}
+		if r.TLS != nil {
+			p.AuthInfo = credentials.TLSInfo{State: *r.TLS}
+		}
+		ctx = peer.NewContext(ctx, p)
+	}
+
+	resp, err := g.interceptor(ctx, req,
+		&grpc.UnaryServerInfo{Server: g.server, FullMethod: method}, handler)
+
+	st.mu.Lock()
+	for key, values := range st.md {
+		for _, value := range values {
+			w.Header().Add(textproto.CanonicalMIMEHeaderKey(key), value)
+		}
+	}
+	st.mu.Unlock()
+
+	return resp, err
+}
+
+func (g *gateway) writeMessage(w http.ResponseWriter, code int, m proto.Message) {
+	body, err := g.marshaler.Marshal(m)
+	if err != nil {
+		g.logger.Error("failed to marshal response", "error", err)
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	g.writeBody(w, code, body)
+}
+
+func (g *gateway) writeBody(w http.ResponseWriter, code int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(body); err != nil {
+		g.logger.Error("failed to write response", "error", err)
+	}
+}
+
+// writeError writes the gRPC status of the error, as JSON,
+// along with the Retry-After header of its retry info
+func (g *gateway) writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	for _, detail := range st.Details() {
+		if retryInfo, check := detail.(*errdetails.RetryInfo); check {
+			seconds := int(math.Ceil(retryInfo.RetryDelay.AsDuration().Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+		}
+	}
+	g.writeMessage(w, HTTPStatusFromCode(st.Code()), st.Proto())
+}
+
+func (g *gateway) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	params := &pb.Parameters{
+		Query:        query.Get("q"),
+		GenreFilters: query["genre"],
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.ParseInt(limit, 10, 32)
+		if err != nil {
+			g.writeError(w, status.Errorf(codes.InvalidArgument,
+				"invalid limit `%s`", limit))
+			return
+		}
+		params.Limit = int32(value)
+	}
+
+	g.invokeWith(w, r, searchMethod, params,
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return g.server.Search(ctx, req.(*pb.Parameters))
+		}, addScores)
+}
+
+func (g *gateway) handleGenres(w http.ResponseWriter, r *http.Request) {
+	g.invoke(w, r, getGenreListMethod, &pb.Empty{},
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return g.server.GetGenreList(ctx, req.(*pb.Empty))
+		})
+}
+
+// HTTPStatusFromCode converts a gRPC status code into its HTTP status,
+// following google.rpc.Code mapping
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,231 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/internal/gateway"
+	"github.com/planetfall/musicresearcher/internal/graph"
+	"github.com/planetfall/musicresearcher/internal/service"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+type serverFake struct {
+	pb.UnimplementedMusicResearcherServer
+	params *pb.Parameters
+	md     metadata.MD
+}
+
+func (s *serverFake) Search(ctx context.Context, params *pb.Parameters) (*pb.Results, error) {
+	s.params = params
+	s.md, _ = metadata.FromIncomingContext(ctx)
+
+	_ = grpc.SetTrailer(ctx, metadata.Pairs("x-effective-query", "chilly gonzales"))
+	if len(s.md.Get("x-explain")) > 0 {
+		_ = grpc.SetTrailer(ctx, metadata.Pairs("x-explain",
+			`{"trackId":"track-1","score":0.5,"titleMatch":1}`))
+	}
+
+	return &pb.Results{
+		Tracks: []*pb.Track{{ID: "track-1", Name: "Gogol", DurationMs: 1000}},
+	}, nil
+}
+
+func newHandler(server pb.MusicResearcherServer,
+	interceptors ...grpc.UnaryServerInterceptor) http.Handler {
+
+	return gateway.NewHandler(gateway.Options{
+		Server:       server,
+		Interceptors: interceptors,
+		Logger:       slog.Default(),
+	})
+}
+
+func TestSearch(t *testing.T) {
+
+	serverGiven := &serverFake{}
+	methodList := make([]string, 0)
+	interceptorGiven := func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+		methodList = append(methodList, info.FullMethod)
+		return handler(ctx, req)
+	}
+
+	recorder := httptest.NewRecorder()
+	newHandler(serverGiven, interceptorGiven).ServeHTTP(recorder, httptest.NewRequest(
+		"GET", "/v1/search?q=chilly+gonzales&genre=piano&genre=jazz&limit=3&dedup=popular", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "chilly gonzales", recorder.Header().Get("X-Effective-Query"))
+
+	assert.Equal(t, "chilly gonzales", serverGiven.params.Query)
+	assert.Equal(t, []string{"piano", "jazz"}, serverGiven.params.GenreFilters)
+	assert.Equal(t, int32(3), serverGiven.params.Limit)
+	assert.Equal(t, []string{"popular"}, serverGiven.md.Get("x-dedup"))
+	assert.Equal(t, []string{"/musicresearcher.MusicResearcher/Search"}, methodList)
+
+	var body map[string]interface{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	tracks := body["tracks"].([]interface{})
+	assert.Len(t, tracks, 1)
+	assert.Equal(t, "Gogol", tracks[0].(map[string]interface{})["name"])
+	assert.Equal(t, float64(1000), tracks[0].(map[string]interface{})["durationMs"])
+}
+
+func TestSearch_withExplain(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	newHandler(&serverFake{}).ServeHTTP(recorder, httptest.NewRequest(
+		"GET", "/v1/search?q=gogol&explain=true", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var body map[string]interface{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	track := body["tracks"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Gogol", track["name"])
+	assert.Equal(t, map[string]interface{}{
+		"trackId": "track-1", "score": 0.5, "titleMatch": float64(1),
+	}, track["score"])
+}
+
+func TestSearch_withError(t *testing.T) {
+
+	// the search service, without any token requested for an empty query
+	providerGiven := &mocks.ProviderMock{}
+	serverGiven := service.NewService(service.Options{
+		GRPCServer: grpc.NewServer(),
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Spotify: myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+			ClientId:     "client-id",
+			ClientSecret: "client-secret",
+			Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Provider:     providerGiven,
+		}),
+	})
+
+	recorder := httptest.NewRecorder()
+	newHandler(serverGiven).ServeHTTP(recorder, httptest.NewRequest(
+		"GET", "/v1/search", nil))
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	var body map[string]interface{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, float64(codes.InvalidArgument), body["code"])
+	assert.Equal(t, "provided query is empty", body["message"])
+	providerGiven.AssertNotCalled(t, "NewClient", "client-id", "client-secret")
+}
+
+func TestSearch_withInvalidLimit(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	newHandler(&serverFake{}).ServeHTTP(recorder, httptest.NewRequest(
+		"GET", "/v1/search?q=gonzales&limit=ten", nil))
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestGenres_withUnimplemented(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	newHandler(&serverFake{}).ServeHTTP(recorder, httptest.NewRequest(
+		"GET", "/v1/genres", nil))
+
+	assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+}
+
+func TestOpenAPI(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	newHandler(&serverFake{}).ServeHTTP(recorder, httptest.NewRequest(
+		"GET", "/v1/openapi.json", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var document map[string]interface{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &document))
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	assert.Contains(t, schemas, "Results")
+	assert.Contains(t, schemas, "Track")
+	assert.Contains(t, schemas, "Album")
+	assert.Contains(t, schemas, "Artist")
+	assert.Contains(t, schemas, "GenreList")
+	assert.Contains(t, schemas, "Status")
+}
+
+func TestGraphQL(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("GetTracks", []spotify.ID{"t1"}).Return([]*spotify.FullTrack{
+		{SimpleTrack: spotify.SimpleTrack{ID: "t1", Name: "Gogol"}},
+	}, nil)
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.
+		On("NewClient", "client-id", "client-secret").
+		Return(clientGiven, time.Now().Add(time.Hour), nil)
+
+	schema, err := graph.NewSchema(graph.Options{
+		Spotify: myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+			ClientId:     "client-id",
+			ClientSecret: "client-secret",
+			Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Provider:     providerGiven,
+		}),
+	})
+	assert.Nil(t, err)
+
+	methodList := make([]string, 0)
+	handler := gateway.NewHandler(gateway.Options{
+		Server: &serverFake{},
+		Interceptors: []grpc.UnaryServerInterceptor{func(ctx context.Context, req interface{},
+			info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+			methodList = append(methodList, info.FullMethod)
+			return handler(ctx, req)
+		}},
+		Logger: slog.Default(),
+		Graph:  schema,
+	})
+
+	// POST
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql",
+		strings.NewReader(`{"query": "query($id: ID!) { track(id: $id) { name } }", "variables": {"id": "t1"}}`)))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data": {"track": {"name": "Gogol"}}}`, rec.Body.String())
+	assert.Equal(t, []string{graph.QueryMethod}, methodList)
+
+	// GET, rejected query
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+		"/graphql?query="+url.QueryEscape("{ unknown }"), nil))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"errors"`)
+
+	// unsupported method
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/graphql", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, POST", rec.Header().Get("Allow"))
+}
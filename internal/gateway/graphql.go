@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/planetfall/musicresearcher/internal/graph"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maximum size of the body of a GraphQL request
+const maxGraphQLBodySize = 1 << 20
+
+// reads the GraphQL request, from the query parameters
+// of a GET request or from the JSON body of a POST request
+func readGraphQLRequest(r *http.Request) (graph.Request, error) {
+	var req graph.Request
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return req, status.Errorf(codes.InvalidArgument, "invalid variables: %v", err)
+			}
+		}
+	case http.MethodPost:
+		decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxGraphQLBodySize))
+		if err := decoder.Decode(&req); err != nil {
+			return req, status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
+		}
+	}
+
+	if req.Query == "" {
+		return req, status.Error(codes.InvalidArgument, "the query is required")
+	}
+
+	return req, nil
+}
+
+// handleGraphQL executes the GraphQL request through the interceptors.
+// The rejected queries are answered with their GraphQL errors and a 400.
+func (g *gateway) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		g.writeMessage(w, http.StatusMethodNotAllowed,
+			status.New(codes.Unimplemented, "method not allowed").Proto())
+		return
+	}
+
+	req, err := readGraphQLRequest(r)
+	if err != nil {
+		g.writeError(w, err)
+		return
+	}
+
+	var result *graphql.Result
+	_, err = g.call(w, r, graph.QueryMethod, req,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			var err error
+			result, err = g.graph.Execute(ctx, req.(graph.Request))
+			return result, err
+		})
+
+	switch {
+	case err != nil && result != nil:
+		g.writeJSON(w, HTTPStatusFromCode(status.Code(err)), result)
+	case err != nil:
+		g.writeError(w, err)
+	default:
+		g.writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (g *gateway) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		g.logger.Error("failed to marshal response", "error", err)
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(body); err != nil {
+		g.logger.Error("failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,159 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type schema = map[string]interface{}
+
+// the protobuf scalar kinds, as openapi types and formats
+var kindSchemas = map[protoreflect.Kind]schema{
+	protoreflect.BoolKind:    {"type": "boolean"},
+	protoreflect.StringKind:  {"type": "string"},
+	protoreflect.BytesKind:   {"type": "string", "format": "byte"},
+	protoreflect.Int32Kind:   {"type": "integer", "format": "int32"},
+	protoreflect.Sint32Kind:  {"type": "integer", "format": "int32"},
+	protoreflect.Uint32Kind:  {"type": "integer", "format": "int64"},
+	protoreflect.Int64Kind:   {"type": "string", "format": "int64"},
+	protoreflect.Sint64Kind:  {"type": "string", "format": "int64"},
+	protoreflect.Uint64Kind:  {"type": "string", "format": "uint64"},
+	protoreflect.FloatKind:   {"type": "number", "format": "float"},
+	protoreflect.DoubleKind:  {"type": "number", "format": "double"},
+	protoreflect.Fixed32Kind: {"type": "integer", "format": "int64"},
+	protoreflect.Fixed64Kind: {"type": "string", "format": "uint64"},
+}
+
+// adds the schema of the message, and of the messages it uses,
+// to the openapi components
+func addMessageSchema(schemas schema, desc protoreflect.MessageDescriptor) string {
+	name := string(desc.Name())
+	if _, check := schemas[name]; check {
+		return name
+	}
+
+	properties := schema{}
+	message := schema{"type": "object", "properties": properties}
+	schemas[name] = message
+
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+
+		var fieldSchema schema
+		switch field.Kind() {
+		case protoreflect.MessageKind:
+			// well-known types are not detailed
+			if field.Message().FullName().Parent() == "google.protobuf" {
+				fieldSchema = schema{"type": "object"}
+				break
+			}
+			ref := addMessageSchema(schemas, field.Message())
+			fieldSchema = schema{"$ref": "#/components/schemas/" + ref}
+		case protoreflect.EnumKind:
+			values := make([]string, 0)
+			enumValues := field.Enum().Values()
+			for j := 0; j < enumValues.Len(); j++ {
+				values = append(values, string(enumValues.Get(j).Name()))
+			}
+			fieldSchema = schema{"type": "string", "enum": values}
+		default:
+			fieldSchema = kindSchemas[field.Kind()]
+		}
+
+		if field.IsList() {
+			fieldSchema = schema{"type": "array", "items": fieldSchema}
+		}
+		properties[field.JSONName()] = fieldSchema
+	}
+
+	return name
+}
+
+func jsonResponse(description string, message proto.Message, schemas schema) schema {
+	ref := addMessageSchema(schemas, message.ProtoReflect().Descriptor())
+	return schema{
+		"description": description,
+		"content": schema{
+			"application/json": schema{
+				"schema": schema{"$ref": "#/components/schemas/" + ref},
+			},
+		},
+	}
+}
+
+func queryParameter(name string, description string, paramSchema schema) schema {
+	return schema{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      paramSchema,
+	}
+}
+
+// OpenAPI generates the openapi document of the REST/JSON API,
+// the schemas being generated from the protobuf messages
+func OpenAPI() schema {
+	schemas := schema{}
+	errorResponse := jsonResponse("the gRPC status of the error", &status.Status{}, schemas)
+
+	return schema{
+		"openapi": "3.0.3",
+		"info": schema{
+			"title":   "Music Researcher",
+			"version": "v1",
+		},
+		"paths": schema{
+			searchPath: schema{
+				"get": schema{
+					"operationId": "Search",
+					"summary":     "searches the tracks in spotify",
+					"parameters": []schema{
+						queryParameter("q", "the query", schema{"type": "string"}),
+						queryParameter("genre", "the genres to filter, repeated",
+							schema{"type": "array", "items": schema{"type": "string"}}),
+						queryParameter("limit", "the maximum number of tracks",
+							schema{"type": "integer", "format": "int32"}),
+						queryParameter("offset", "the number of tracks to skip",
+							schema{"type": "integer", "format": "int32"}),
+						queryParameter("dedup", "merges the duplicated recordings",
+							schema{"type": "string", "enum": []string{"none", "earliest", "popular"}}),
+						queryParameter("explain", "adds the relevance score of each track, as its score field",
+							schema{"type": "boolean"}),
+						queryParameter("rerank", "sorts the tracks by relevance score",
+							schema{"type": "boolean"}),
+					},
+					"responses": schema{
+						"200":     jsonResponse("the tracks found", &pb.Results{}, schemas),
+						"default": errorResponse,
+					},
+				},
+			},
+			genresPath: schema{
+				"get": schema{
+					"operationId": "GetGenreList",
+					"summary":     "lists the genres available as filters",
+					"responses": schema{
+						"200":     jsonResponse("the genres", &pb.GenreList{}, schemas),
+						"default": errorResponse,
+					},
+				},
+			},
+		},
+		"components": schema{
+			"schemas": schemas,
+		},
+	}
+}
+
+func (g *gateway) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(OpenAPI()); err != nil {
+		g.logger.Error("failed to write openapi document", "error", err)
+	}
+}
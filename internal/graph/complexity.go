@@ -0,0 +1,142 @@
+package graph
+
+import (
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// the assumed size of the lists without limit argument
+const defaultListSize = 10
+
+// the fields returning lists, whose selections
+// are counted once per item
+var listFields = map[string]bool{
+	"tracks":  true,
+	"albums":  true,
+	"artists": true,
+	"search":  true,
+	"genres":  true,
+}
+
+// complexity computes the cost of an operation, each field costing 1,
+// and the fields of the list items being counted once per item.
+// It also returns the depth of the operation.
+type complexity struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+func newComplexity(doc *ast.Document, variables map[string]interface{}) *complexity {
+	c := &complexity{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+	}
+	for _, definition := range doc.Definitions {
+		if fragment, check := definition.(*ast.FragmentDefinition); check {
+			c.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	return c
+}
+
+// operation returns the operation of the document to execute,
+// the named one or the only one
+func operation(doc *ast.Document, name string) *ast.OperationDefinition {
+	for _, definition := range doc.Definitions {
+		op, check := definition.(*ast.OperationDefinition)
+		if !check {
+			continue
+		}
+		if name == "" || (op.Name != nil && op.Name.Value == name) {
+			return op
+		}
+	}
+
+	return nil
+}
+
+// the cost and the depth of the selection set
+func (c *complexity) selectionSet(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	cost, depth := 0, 0
+	for _, selection := range set.Selections {
+		var selectionCost, selectionDepth int
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			childCost, childDepth := c.selectionSet(selection.SelectionSet)
+			selectionCost = 1 + c.listSize(selection)*childCost
+			selectionDepth = 1 + childDepth
+		case *ast.InlineFragment:
+			selectionCost, selectionDepth = c.selectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			// the fragment cycles are rejected by the validation
+			if fragment, check := c.fragments[selection.Name.Value]; check {
+				selectionCost, selectionDepth = c.selectionSet(fragment.SelectionSet)
+			}
+		}
+
+		cost += selectionCost
+		depth = max(depth, selectionDepth)
+	}
+
+	return cost, depth
+}
+
+// the size of the list returned by the field,
+// given by its `limit` or `ids` arguments
+func (c *complexity) listSize(field *ast.Field) int {
+	if !listFields[field.Name.Value] {
+		return 1
+	}
+
+	for _, argument := range field.Arguments {
+		switch argument.Name.Value {
+		case "limit":
+			if limit := c.intValue(argument.Value); limit > 0 {
+				return limit
+			}
+		case "ids":
+			if ids := c.listLen(argument.Value); ids >= 0 {
+				return ids
+			}
+		}
+	}
+
+	return defaultListSize
+}
+
+func (c *complexity) intValue(value ast.Value) int {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		n, _ := strconv.Atoi(value.Value)
+		return n
+	case *ast.Variable:
+		switch n := c.variables[value.Name.Value].(type) {
+		case int:
+			return n
+		case float64:
+			return int(n)
+		}
+	}
+
+	return 0
+}
+
+func (c *complexity) listLen(value ast.Value) int {
+	switch value := value.(type) {
+	case *ast.ListValue:
+		return len(value.Values)
+	case *ast.Variable:
+		if list, check := c.variables[value.Name.Value].([]interface{}); check {
+			return len(list)
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,134 @@
+// Package graph implements the GraphQL API over the music catalog:
+// the tracks, the albums, the artists and the genres. The entities are
+// loaded through the myspotify layer, the loads of a level of the query
+// being batched and deduplicated, so that the nested fields of a list
+// do not call spotify once per item.
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// QueryMethod is the method of the GraphQL requests, for the interceptors
+const QueryMethod = "/musicresearcher.MusicResearcherGraph/Query"
+
+const (
+	defaultMaxComplexity = 5000
+	defaultMaxDepth      = 10
+)
+
+type Options struct {
+	Spotify myspotify.MySpotify
+
+	// MaxComplexity and MaxDepth bound the cost and the depth
+	// of the queries, 5000 and 10 when not positive
+	MaxComplexity int
+	MaxDepth      int
+}
+
+func (opt Options) getMaxComplexity() int {
+	if opt.MaxComplexity <= 0 {
+		return defaultMaxComplexity
+	}
+
+	return opt.MaxComplexity
+}
+
+func (opt Options) getMaxDepth() int {
+	if opt.MaxDepth <= 0 {
+		return defaultMaxDepth
+	}
+
+	return opt.MaxDepth
+}
+
+// Request is a GraphQL request
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Schema executes the GraphQL requests
+type Schema struct {
+	schema  graphql.Schema
+	spotify myspotify.MySpotify
+
+	maxComplexity int
+	maxDepth      int
+}
+
+// NewSchema builds the schema of the catalog
+func NewSchema(opt Options) (*Schema, error) {
+	schema, err := newSchema(opt.Spotify)
+	if err != nil {
+		return nil, fmt.Errorf("newSchema: %v", err)
+	}
+
+	return &Schema{
+		schema:        schema,
+		spotify:       opt.Spotify,
+		maxComplexity: opt.getMaxComplexity(),
+		maxDepth:      opt.getMaxDepth(),
+	}, nil
+}
+
+// rejects the request, with the errors formatted as GraphQL errors
+func reject(errs []gqlerrors.FormattedError) (*graphql.Result, error) {
+	message := "invalid query"
+	if len(errs) > 0 {
+		message = errs[0].Message
+	}
+
+	return &graphql.Result{Errors: errs}, status.Error(codes.InvalidArgument, message)
+}
+
+// Execute executes the request. The requests that cannot be
+// parsed, that are invalid or too complex are rejected with an
+// InvalidArgument error, along with the result holding the errors.
+func (s *Schema) Execute(ctx context.Context, req Request) (*graphql.Result, error) {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return reject(gqlerrors.FormatErrors(err))
+	}
+
+	validation := graphql.ValidateDocument(&s.schema, doc, nil)
+	if !validation.IsValid {
+		return reject(validation.Errors)
+	}
+
+	op := operation(doc, req.OperationName)
+	if op == nil {
+		return reject([]gqlerrors.FormattedError{gqlerrors.NewFormattedError(
+			fmt.Sprintf("unknown operation `%s`", req.OperationName))})
+	}
+
+	cost, depth := newComplexity(doc, req.Variables).selectionSet(op.SelectionSet)
+	if depth > s.maxDepth {
+		return reject([]gqlerrors.FormattedError{gqlerrors.NewFormattedError(
+			fmt.Sprintf("the query depth %d exceeds the maximum depth %d", depth, s.maxDepth))})
+	}
+	if cost > s.maxComplexity {
+		return reject([]gqlerrors.FormattedError{gqlerrors.NewFormattedError(
+			fmt.Sprintf("the query complexity %d exceeds the maximum complexity %d", cost, s.maxComplexity))})
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       context.WithValue(ctx, loadersContextKey{}, newLoaders(s.spotify)),
+	}), nil
+}
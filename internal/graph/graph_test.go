@@ -0,0 +1,202 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/graph"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newSchema(t *testing.T, client *mocks.ClientMock) *graph.Schema {
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.
+		On("NewClient", "client-id", "client-secret").
+		Return(client, time.Now().Add(time.Hour), nil)
+
+	schema, err := graph.NewSchema(graph.Options{
+		Spotify: myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+			ClientId:     "client-id",
+			ClientSecret: "client-secret",
+			Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Provider:     providerGiven,
+		}),
+	})
+	assert.Nil(t, err)
+
+	return schema
+}
+
+func getTrack(id spotify.ID, artistIDs ...spotify.ID) *spotify.FullTrack {
+	track := &spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: id, Name: string(id)}}
+	for _, artistID := range artistIDs {
+		track.Artists = append(track.Artists, spotify.SimpleArtist{ID: artistID, Name: string(artistID)})
+	}
+
+	return track
+}
+
+func TestExecute_batching(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("GetTracks", []spotify.ID{"t1", "t2", "t3"}).Return([]*spotify.FullTrack{
+		getTrack("t1", "a1"), getTrack("t2", "a1"), getTrack("t3", "a2"),
+	}, nil)
+	clientGiven.On("GetArtists", []spotify.ID{"a1", "a2"}).Return([]*spotify.FullArtist{
+		{SimpleArtist: spotify.SimpleArtist{ID: "a1", Name: "a1"}, Genres: []string{"piano"}},
+		{SimpleArtist: spotify.SimpleArtist{ID: "a2", Name: "a2"}, Genres: []string{"jazz"}},
+	}, nil)
+
+	schema := newSchema(t, clientGiven)
+
+	result, err := schema.Execute(context.Background(), graph.Request{
+		Query: `{ tracks(ids: ["t1", "t2", "t3"]) { name artists { name genres { name } } } }`,
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, result.Errors)
+
+	data, _ := json.Marshal(result.Data)
+	assert.JSONEq(t, `{"tracks": [
+		{"name": "t1", "artists": [{"name": "a1", "genres": [{"name": "piano"}]}]},
+		{"name": "t2", "artists": [{"name": "a1", "genres": [{"name": "piano"}]}]},
+		{"name": "t3", "artists": [{"name": "a2", "genres": [{"name": "jazz"}]}]}
+	]}`, string(data))
+
+	// one call per level, each artist loaded once
+	clientGiven.AssertNumberOfCalls(t, "GetTracks", 1)
+	clientGiven.AssertNumberOfCalls(t, "GetArtists", 1)
+}
+
+func TestExecute_embeddedFields(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("GetTracks", []spotify.ID{"t1"}).Return([]*spotify.FullTrack{
+		getTrack("t1", "a1"),
+	}, nil)
+
+	schema := newSchema(t, clientGiven)
+
+	// the names of the artists are embedded in the track
+	result, err := schema.Execute(context.Background(), graph.Request{
+		Query: `{ track(id: "t1") { artists { id name } } }`,
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, result.Errors)
+
+	clientGiven.AssertNotCalled(t, "GetArtists", []spotify.ID{"a1"})
+}
+
+func TestExecute_notFound(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("GetTracks", []spotify.ID{"unknown"}).Return([]*spotify.FullTrack{nil}, nil)
+
+	schema := newSchema(t, clientGiven)
+
+	result, err := schema.Execute(context.Background(), graph.Request{
+		Query: `query Track($id: ID!) { track(id: $id) { name } }`,
+		Variables: map[string]interface{}{
+			"id": "unknown",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, map[string]interface{}{"track": nil}, result.Data)
+}
+
+func TestExecute_tooComplex(t *testing.T) {
+
+	schema := newSchema(t, &mocks.ClientMock{})
+
+	result, err := schema.Execute(context.Background(), graph.Request{
+		Query: `{ search(query: "piano", limit: 50) { album { tracks {
+			artists { albums(limit: 50) { name } } } } } }`,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, result.Errors[0].Message, "complexity")
+}
+
+func TestExecute_tooDeep(t *testing.T) {
+
+	schema, err := graph.NewSchema(graph.Options{
+		Spotify:  myspotify.NewMySpotify(myspotify.MySpotifyOptions{}),
+		MaxDepth: 3,
+	})
+	assert.Nil(t, err)
+
+	result, err := schema.Execute(context.Background(), graph.Request{
+		Query: `{ artist(id: "a1") { albums { artists { name } } } }`,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, result.Errors[0].Message, "depth")
+}
+
+func TestExecute_invalid(t *testing.T) {
+
+	schema := newSchema(t, &mocks.ClientMock{})
+
+	_, err := schema.Execute(context.Background(), graph.Request{Query: `{ track { unknown } }`})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = schema.Execute(context.Background(), graph.Request{Query: `{ track(`})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestExecute_searchWithExplain(t *testing.T) {
+
+	trackGiven := *getTrack("t1", "a1")
+	trackGiven.Name = "piano man"
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", "piano").Return(&spotify.SearchResult{
+		Tracks: &spotify.FullTrackPage{Tracks: []spotify.FullTrack{trackGiven}},
+	}, nil)
+	clientGiven.On("GetArtist", spotify.ID("a1")).Return(&spotify.FullArtist{
+		SimpleArtist: spotify.SimpleArtist{ID: "a1", Name: "a1"},
+	}, nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	schema := newSchema(t, clientGiven)
+
+	result, err := schema.Execute(context.Background(), graph.Request{
+		Query: `{ search(query: "piano", explain: true) { id score { score titleMatch upstreamRank } } }`,
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, result.Errors)
+
+	data, _ := json.Marshal(result.Data)
+	var got struct {
+		Search []struct {
+			ID    string
+			Score *struct {
+				Score        float64
+				TitleMatch   float64
+				UpstreamRank int
+			}
+		}
+	}
+	assert.Nil(t, json.Unmarshal(data, &got))
+	assert.Len(t, got.Search, 1)
+	assert.Equal(t, "t1", got.Search[0].ID)
+	assert.NotNil(t, got.Search[0].Score)
+	assert.Equal(t, 1.0, got.Search[0].Score.TitleMatch)
+	assert.Greater(t, got.Search[0].Score.Score, 0.0)
+
+	// the score is null without explain
+	result, err = schema.Execute(context.Background(), graph.Request{
+		Query: `{ search(query: "piano") { id score { score } } }`,
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, result.Errors)
+	data, _ = json.Marshal(result.Data)
+	assert.JSONEq(t, `{"search": [{"id": "t1", "score": null}]}`, string(data))
+}
@@ -0,0 +1,107 @@
+package graph
+
+import (
+	"context"
+	"sync"
+)
+
+// loader batches and dedups the loads of the entities of a request.
+// The IDs registered while the executor resolves a level of the query
+// are fetched together, on the first access to one of them, and each ID
+// is fetched once per request.
+type loader[T any] struct {
+	mu    sync.Mutex
+	fetch func(ctx context.Context, ids []string) ([]T, error)
+
+	// the loaded entities, nil while pending
+	results map[string]*loadResult[T]
+	pending []string
+}
+
+type loadResult[T any] struct {
+	value T
+	err   error
+}
+
+func newLoader[T any](fetch func(ctx context.Context, ids []string) ([]T, error)) *loader[T] {
+	return &loader[T]{
+		fetch:   fetch,
+		results: make(map[string]*loadResult[T]),
+	}
+}
+
+// prime stores an entity fetched by other means
+func (l *loader[T]) prime(id string, value T) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.results[id] == nil {
+		l.results[id] = &loadResult[T]{value: value}
+	}
+}
+
+// loadMany registers the IDs, and returns a thunk
+// fetching the pending IDs on its first call
+func (l *loader[T]) loadMany(ctx context.Context, ids []string) func() ([]T, error) {
+	l.mu.Lock()
+	for _, id := range ids {
+		if _, check := l.results[id]; !check {
+			l.results[id] = nil
+			l.pending = append(l.pending, id)
+		}
+	}
+	l.mu.Unlock()
+
+	return func() ([]T, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.dispatch(ctx)
+
+		out := make([]T, 0, len(ids))
+		for _, id := range ids {
+			result := l.results[id]
+			if result.err != nil {
+				return nil, result.err
+			}
+			out = append(out, result.value)
+		}
+
+		return out, nil
+	}
+}
+
+// load registers the ID, and returns a thunk
+// fetching the pending IDs on its first call
+func (l *loader[T]) load(ctx context.Context, id string) func() (T, error) {
+	thunk := l.loadMany(ctx, []string{id})
+
+	return func() (T, error) {
+		values, err := thunk()
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+
+		return values[0], nil
+	}
+}
+
+// fetches the pending IDs, the lock being held by the caller
+func (l *loader[T]) dispatch(ctx context.Context) {
+	if len(l.pending) == 0 {
+		return
+	}
+
+	ids := l.pending
+	l.pending = nil
+
+	values, err := l.fetch(ctx, ids)
+	for i, id := range ids {
+		result := &loadResult[T]{err: err}
+		if err == nil && i < len(values) {
+			result.value = values[i]
+		}
+		l.results[id] = result
+	}
+}
@@ -0,0 +1,507 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+)
+
+// the loaders of a request
+type loaders struct {
+	tracks       *loader[*pb.Track]
+	albums       *loader[*myspotify.Album]
+	artists      *loader[*pb.Artist]
+	artistAlbums *loader[[]*pb.Album]
+
+	// the relevance scores of the tracks of the explained searches
+	scoresMu sync.Mutex
+	scores   map[string]myspotify.ScoreBreakdown
+}
+
+type loadersContextKey struct{}
+
+func newLoaders(mySpotify myspotify.MySpotify) *loaders {
+	return &loaders{
+		tracks:  newLoader(mySpotify.GetTracks),
+		albums:  newLoader(mySpotify.GetAlbums),
+		artists: newLoader(mySpotify.GetArtists),
+
+		// spotify has no batch lookup of the albums of artists,
+		// they are only deduplicated
+		artistAlbums: newLoader(func(ctx context.Context, keys []string) ([][]*pb.Album, error) {
+			out := make([][]*pb.Album, 0, len(keys))
+			for _, key := range keys {
+				id, limit := parseArtistAlbumsKey(key)
+				albums, err := mySpotify.GetArtistAlbums(ctx, id, limit)
+				if err != nil {
+					return nil, fmt.Errorf("mySpotify.GetArtistAlbums: %v", err)
+				}
+				out = append(out, albums)
+			}
+			return out, nil
+		}),
+	}
+}
+
+func loadersFromContext(ctx context.Context) *loaders {
+	return ctx.Value(loadersContextKey{}).(*loaders)
+}
+
+func (l *loaders) setScores(scoreList []myspotify.ScoreBreakdown) {
+	l.scoresMu.Lock()
+	defer l.scoresMu.Unlock()
+
+	if l.scores == nil {
+		l.scores = make(map[string]myspotify.ScoreBreakdown, len(scoreList))
+	}
+	for _, score := range scoreList {
+		l.scores[score.TrackID] = score
+	}
+}
+
+func (l *loaders) score(trackID string) (myspotify.ScoreBreakdown, bool) {
+	l.scoresMu.Lock()
+	defer l.scoresMu.Unlock()
+
+	score, check := l.scores[trackID]
+	return score, check
+}
+
+func artistAlbumsKey(id string, limit int) string {
+	return fmt.Sprintf("%s:%d", id, limit)
+}
+
+func parseArtistAlbumsKey(key string) (string, int) {
+	id, limit, _ := strings.Cut(key, ":")
+	value, _ := strconv.Atoi(limit)
+	return id, value
+}
+
+// ref is an entity of the graph: its ID, and its value once loaded,
+// partial when the entity is embedded in another one. The fields
+// missing from the value are loaded when requested, so that the loads
+// of the entities of a level of the query are batched together.
+type ref[T any] struct {
+	id      string
+	value   *T
+	partial bool
+}
+
+func newRef[T any](id string) *ref[T] {
+	return &ref[T]{id: id}
+}
+
+func loadedRef[T any](value *T, id string) *ref[T] {
+	return &ref[T]{id: id, value: value}
+}
+
+func partialRef[T any](value *T, id string) *ref[T] {
+	return &ref[T]{id: id, value: value, partial: true}
+}
+
+// resolves a field of the entity, loading the entity when its value
+// is unknown, or partial and the field is not embedded
+func resolveRef[T any](p graphql.ResolveParams, l *loader[*T], embedded bool,
+	get func(*T) (interface{}, error)) (interface{}, error) {
+
+	r := p.Source.(*ref[T])
+	if r.value != nil && (!r.partial || embedded) {
+		return get(r.value)
+	}
+
+	thunk := l.load(p.Context, r.id)
+	return func() (interface{}, error) {
+		value, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, fmt.Errorf("`%s` not found", r.id)
+		}
+		return get(value)
+	}, nil
+}
+
+// the refs of the entities found by a lookup, the ones not found being dropped
+func loadedRefs[T any](values []*T, id func(*T) string) []*ref[T] {
+	out := make([]*ref[T], 0, len(values))
+	for _, value := range values {
+		if value != nil {
+			out = append(out, loadedRef(value, id(value)))
+		}
+	}
+
+	return out
+}
+
+func trackID(t *pb.Track) string        { return t.ID }
+func albumID(a *myspotify.Album) string { return a.ID }
+func artistID(a *pb.Artist) string      { return a.ID }
+
+// returns the list of the string argument
+func stringList(value interface{}) []string {
+	values, _ := value.([]interface{})
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, check := value.(string); check {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+func genres(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+
+	return names
+}
+
+// entityField resolves a field of an entity
+func entityField[T any](t graphql.Output, embedded bool,
+	getLoader func(*loaders) *loader[*T],
+	get func(*T) (interface{}, error)) *graphql.Field {
+
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return resolveRef(p, getLoader(loadersFromContext(p.Context)), embedded, get)
+		},
+	}
+}
+
+// scoreField resolves a field of the score of a track
+func scoreField(t graphql.Output, get func(myspotify.ScoreBreakdown) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(t),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(myspotify.ScoreBreakdown)), nil
+		},
+	}
+}
+
+func listOf(t graphql.Type) graphql.Output {
+	return graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(t)))
+}
+
+// newSchema builds the schema of the catalog
+func newSchema(mySpotify myspotify.MySpotify) (graphql.Schema, error) {
+	nonNullString := graphql.NewNonNull(graphql.String)
+	nonNullID := graphql.NewNonNull(graphql.ID)
+
+	trackLoader := func(l *loaders) *loader[*pb.Track] { return l.tracks }
+	albumLoader := func(l *loaders) *loader[*myspotify.Album] { return l.albums }
+	artistLoader := func(l *loaders) *loader[*pb.Artist] { return l.artists }
+
+	genreType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Genre",
+		Description: "a music genre",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{
+				Type: nonNullString,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+			},
+		},
+	})
+
+	var trackType, albumType, artistType *graphql.Object
+
+	// the artists embedded in the tracks only hold their name and URL
+	artistType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Artist",
+		Description: "an artist",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{
+					Type: nonNullID,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*ref[pb.Artist]).id, nil
+					},
+				},
+				"name": entityField(nonNullString, true, artistLoader,
+					func(a *pb.Artist) (interface{}, error) { return a.Name, nil }),
+				"spotifyUrl": entityField(graphql.String, true, artistLoader,
+					func(a *pb.Artist) (interface{}, error) { return a.SpotifyUrl, nil }),
+				"imageUrl": entityField(graphql.String, false, artistLoader,
+					func(a *pb.Artist) (interface{}, error) { return a.ImageUrl, nil }),
+				"genres": entityField(listOf(genreType), false, artistLoader,
+					func(a *pb.Artist) (interface{}, error) { return genres(a.Genres), nil }),
+				"albums": &graphql.Field{
+					Type:        listOf(albumType),
+					Description: "the albums of the artist",
+					Args: graphql.FieldConfigArgument{
+						"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultListSize},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						limit, _ := p.Args["limit"].(int)
+						key := artistAlbumsKey(p.Source.(*ref[pb.Artist]).id, limit)
+
+						thunk := loadersFromContext(p.Context).artistAlbums.load(p.Context, key)
+						return func() (interface{}, error) {
+							albums, err := thunk()
+							if err != nil {
+								return nil, err
+							}
+
+							out := make([]*ref[myspotify.Album], 0, len(albums))
+							for _, album := range albums {
+								out = append(out, partialRef(&myspotify.Album{Album: album}, album.ID))
+							}
+							return out, nil
+						}, nil
+					},
+				},
+			}
+		}),
+	})
+
+	// the albums embedded in the tracks and listed by the
+	// artists lack their genres, their artists and their tracks
+	albumType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Album",
+		Description: "an album",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{
+					Type: nonNullID,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*ref[myspotify.Album]).id, nil
+					},
+				},
+				"name": entityField(nonNullString, true, albumLoader,
+					func(a *myspotify.Album) (interface{}, error) { return a.Name, nil }),
+				"spotifyUrl": entityField(graphql.String, true, albumLoader,
+					func(a *myspotify.Album) (interface{}, error) { return a.SpotifyUrl, nil }),
+				"imageUrl": entityField(graphql.String, true, albumLoader,
+					func(a *myspotify.Album) (interface{}, error) { return a.ImageUrl, nil }),
+				"releaseDate": entityField(graphql.String, true, albumLoader,
+					func(a *myspotify.Album) (interface{}, error) { return a.ReleaseDate, nil }),
+				"genres": entityField(listOf(genreType), false, albumLoader,
+					func(a *myspotify.Album) (interface{}, error) { return genres(a.Genres), nil }),
+				"artists": entityField(listOf(artistType), false, albumLoader,
+					func(a *myspotify.Album) (interface{}, error) {
+						out := make([]*ref[pb.Artist], 0, len(a.ArtistIDs))
+						for _, id := range a.ArtistIDs {
+							out = append(out, newRef[pb.Artist](id))
+						}
+						return out, nil
+					}),
+				"tracks": entityField(listOf(trackType), false, albumLoader,
+					func(a *myspotify.Album) (interface{}, error) {
+						out := make([]*ref[pb.Track], 0, len(a.TrackIDs))
+						for _, id := range a.TrackIDs {
+							out = append(out, newRef[pb.Track](id))
+						}
+						return out, nil
+					}),
+			}
+		}),
+	})
+
+	scoreType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Score",
+		Description: "the relevance score of a track, and its breakdown",
+		Fields: graphql.Fields{
+			"score": scoreField(graphql.Float,
+				func(s myspotify.ScoreBreakdown) interface{} { return s.Score }),
+			"upstreamRank": scoreField(graphql.Int,
+				func(s myspotify.ScoreBreakdown) interface{} { return s.UpstreamRank }),
+			"titleMatch": scoreField(graphql.Float,
+				func(s myspotify.ScoreBreakdown) interface{} { return s.TitleMatch }),
+			"artistMatch": scoreField(graphql.Float,
+				func(s myspotify.ScoreBreakdown) interface{} { return s.ArtistMatch }),
+			"genreMatch": scoreField(graphql.Boolean,
+				func(s myspotify.ScoreBreakdown) interface{} { return s.GenreMatch }),
+			"popularity": scoreField(graphql.Int,
+				func(s myspotify.ScoreBreakdown) interface{} { return int(s.Popularity) }),
+		},
+	})
+
+	trackField := func(t graphql.Output, get func(*pb.Track) (interface{}, error)) *graphql.Field {
+		return entityField(t, true, trackLoader, get)
+	}
+
+	trackType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Track",
+		Description: "a track",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: nonNullID,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*ref[pb.Track]).id, nil
+				},
+			},
+			"name": trackField(nonNullString,
+				func(t *pb.Track) (interface{}, error) { return t.Name, nil }),
+			"spotifyUrl": trackField(graphql.String,
+				func(t *pb.Track) (interface{}, error) { return t.SpotifyUrl, nil }),
+			"previewUrl": trackField(graphql.String,
+				func(t *pb.Track) (interface{}, error) { return t.PreviewUrl, nil }),
+			"durationMs": trackField(graphql.Int,
+				func(t *pb.Track) (interface{}, error) { return int(t.DurationMs), nil }),
+			"popularity": trackField(graphql.Int,
+				func(t *pb.Track) (interface{}, error) { return int(t.Popularity), nil }),
+			"album": trackField(albumType,
+				func(t *pb.Track) (interface{}, error) {
+					if t.Album == nil || t.Album.ID == "" {
+						return nil, nil
+					}
+					return partialRef(&myspotify.Album{Album: t.Album}, t.Album.ID), nil
+				}),
+			"artists": trackField(listOf(artistType),
+				func(t *pb.Track) (interface{}, error) {
+					out := make([]*ref[pb.Artist], 0, len(t.Artists))
+					for _, artist := range t.Artists {
+						out = append(out, partialRef(artist, artist.ID))
+					}
+					return out, nil
+				}),
+			"score": &graphql.Field{
+				Type:        scoreType,
+				Description: "the relevance score, set by the searches with explain",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					score, check := loadersFromContext(p.Context).score(p.Source.(*ref[pb.Track]).id)
+					if !check {
+						return nil, nil
+					}
+					return score, nil
+				},
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"track": &graphql.Field{
+				Type: trackType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNullID}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return lookup(p, loadersFromContext(p.Context).tracks, trackID)
+				},
+			},
+			"tracks": &graphql.Field{
+				Type: listOf(trackType),
+				Args: graphql.FieldConfigArgument{"ids": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(nonNullID))}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return lookupMany(p, loadersFromContext(p.Context).tracks, trackID)
+				},
+			},
+			"album": &graphql.Field{
+				Type: albumType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNullID}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return lookup(p, loadersFromContext(p.Context).albums, albumID)
+				},
+			},
+			"albums": &graphql.Field{
+				Type: listOf(albumType),
+				Args: graphql.FieldConfigArgument{"ids": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(nonNullID))}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return lookupMany(p, loadersFromContext(p.Context).albums, albumID)
+				},
+			},
+			"artist": &graphql.Field{
+				Type: artistType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNullID}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return lookup(p, loadersFromContext(p.Context).artists, artistID)
+				},
+			},
+			"artists": &graphql.Field{
+				Type: listOf(artistType),
+				Args: graphql.FieldConfigArgument{"ids": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(nonNullID))}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return lookupMany(p, loadersFromContext(p.Context).artists, artistID)
+				},
+			},
+			"search": &graphql.Field{
+				Type:        listOf(trackType),
+				Description: "searches the tracks, as the Search RPC",
+				Args: graphql.FieldConfigArgument{
+					"query":  &graphql.ArgumentConfig{Type: nonNullString},
+					"genres": &graphql.ArgumentConfig{Type: graphql.NewList(nonNullString)},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int},
+					"explain": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false,
+						Description: "scores the tracks, returned by their score field"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, _ := p.Args["limit"].(int)
+					explain, _ := p.Args["explain"].(bool)
+					result, err := mySpotify.SearchWithOptions(p.Context, myspotify.SearchOptions{
+						Query:        p.Args["query"].(string),
+						GenreFilters: stringList(p.Args["genres"]),
+						Limit:        limit,
+						Explain:      explain,
+					})
+					if err != nil {
+						return nil, fmt.Errorf("mySpotify.SearchWithOptions: %v", err)
+					}
+
+					// the tracks found are primed, so that they
+					// are not looked up again
+					l := loadersFromContext(p.Context)
+					for _, track := range result.Tracks {
+						l.tracks.prime(track.ID, track)
+					}
+					l.setScores(result.Scores)
+					return loadedRefs(result.Tracks, trackID), nil
+				},
+			},
+			"genres": &graphql.Field{
+				Type:        listOf(genreType),
+				Description: "the genre seeds, to filter the searches",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					genreList, err := mySpotify.GetGenreList(p.Context)
+					if err != nil {
+						return nil, fmt.Errorf("mySpotify.GetGenreList: %v", err)
+					}
+					return genres(genreList.Genres), nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// looks the entity of the `id` argument up, null when not found
+func lookup[T any](p graphql.ResolveParams, l *loader[*T],
+	id func(*T) string) (interface{}, error) {
+
+	thunk := l.load(p.Context, p.Args["id"].(string))
+	return func() (interface{}, error) {
+		value, err := thunk()
+		if err != nil || value == nil {
+			return nil, err
+		}
+		return loadedRef(value, id(value)), nil
+	}, nil
+}
+
+// looks the entities of the `ids` argument up, the ones not found being dropped
+func lookupMany[T any](p graphql.ResolveParams, l *loader[*T],
+	id func(*T) string) (interface{}, error) {
+
+	thunk := l.loadMany(p.Context, stringList(p.Args["ids"]))
+	return func() (interface{}, error) {
+		values, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		return loadedRefs(values, id), nil
+	}, nil
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDMetadataKey is the metadata key of the request ID,
+// read from the request and sent back in the response header
+const RequestIDMetadataKey = "x-request-id"
+
+// returns the request ID of the incoming metadata, or a new one
+func requestIDFromMetadata(ctx context.Context) string {
+	if md, check := metadata.FromIncomingContext(ctx); check {
+		if values := md.Get(RequestIDMetadataKey); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+
+	return NewRequestID()
+}
+
+// UnaryServerInterceptor assigns or propagates the request ID, stores it
+// in the context along with an upstream call counter, and logs
+// the method, the duration, the status code and the upstream call count
+func UnaryServerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		requestID := requestIDFromMetadata(ctx)
+		ctx = WithRequestID(ctx, requestID)
+		ctx = WithUpstreamCallCounter(ctx)
+		ctx = WithRequestAttrs(ctx)
+
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, requestID))
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		level := slog.LevelInfo
+		if err != nil {
+			level = slog.LevelError
+		}
+
+		logger.LogAttrs(ctx, level, "request handled",
+			slog.String("method", info.FullMethod),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("code", status.Code(err).String()),
+			slog.Int64("upstream_calls", UpstreamCalls(ctx)))
+
+		return resp, err
+	}
+}
@@ -0,0 +1,167 @@
+// Package logging implements the structured, request-scoped logging
+// of the service: the request ID, the upstream call count and the request
+// attributes are carried by the request context, and added to every log line.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	RequestIDKey     = "request_id"
+	redactedValue    = "[REDACTED]"
+	requestIDByteLen = 8
+)
+
+// the attributes containing one of these words are redacted
+var secretKeyWords = []string{"secret", "password", "token", "authorization", "api_key", "apikey"}
+
+type requestIDContextKey struct{}
+
+type upstreamCallsContextKey struct{}
+
+type requestAttrsContextKey struct{}
+
+// requestAttrs holds the attributes added to the log lines of a request
+// by the handlers and the inner interceptors
+type requestAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// WithRequestID stores the request ID in the context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestID returns the request ID stored in the context, if any
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// NewRequestID generates a random request ID
+func NewRequestID() string {
+	b := make([]byte, requestIDByteLen)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// WithUpstreamCallCounter stores a new upstream call counter in the context
+func WithUpstreamCallCounter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, upstreamCallsContextKey{}, new(atomic.Int64))
+}
+
+// CountUpstreamCall increments the upstream call counter of the context
+func CountUpstreamCall(ctx context.Context) {
+	if counter, check := ctx.Value(upstreamCallsContextKey{}).(*atomic.Int64); check {
+		counter.Add(1)
+	}
+}
+
+// UpstreamCalls returns the upstream call count of the context
+func UpstreamCalls(ctx context.Context) int64 {
+	if counter, check := ctx.Value(upstreamCallsContextKey{}).(*atomic.Int64); check {
+		return counter.Load()
+	}
+
+	return 0
+}
+
+// WithRequestAttrs stores a new holder of request attributes in the context
+func WithRequestAttrs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestAttrsContextKey{}, &requestAttrs{})
+}
+
+// AddAttrs adds attributes to every following log line of the request,
+// and to the final log line of the request interceptor
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if holder, check := ctx.Value(requestAttrsContextKey{}).(*requestAttrs); check {
+		holder.mu.Lock()
+		defer holder.mu.Unlock()
+
+		holder.attrs = append(holder.attrs, attrs...)
+	}
+}
+
+// returns the request attributes of the context
+func getAttrs(ctx context.Context) []slog.Attr {
+	if holder, check := ctx.Value(requestAttrsContextKey{}).(*requestAttrs); check {
+		holder.mu.Lock()
+		defer holder.mu.Unlock()
+
+		return append([]slog.Attr(nil), holder.attrs...)
+	}
+
+	return nil
+}
+
+// contextHandler adds the request ID and the request attributes
+// of the context to the log records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		r.AddAttrs(slog.String(RequestIDKey, requestID))
+	}
+	r.AddAttrs(getAttrs(ctx)...)
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range secretKeyWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redacts the attributes holding secrets
+func redactSecrets(groups []string, a slog.Attr) slog.Attr {
+	if isSecretKey(a.Key) {
+		return slog.String(a.Key, redactedValue)
+	}
+
+	return a
+}
+
+// ParseLevel converts a level name (debug, info, warn, error) into its slog.Level
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// NewLogger creates a JSON logger writing to w, adding the request ID
+// of the context to every line and redacting the secrets.
+// The level can be a *slog.LevelVar, to be changed at runtime.
+func NewLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactSecrets,
+	})})
+}
@@ -0,0 +1,54 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/planetfall/musicresearcher/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+
+	var buffer bytes.Buffer
+	logger := logging.NewLogger(&buffer, slog.LevelInfo)
+
+	ctx := logging.WithRequestID(context.Background(), "request-id-1")
+	logger.InfoContext(ctx, "message",
+		"client_secret", "secret-value", "query", "chilly gonzales")
+
+	var line map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buffer.Bytes(), &line))
+	assert.Equal(t, "request-id-1", line[logging.RequestIDKey])
+	assert.Equal(t, "[REDACTED]", line["client_secret"])
+	assert.Equal(t, "chilly gonzales", line["query"])
+}
+
+func TestUpstreamCalls(t *testing.T) {
+
+	ctx := context.Background()
+	logging.CountUpstreamCall(ctx)
+	assert.Equal(t, int64(0), logging.UpstreamCalls(ctx))
+
+	ctx = logging.WithUpstreamCallCounter(ctx)
+	logging.CountUpstreamCall(ctx)
+	logging.CountUpstreamCall(ctx)
+	assert.Equal(t, int64(2), logging.UpstreamCalls(ctx))
+}
+
+func TestAddAttrs(t *testing.T) {
+
+	var buffer bytes.Buffer
+	logger := logging.NewLogger(&buffer, slog.LevelInfo)
+
+	ctx := logging.WithRequestAttrs(context.Background())
+	logging.AddAttrs(ctx, slog.String("key_id", "key-1"))
+	logger.InfoContext(ctx, "message")
+
+	var line map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buffer.Bytes(), &line))
+	assert.Equal(t, "key-1", line["key_id"])
+}
@@ -0,0 +1,178 @@
+// Package metrics holds the prometheus metrics of the service:
+// the RPCs, the upstream spotify calls, the tokens and the searches.
+//
+// A nil *Metrics is valid and records nothing, so that the metrics
+// remain optional for the packages using them.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "musicresearcher"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	rpcDuration *prometheus.HistogramVec
+	rpcTotal    *prometheus.CounterVec
+
+	upstreamDuration    *prometheus.HistogramVec
+	upstreamTotal       *prometheus.CounterVec
+	upstreamRateLimited *prometheus.CounterVec
+
+	tokenRefreshTotal *prometheus.CounterVec
+
+	enrichmentCalls prometheus.Histogram
+
+	keyRequestTotal *prometheus.CounterVec
+}
+
+// New creates the metrics, registered in their own registry
+// along with the go runtime and process metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rpc_duration_seconds",
+			Help:      "The latency of the RPCs, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		rpcTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rpc_total",
+			Help:      "The number of RPCs, by method and status code.",
+		}, []string{"method", "code"}),
+
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_duration_seconds",
+			Help:      "The latency of the spotify calls, by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		upstreamTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upstream_total",
+			Help:      "The number of spotify calls, by operation and result.",
+		}, []string{"operation", "result"}),
+		upstreamRateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upstream_rate_limited_total",
+			Help:      "The number of spotify calls rejected with a 429, by operation.",
+		}, []string{"operation"}),
+
+		tokenRefreshTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refresh_total",
+			Help:      "The number of spotify token refreshes, by result.",
+		}, []string{"result"}),
+
+		enrichmentCalls: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "search_enrichment_calls",
+			Help:      "The number of artist enrichment calls per search.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+		}),
+
+		keyRequestTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_by_key_total",
+			Help:      "The number of authenticated RPCs, by API key, method and status code.",
+		}, []string{"key_id", "method", "code"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.rpcDuration, m.rpcTotal,
+		m.upstreamDuration, m.upstreamTotal, m.upstreamRateLimited,
+		m.tokenRefreshTotal,
+		m.enrichmentCalls,
+		m.keyRequestTotal,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the prometheus format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
+
+// ObserveUpstreamCall records a spotify call of the given operation
+func (m *Metrics) ObserveUpstreamCall(operation string,
+	duration time.Duration, err error, rateLimited bool) {
+
+	if m == nil {
+		return
+	}
+
+	m.upstreamDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	m.upstreamTotal.WithLabelValues(operation, resultLabel(err)).Inc()
+	if rateLimited {
+		m.upstreamRateLimited.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveTokenRefresh records a spotify token refresh
+func (m *Metrics) ObserveTokenRefresh(err error) {
+	if m == nil {
+		return
+	}
+
+	m.tokenRefreshTotal.WithLabelValues(resultLabel(err)).Inc()
+}
+
+// ObserveEnrichmentCalls records the artist enrichment calls of a search
+func (m *Metrics) ObserveEnrichmentCalls(calls int) {
+	if m == nil {
+		return
+	}
+
+	m.enrichmentCalls.Observe(float64(calls))
+}
+
+// ObserveKeyRequest records an RPC of the given API key
+func (m *Metrics) ObserveKeyRequest(keyID string, method string, code string) {
+	if m == nil {
+		return
+	}
+
+	m.keyRequestTotal.WithLabelValues(keyID, method, code).Inc()
+}
+
+// UnaryServerInterceptor records the latency and the status code of the RPCs
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		if m != nil {
+			m.rpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+			m.rpcTotal.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		}
+
+		return resp, err
+	}
+}
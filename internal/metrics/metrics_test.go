@@ -0,0 +1,58 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := io.ReadAll(recorder.Body)
+	assert.Nil(t, err)
+
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+
+	m := metrics.New()
+	m.ObserveUpstreamCall("Search", time.Millisecond, nil, false)
+	m.ObserveUpstreamCall("GetArtist", time.Millisecond, fmt.Errorf("failed"), true)
+	m.ObserveTokenRefresh(nil)
+	m.ObserveEnrichmentCalls(3)
+
+	interceptor := m.UnaryServerInterceptor()
+	_, _ = interceptor(context.Background(), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/musicresearcher.MusicResearcher/Search"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.InvalidArgument, "invalid")
+		})
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `musicresearcher_upstream_total{operation="Search",result="success"} 1`)
+	assert.Contains(t, body, `musicresearcher_upstream_rate_limited_total{operation="GetArtist"} 1`)
+	assert.Contains(t, body, `musicresearcher_token_refresh_total{result="success"} 1`)
+	assert.Contains(t, body, `musicresearcher_search_enrichment_calls_count 1`)
+	assert.Contains(t, body,
+		`musicresearcher_rpc_total{code="InvalidArgument",method="/musicresearcher.MusicResearcher/Search"} 1`)
+}
+
+func TestMetrics_withNil(t *testing.T) {
+
+	var m *metrics.Metrics
+	m.ObserveUpstreamCall("Search", time.Millisecond, nil, false)
+	m.ObserveTokenRefresh(nil)
+	m.ObserveEnrichmentCalls(1)
+}
@@ -0,0 +1,71 @@
+package mux
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	corsAllowedMethods = "GET, POST, OPTIONS"
+	corsMaxAge         = "600"
+)
+
+// the headers read by the gRPC-Web clients
+var grpcExposedHeaders = []string{"grpc-status", "grpc-message", "grpc-status-details-bin"}
+
+// CORSOptions configures the cross-origin requests
+type CORSOptions struct {
+	// AllowedOrigins are the origins allowed to call the server,
+	// `*` allowing any, none when empty
+	AllowedOrigins []string
+
+	// ExposedHeaders are the response headers readable
+	// by the browsers, along with the gRPC ones
+	ExposedHeaders []string
+}
+
+func (opt CORSOptions) allowed(origin string) bool {
+	for _, allowed := range opt.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withCORS answers the preflight requests of the allowed origins,
+// and adds the CORS headers to their requests
+func withCORS(opt CORSOptions, next http.Handler) http.Handler {
+	if len(opt.AllowedOrigins) == 0 {
+		return next
+	}
+
+	exposedHeaders := strings.Join(append(grpcExposedHeaders, opt.ExposedHeaders...), ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !opt.allowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Allow-Origin", origin)
+
+		// preflight
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.Set("Access-Control-Expose-Headers", exposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,150 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	// the flag of the frame holding the trailers, at the end of the body
+	trailerFrameFlag = 0x80
+)
+
+func isGRPCWebRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost &&
+		strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// serveGRPCWeb translates the gRPC-Web request into a gRPC one,
+// served by the handler, and its response back into gRPC-Web.
+// The text variant carries the body in base64.
+func serveGRPCWeb(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+	contentType := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, grpcWebTextContentType)
+
+	// the codec suffix, e.g. `+proto`
+	suffix := strings.TrimPrefix(contentType, grpcWebContentType)
+	if text {
+		suffix = strings.TrimPrefix(contentType, grpcWebTextContentType)
+	}
+
+	req := r.Clone(r.Context())
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2"
+	req.Header.Set("Content-Type", grpcContentType+suffix)
+	req.Header.Del("Content-Length")
+	req.ContentLength = -1
+	if text {
+		req.Body = io.NopCloser(base64.NewDecoder(base64.StdEncoding, r.Body))
+	}
+
+	rw := &webResponseWriter{
+		w:           w,
+		header:      http.Header{},
+		contentType: contentType,
+		body:        w,
+	}
+	if text {
+		rw.encoder = base64.NewEncoder(base64.StdEncoding, w)
+		rw.body = rw.encoder
+	}
+
+	handler.ServeHTTP(rw, req)
+	rw.finish()
+}
+
+// webResponseWriter writes the gRPC response as gRPC-Web:
+// the trailers are sent in a frame at the end of the body
+type webResponseWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	contentType string
+
+	body    io.Writer
+	encoder io.WriteCloser
+
+	wroteHeader bool
+}
+
+func (rw *webResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *webResponseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+
+	h := rw.w.Header()
+	for key, values := range rw.header {
+		if key == "Trailer" || strings.HasPrefix(key, http.TrailerPrefix) {
+			continue
+		}
+		h[key] = values
+	}
+	h.Set("Content-Type", rw.contentType)
+
+	rw.w.WriteHeader(code)
+}
+
+func (rw *webResponseWriter) Write(b []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	return rw.body.Write(b)
+}
+
+func (rw *webResponseWriter) Flush() {
+	rw.WriteHeader(http.StatusOK)
+	if flusher, check := rw.w.(http.Flusher); check {
+		flusher.Flush()
+	}
+}
+
+// finish writes the trailers set by the handler in the trailer frame
+func (rw *webResponseWriter) finish() {
+	rw.WriteHeader(http.StatusOK)
+
+	trailer := http.Header{}
+	for _, key := range rw.header.Values("Trailer") {
+		if values := rw.header.Values(key); len(values) > 0 {
+			trailer[strings.ToLower(key)] = values
+		}
+	}
+	for key, values := range rw.header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			trailer[strings.ToLower(strings.TrimPrefix(key, http.TrailerPrefix))] = values
+		}
+	}
+
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var block bytes.Buffer
+	for _, key := range keys {
+		for _, value := range trailer[key] {
+			fmt.Fprintf(&block, "%s: %s\r\n", key, value)
+		}
+	}
+
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = trailerFrameFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	frame = append(frame, block.Bytes()...)
+
+	_, _ = rw.body.Write(frame)
+	if rw.encoder != nil {
+		_ = rw.encoder.Close()
+	}
+	rw.Flush()
+}
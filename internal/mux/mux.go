@@ -0,0 +1,153 @@
+// Package mux serves the native gRPC, the gRPC-Web and the plain HTTP
+// requests on a single listener. The requests are routed by protocol and
+// content type: the HTTP/2 `application/grpc` requests go to the gRPC server,
+// the `application/grpc-web` ones are translated for it, and the others
+// go to the HTTP handler.
+package mux
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	grpcContentType = "application/grpc"
+
+	readHeaderTimeout = 10 * time.Second
+	drainPollInterval = 10 * time.Millisecond
+)
+
+type Options struct {
+	// GRPC serves the gRPC requests, usually a *grpc.Server
+	GRPC http.Handler
+
+	// HTTP serves the plain HTTP requests
+	HTTP http.Handler
+
+	// CORS allows the browsers of other origins to call the server
+	CORS CORSOptions
+
+	// TLSConfig serves TLS, the server is served in plaintext
+	// (HTTP/2 without TLS for gRPC) when nil
+	TLSConfig *tls.Config
+}
+
+// Server multiplexes the protocols on a listener
+type Server struct {
+	grpc      http.Handler
+	http      http.Handler
+	tlsConfig *tls.Config
+
+	httpSrv *http.Server
+
+	// the gRPC requests being served, which the http server
+	// does not track once the HTTP/2 connections are hijacked
+	inFlight atomic.Int64
+}
+
+// NewServer creates the multiplexing server
+func NewServer(opt Options) (*Server, error) {
+	s := &Server{
+		grpc:      opt.GRPC,
+		http:      opt.HTTP,
+		tlsConfig: opt.TLSConfig,
+	}
+
+	h2s := &http2.Server{}
+	s.httpSrv = &http.Server{
+		Handler:           h2c.NewHandler(s.handler(opt.CORS), h2s),
+		ReadHeaderTimeout: readHeaderTimeout,
+		TLSConfig:         opt.TLSConfig,
+	}
+
+	// the HTTP/2 connections, with or without TLS, are
+	// sent a GOAWAY when the http server shuts down
+	if err := http2.ConfigureServer(s.httpSrv, h2s); err != nil {
+		return nil, fmt.Errorf("http2.ConfigureServer: %v", err)
+	}
+
+	return s, nil
+}
+
+// routes the requests by protocol and content type
+func (s *Server) handler(cors CORSOptions) http.Handler {
+	web := withCORS(cors, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCWebRequest(r) {
+			s.serveGRPC(w, r, serveGRPCWeb)
+			return
+		}
+
+		s.http.ServeHTTP(w, r)
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCRequest(r) {
+			s.serveGRPC(w, r, func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+				h.ServeHTTP(w, r)
+			})
+			return
+		}
+
+		web.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) serveGRPC(w http.ResponseWriter, r *http.Request,
+	serve func(http.ResponseWriter, *http.Request, http.Handler)) {
+
+	s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+
+	serve(w, r, s.grpc)
+}
+
+func isGRPCRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	return r.ProtoMajor == 2 &&
+		strings.HasPrefix(contentType, grpcContentType) &&
+		!strings.HasPrefix(contentType, grpcWebContentType)
+}
+
+// Serve serves the requests on the listener, until the server is closed
+func (s *Server) Serve(lis net.Listener) error {
+	if s.tlsConfig != nil {
+		lis = tls.NewListener(lis, s.tlsConfig)
+	}
+
+	return s.httpSrv.Serve(lis)
+}
+
+// Shutdown stops accepting requests, then waits for the in-flight
+// requests until the context is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.httpSrv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("httpSrv.Shutdown: %v", err)
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for s.inFlight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// Close closes the listener and the connections
+func (s *Server) Close() error {
+	return s.httpSrv.Close()
+}
@@ -0,0 +1,163 @@
+package mux_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/mux"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// serves a health server and a plain HTTP route on a loopback listener
+func serve(t *testing.T, cors mux.CORSOptions) (string, *mux.Server) {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+
+	routes := http.NewServeMux()
+	routes.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	s, err := mux.NewServer(mux.Options{GRPC: grpcSrv, HTTP: routes, CORS: cors})
+	assert.Nil(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(func() {
+		_ = s.Close()
+		grpcSrv.Stop()
+	})
+
+	return lis.Addr().String(), s
+}
+
+func TestServer_grpc(t *testing.T) {
+
+	addr, _ := serve(t, mux.CORSOptions{})
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(),
+		&healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+}
+
+func TestServer_http(t *testing.T) {
+
+	addr, _ := serve(t, mux.CORSOptions{})
+
+	resp, err := http.Get("http://" + addr + "/hello")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestServer_grpcWeb(t *testing.T) {
+
+	addr, _ := serve(t, mux.CORSOptions{})
+
+	// an empty HealthCheckRequest message frame
+	frame := []byte{0, 0, 0, 0, 0}
+
+	resp, err := http.Post("http://"+addr+"/grpc.health.v1.Health/Check",
+		"application/grpc-web+proto", bytes.NewReader(frame))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/grpc-web+proto", resp.Header.Get("Content-Type"))
+
+	body, _ := io.ReadAll(resp.Body)
+
+	// the SERVING status message frame, then the trailer frame
+	assert.Equal(t, []byte{0, 0, 0, 0, 2, 8, 1}, body[:7])
+	assert.Equal(t, byte(0x80), body[7])
+	assert.Contains(t, string(body[12:]), "grpc-status: 0\r\n")
+}
+
+func TestServer_grpcWebText(t *testing.T) {
+
+	addr, _ := serve(t, mux.CORSOptions{})
+
+	frame := base64.StdEncoding.EncodeToString([]byte{0, 0, 0, 0, 0})
+
+	resp, err := http.Post("http://"+addr+"/grpc.health.v1.Health/Check",
+		"application/grpc-web-text", strings.NewReader(frame))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	encoded, _ := io.ReadAll(resp.Body)
+	body, err := base64.StdEncoding.DecodeString(string(encoded))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 2, 8, 1}, body[:7])
+	assert.Contains(t, string(body[12:]), "grpc-status: 0\r\n")
+}
+
+func TestServer_cors(t *testing.T) {
+
+	addr, _ := serve(t, mux.CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		ExposedHeaders: []string{"x-request-id"},
+	})
+
+	// preflight of an allowed origin
+	req, _ := http.NewRequest(http.MethodOptions, "http://"+addr+"/grpc.health.v1.Health/Check", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "content-type,x-grpc-web", resp.Header.Get("Access-Control-Allow-Headers"))
+
+	// request of an allowed origin
+	req, _ = http.NewRequest(http.MethodGet, "http://"+addr+"/hello", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, resp.Header.Get("Access-Control-Expose-Headers"), "x-request-id")
+
+	// request of another origin
+	req, _ = http.NewRequest(http.MethodGet, "http://"+addr+"/hello", nil)
+	req.Header.Set("Origin", "https://other.example.com")
+
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestServer_Shutdown(t *testing.T) {
+
+	addr, s := serve(t, mux.CORSOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, s.Shutdown(ctx))
+
+	_, err := http.Get("http://" + addr + "/hello")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,276 @@
+// Package playlist encodes the tracks as playlists, in the extended M3U,
+// the XSPF and the JSPF formats.
+//
+// The locations of a track are its preview URL and its spotify URL,
+// the M3U format keeping only the first one. The artwork and the album
+// are included in every format. The tracks without location are kept
+// in every format, as a comment in the M3U format.
+package playlist
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+)
+
+// Format is a playlist format
+type Format string
+
+const (
+	FormatM3U  Format = "m3u"
+	FormatXSPF Format = "xspf"
+	FormatJSPF Format = "jspf"
+)
+
+// Formats lists the playlist formats
+var Formats = []Format{FormatM3U, FormatXSPF, FormatJSPF}
+
+const xspfNamespace = "http://xspf.org/ns/0/"
+
+// ParseFormat parses the name of a format, FormatM3U when empty
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case "", FormatM3U, "m3u8":
+		return FormatM3U, nil
+	case FormatXSPF:
+		return FormatXSPF, nil
+	case FormatJSPF:
+		return FormatJSPF, nil
+	default:
+		return "", fmt.Errorf("unknown playlist format %q, expected m3u, xspf or jspf", name)
+	}
+}
+
+// ContentType returns the media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatXSPF:
+		return "application/xspf+xml"
+	case FormatJSPF:
+		return "application/json"
+	default:
+		return "audio/x-mpegurl"
+	}
+}
+
+// Playlist is a titled list of tracks
+type Playlist struct {
+	Title  string
+	Tracks []*pb.Track
+}
+
+// Encode writes the playlist in the format
+func Encode(w io.Writer, f Format, p Playlist) error {
+	switch f {
+	case FormatM3U:
+		return encodeM3U(w, p)
+	case FormatXSPF:
+		return encodeXSPF(w, p)
+	case FormatJSPF:
+		return encodeJSPF(w, p)
+	default:
+		return fmt.Errorf("unknown playlist format %q", f)
+	}
+}
+
+// lists the locations of the track, its preview first
+func locations(track *pb.Track) []string {
+	var out []string
+	if track.PreviewUrl != "" {
+		out = append(out, track.PreviewUrl)
+	}
+	if track.SpotifyUrl != "" {
+		out = append(out, track.SpotifyUrl)
+	}
+
+	return out
+}
+
+// CountWithoutLocation counts the tracks without location,
+// which the players cannot play
+func CountWithoutLocation(tracks []*pb.Track) int {
+	count := 0
+	for _, track := range tracks {
+		if len(locations(track)) == 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+func artistNames(track *pb.Track) string {
+	names := make([]string, 0, len(track.Artists))
+	for _, artist := range track.Artists {
+		names = append(names, artist.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// the spotify URI of the track
+func identifier(track *pb.Track) string {
+	if track.ID == "" {
+		return ""
+	}
+
+	return "spotify:track:" + track.ID
+}
+
+// removes the line breaks, which would end an M3U directive
+func m3uText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func encodeM3U(w io.Writer, p Playlist) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if p.Title != "" {
+		fmt.Fprintf(&b, "#PLAYLIST:%s\n", m3uText(p.Title))
+	}
+
+	for _, track := range p.Tracks {
+		title := track.Name
+		if artists := artistNames(track); artists != "" {
+			title = artists + " - " + title
+		}
+
+		// a track without location has no entry, only a comment
+		locationList := locations(track)
+		if len(locationList) == 0 {
+			fmt.Fprintf(&b, "# no location: %s", m3uText(title))
+			if id := identifier(track); id != "" {
+				fmt.Fprintf(&b, " (%s)", id)
+			}
+			b.WriteString("\n")
+			continue
+		}
+
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n", track.DurationMs/1000, m3uText(title))
+
+		if album := track.GetAlbum(); album != nil {
+			if album.Name != "" {
+				fmt.Fprintf(&b, "#EXTALB:%s\n", m3uText(album.Name))
+			}
+			if album.ImageUrl != "" {
+				fmt.Fprintf(&b, "#EXTIMG:%s\n", album.ImageUrl)
+			}
+		}
+
+		fmt.Fprintf(&b, "%s\n", locationList[0])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"playlist"`
+	Version   string      `xml:"version,attr"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title,omitempty"`
+	Tracks    []xspfTrack `xml:"trackList>track"`
+}
+
+// the elements follow the order of the XSPF schema
+type xspfTrack struct {
+	Locations  []string `xml:"location"`
+	Identifier string   `xml:"identifier,omitempty"`
+	Title      string   `xml:"title,omitempty"`
+	Creator    string   `xml:"creator,omitempty"`
+	Info       string   `xml:"info,omitempty"`
+	Image      string   `xml:"image,omitempty"`
+	Album      string   `xml:"album,omitempty"`
+	Duration   int32    `xml:"duration,omitempty"`
+}
+
+func encodeXSPF(w io.Writer, p Playlist) error {
+	doc := xspfPlaylist{
+		Version:   "1",
+		Namespace: xspfNamespace,
+		Title:     p.Title,
+		Tracks:    make([]xspfTrack, 0, len(p.Tracks)),
+	}
+	for _, track := range p.Tracks {
+		doc.Tracks = append(doc.Tracks, xspfTrack{
+			Locations:  locations(track),
+			Identifier: identifier(track),
+			Title:      track.Name,
+			Creator:    artistNames(track),
+			Info:       track.SpotifyUrl,
+			Image:      track.GetAlbum().GetImageUrl(),
+			Album:      track.GetAlbum().GetName(),
+			Duration:   track.DurationMs,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("xml.Encode: %v", err)
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type jspfDocument struct {
+	Playlist jspfPlaylist `json:"playlist"`
+}
+
+type jspfPlaylist struct {
+	Title  string      `json:"title,omitempty"`
+	Tracks []jspfTrack `json:"track"`
+}
+
+type jspfTrack struct {
+	Locations   []string `json:"location,omitempty"`
+	Identifiers []string `json:"identifier,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	Creator     string   `json:"creator,omitempty"`
+	Info        string   `json:"info,omitempty"`
+	Image       string   `json:"image,omitempty"`
+	Album       string   `json:"album,omitempty"`
+	Duration    int32    `json:"duration,omitempty"`
+}
+
+func encodeJSPF(w io.Writer, p Playlist) error {
+	doc := jspfDocument{Playlist: jspfPlaylist{
+		Title:  p.Title,
+		Tracks: make([]jspfTrack, 0, len(p.Tracks)),
+	}}
+	for _, track := range p.Tracks {
+		var identifiers []string
+		if id := identifier(track); id != "" {
+			identifiers = []string{id}
+		}
+
+		doc.Playlist.Tracks = append(doc.Playlist.Tracks, jspfTrack{
+			Locations:   locations(track),
+			Identifiers: identifiers,
+			Title:       track.Name,
+			Creator:     artistNames(track),
+			Info:        track.SpotifyUrl,
+			Image:       track.GetAlbum().GetImageUrl(),
+			Album:       track.GetAlbum().GetName(),
+			Duration:    track.DurationMs,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("json.Encode: %v", err)
+	}
+
+	return nil
+}
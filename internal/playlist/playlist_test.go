@@ -0,0 +1,138 @@
+package playlist_test
+
+import (
+	"bytes"
+	"testing"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/internal/playlist"
+	"github.com/stretchr/testify/assert"
+)
+
+var playlistGiven = playlist.Playlist{
+	Title: "Piano & more",
+	Tracks: []*pb.Track{{
+		ID:         "track-1",
+		Name:       "Gogol",
+		SpotifyUrl: "https://open.spotify.com/track/track-1",
+		PreviewUrl: "https://p.scdn.co/mp3-preview/1",
+		DurationMs: 187500,
+		Album:      &pb.Album{Name: "Solo Piano", ImageUrl: "https://i.scdn.co/image/1"},
+		Artists:    []*pb.Artist{{Name: "Chilly Gonzales"}},
+	}, {
+		ID:         "track-2",
+		Name:       "Dot",
+		SpotifyUrl: "https://open.spotify.com/track/track-2",
+		DurationMs: 90000,
+	}, {
+		ID:   "track-3",
+		Name: "No location",
+	}},
+}
+
+func TestParseFormat(t *testing.T) {
+
+	for name, formatExpected := range map[string]playlist.Format{
+		"":     playlist.FormatM3U,
+		"M3U8": playlist.FormatM3U,
+		"xspf": playlist.FormatXSPF,
+		"jspf": playlist.FormatJSPF,
+	} {
+		format, err := playlist.ParseFormat(name)
+		assert.Nil(t, err)
+		assert.Equal(t, formatExpected, format)
+	}
+
+	_, err := playlist.ParseFormat("pls")
+	assert.NotNil(t, err)
+}
+
+func TestEncode_m3u(t *testing.T) {
+
+	out := &bytes.Buffer{}
+	err := playlist.Encode(out, playlist.FormatM3U, playlistGiven)
+	assert.Nil(t, err)
+
+	assert.Equal(t, ""+
+		"#EXTM3U\n"+
+		"#PLAYLIST:Piano & more\n"+
+		"#EXTINF:187,Chilly Gonzales - Gogol\n"+
+		"#EXTALB:Solo Piano\n"+
+		"#EXTIMG:https://i.scdn.co/image/1\n"+
+		"https://p.scdn.co/mp3-preview/1\n"+
+		"#EXTINF:90,Dot\n"+
+		"https://open.spotify.com/track/track-2\n"+
+		"# no location: No location (spotify:track:track-3)\n", out.String())
+}
+
+func TestCountWithoutLocation(t *testing.T) {
+	assert.Equal(t, 1, playlist.CountWithoutLocation(playlistGiven.Tracks))
+	assert.Equal(t, 0, playlist.CountWithoutLocation(playlistGiven.Tracks[:2]))
+}
+
+func TestEncode_xspf(t *testing.T) {
+
+	out := &bytes.Buffer{}
+	err := playlist.Encode(out, playlist.FormatXSPF, playlistGiven)
+	assert.Nil(t, err)
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>Piano &amp; more</title>
+  <trackList>
+    <track>
+      <location>https://p.scdn.co/mp3-preview/1</location>
+      <location>https://open.spotify.com/track/track-1</location>
+      <identifier>spotify:track:track-1</identifier>
+      <title>Gogol</title>
+      <creator>Chilly Gonzales</creator>
+      <info>https://open.spotify.com/track/track-1</info>
+      <image>https://i.scdn.co/image/1</image>
+      <album>Solo Piano</album>
+      <duration>187500</duration>
+    </track>
+    <track>
+      <location>https://open.spotify.com/track/track-2</location>
+      <identifier>spotify:track:track-2</identifier>
+      <title>Dot</title>
+      <info>https://open.spotify.com/track/track-2</info>
+      <duration>90000</duration>
+    </track>
+    <track>
+      <identifier>spotify:track:track-3</identifier>
+      <title>No location</title>
+    </track>
+  </trackList>
+</playlist>
+`, out.String())
+}
+
+func TestEncode_jspf(t *testing.T) {
+
+	out := &bytes.Buffer{}
+	err := playlist.Encode(out, playlist.FormatJSPF, playlistGiven)
+	assert.Nil(t, err)
+
+	assert.JSONEq(t, `{"playlist": {
+		"title": "Piano & more",
+		"track": [{
+			"location": ["https://p.scdn.co/mp3-preview/1", "https://open.spotify.com/track/track-1"],
+			"identifier": ["spotify:track:track-1"],
+			"title": "Gogol",
+			"creator": "Chilly Gonzales",
+			"info": "https://open.spotify.com/track/track-1",
+			"image": "https://i.scdn.co/image/1",
+			"album": "Solo Piano",
+			"duration": 187500
+		}, {
+			"location": ["https://open.spotify.com/track/track-2"],
+			"identifier": ["spotify:track:track-2"],
+			"title": "Dot",
+			"info": "https://open.spotify.com/track/track-2",
+			"duration": 90000
+		}, {
+			"identifier": ["spotify:track:track-3"],
+			"title": "No location"
+		}]
+	}}`, out.String())
+}
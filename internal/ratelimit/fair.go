@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+)
+
+// FairSemaphore caps the number of in-flight calls. When the cap is
+// reached, the slots released are handed to the waiting callers in turn,
+// so that a caller with many waiting calls does not starve the others.
+type FairSemaphore struct {
+	capacity int
+
+	mu       sync.Mutex
+	inFlight int
+	// the waiting calls of each caller, in arrival order
+	waiters map[string][]chan struct{}
+	// the callers with waiting calls, in turn order
+	turns []string
+}
+
+// NewFairSemaphore creates the semaphore, nil when the capacity
+// is not positive
+func NewFairSemaphore(capacity int) *FairSemaphore {
+	if capacity <= 0 {
+		return nil
+	}
+
+	return &FairSemaphore{
+		capacity: capacity,
+		waiters:  make(map[string][]chan struct{}),
+		turns:    make([]string, 0),
+	}
+}
+
+// Acquire waits for a slot for the caller, or for the context to be done
+func (s *FairSemaphore) Acquire(ctx context.Context, caller string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	if s.inFlight < s.capacity && len(s.turns) == 0 {
+		s.inFlight++
+		s.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	if len(s.waiters[caller]) == 0 {
+		s.turns = append(s.turns, caller)
+	}
+	s.waiters[caller] = append(s.waiters[caller], ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		select {
+		case <-ready:
+			// the slot was handed meanwhile, give it back
+			s.release()
+		default:
+			s.removeWaiter(caller, ready)
+		}
+		return ctx.Err()
+	}
+}
+
+// Release frees the slot of a call
+func (s *FairSemaphore) Release() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.release()
+}
+
+// hands the slot to the first waiting call of the next caller in turn
+func (s *FairSemaphore) release() {
+	if len(s.turns) == 0 {
+		s.inFlight--
+		return
+	}
+
+	caller := s.turns[0]
+	s.turns = s.turns[1:]
+
+	waiters := s.waiters[caller]
+	close(waiters[0])
+	if len(waiters) > 1 {
+		s.waiters[caller] = waiters[1:]
+		// the caller waits for its next turn
+		s.turns = append(s.turns, caller)
+	} else {
+		delete(s.waiters, caller)
+	}
+}
+
+func (s *FairSemaphore) removeWaiter(caller string, ready chan struct{}) {
+	waiters := s.waiters[caller]
+	for i, waiter := range waiters {
+		if waiter == ready {
+			waiters = append(waiters[:i:i], waiters[i+1:]...)
+			break
+		}
+	}
+
+	if len(waiters) > 0 {
+		s.waiters[caller] = waiters
+		return
+	}
+
+	delete(s.waiters, caller)
+	for i, turn := range s.turns {
+		if turn == caller {
+			s.turns = append(s.turns[:i:i], s.turns[i+1:]...)
+			break
+		}
+	}
+}
+
+// InFlight returns the number of in-flight calls
+func (s *FairSemaphore) InFlight() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inFlight
+}
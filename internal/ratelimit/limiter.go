@@ -0,0 +1,217 @@
+// Package ratelimit protects the shared spotify rate limit from a noisy
+// caller: each caller gets its own token bucket, and the in-flight
+// upstream calls are capped and shared fairly across the callers.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/auth"
+	"github.com/planetfall/musicresearcher/internal/certs"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// the caller of the requests without key nor peer, such as
+	// the readiness checks
+	internalCaller = "internal"
+
+	// the token buckets idle for this long are forgotten
+	bucketIdleTimeout = 10 * time.Minute
+	sweepInterval     = time.Minute
+
+	// the health checks are never limited, for the probes
+	healthServicePrefix = "/grpc.health.v1.Health/"
+)
+
+type callerContextKey struct{}
+
+// WithCaller stores the caller identity in the context
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+// Caller returns the caller identity stored in the context,
+// or the internal caller
+func Caller(ctx context.Context) string {
+	if caller, check := ctx.Value(callerContextKey{}).(string); check && caller != "" {
+		return caller
+	}
+
+	return internalCaller
+}
+
+// identifies the caller by its API key, its client certificate,
+// or by its peer address as fallback
+func callerFromRequest(ctx context.Context) string {
+	if keyID := auth.KeyID(ctx); keyID != "" {
+		return "key:" + keyID
+	}
+
+	if identity := certs.Identity(ctx); identity != "" {
+		return "cert:" + identity
+	}
+
+	if p, check := peer.FromContext(ctx); check && p.Addr != nil {
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		return "peer:" + addr
+	}
+
+	return internalCaller
+}
+
+// Options configures the token buckets of the callers
+type Options struct {
+	// Rate is the number of requests per second refilled in each bucket,
+	// the requests are not limited when not positive
+	Rate float64
+	// Burst is the capacity of each bucket
+	Burst int
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter holds a token bucket per caller
+type Limiter struct {
+	opt Options
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func (opt Options) withDefaults() Options {
+	if opt.Burst <= 0 {
+		opt.Burst = 1
+	}
+
+	return opt
+}
+
+// NewLimiter creates the limiter
+func NewLimiter(opt Options) *Limiter {
+	return &Limiter{
+		opt:       opt.withDefaults(),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetOptions replaces the rate and the burst of every caller
+func (l *Limiter) SetOptions(opt Options) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.opt = opt.withDefaults()
+	for _, b := range l.buckets {
+		b.limiter.SetLimit(rate.Limit(l.opt.Rate))
+		b.limiter.SetBurst(l.opt.Burst)
+	}
+}
+
+// forgets the idle buckets, which are full anyway
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for caller, b := range l.buckets {
+		if now.Sub(b.lastSeen) > bucketIdleTimeout {
+			delete(l.buckets, caller)
+		}
+	}
+}
+
+// allow takes a token from the bucket of the caller, returning
+// the delay before the next token otherwise
+func (l *Limiter) allow(caller string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the requests are not limited
+	if l.opt.Rate <= 0 {
+		return 0, true
+	}
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, check := l.buckets[caller]
+	if !check {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(l.opt.Rate), l.opt.Burst)}
+		l.buckets[caller] = b
+	}
+	b.lastSeen = now
+
+	if b.limiter.AllowN(now, 1) {
+		return 0, true
+	}
+
+	// the reservation is only used to know the delay
+	reservation := b.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	reservation.CancelAt(now)
+
+	return delay, false
+}
+
+// rateLimitedError builds the ResourceExhausted status,
+// telling the caller when to retry
+func rateLimitedError(caller string, delay time.Duration) error {
+	st := status.New(codes.ResourceExhausted,
+		fmt.Sprintf("rate limit exceeded, retry in %s", delay.Round(time.Millisecond)))
+
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(delay),
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// UnaryServerInterceptor identifies the caller of the requests,
+// and rejects the ones exceeding its rate with ResourceExhausted.
+// It must run after the authentication, to identify the callers by key,
+// and gives back the quota of the key on the requests it rejects.
+func (l *Limiter) UnaryServerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+			return handler(ctx, req)
+		}
+
+		caller := callerFromRequest(ctx)
+		if delay, check := l.allow(caller); !check {
+			logger.WarnContext(ctx, "request rate limited",
+				"method", info.FullMethod, "caller", caller, "retry_in", delay)
+			// the rejected request does not count against the key quota
+			auth.Refund(ctx)
+			return nil, rateLimitedError(caller, delay)
+		}
+
+		return handler(WithCaller(ctx, caller), req)
+	}
+}
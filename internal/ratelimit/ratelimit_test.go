@@ -0,0 +1,172 @@
+package ratelimit_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/auth"
+	"github.com/planetfall/musicresearcher/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func call(interceptor grpc.UnaryServerInterceptor, addr string) (string, error) {
+	ctx := peer.NewContext(context.Background(),
+		&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 1234}})
+
+	caller := ""
+	_, err := interceptor(ctx, nil,
+		&grpc.UnaryServerInfo{FullMethod: "/musicresearcher.MusicResearcher/Search"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			caller = ratelimit.Caller(ctx)
+			return nil, nil
+		})
+
+	return caller, err
+}
+
+func TestLimiter(t *testing.T) {
+
+	limiter := ratelimit.NewLimiter(ratelimit.Options{Rate: 0.1, Burst: 2})
+	interceptor := limiter.UnaryServerInterceptor(
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	caller, err := call(interceptor, "10.0.0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, "peer:10.0.0.1", caller)
+	_, err = call(interceptor, "10.0.0.1")
+	assert.Nil(t, err)
+
+	// the burst is exhausted
+	_, err = call(interceptor, "10.0.0.1")
+	st := status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Len(t, st.Details(), 1)
+	retryInfo, check := st.Details()[0].(*errdetails.RetryInfo)
+	assert.True(t, check)
+	assert.Greater(t, retryInfo.RetryDelay.AsDuration(), time.Duration(0))
+
+	// the other callers are not affected
+	_, err = call(interceptor, "10.0.0.2")
+	assert.Nil(t, err)
+}
+
+func TestLimiter_disabled(t *testing.T) {
+
+	limiter := ratelimit.NewLimiter(ratelimit.Options{})
+
+	interceptor := limiter.UnaryServerInterceptor(
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for i := 0; i < 10; i++ {
+		caller, err := call(interceptor, "10.0.0.1")
+		assert.Nil(t, err)
+		assert.Equal(t, "peer:10.0.0.1", caller)
+	}
+}
+
+func TestLimiter_SetOptions(t *testing.T) {
+
+	limiter := ratelimit.NewLimiter(ratelimit.Options{Rate: 0.1, Burst: 1})
+	interceptor := limiter.UnaryServerInterceptor(
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	_, err := call(interceptor, "10.0.0.1")
+	assert.Nil(t, err)
+	_, err = call(interceptor, "10.0.0.1")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// the limit is lifted
+	limiter.SetOptions(ratelimit.Options{})
+	_, err = call(interceptor, "10.0.0.1")
+	assert.Nil(t, err)
+}
+
+func TestLimiter_withQuota(t *testing.T) {
+
+	store, err := auth.NewStore([]auth.Key{{
+		ID: "search-1", Key: "search-key", Scopes: []string{auth.ScopeSearch}, DailyQuota: 2,
+	}})
+	assert.Nil(t, err)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	authInterceptor := auth.UnaryServerInterceptor(store, nil, logger)
+	limiter := ratelimit.NewLimiter(ratelimit.Options{Rate: 0.1, Burst: 1})
+	limiterInterceptor := limiter.UnaryServerInterceptor(logger)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/musicresearcher.MusicResearcher/Search"}
+	callWithKey := func() error {
+		ctx := metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(auth.APIKeyMetadataKey, "search-key"))
+		_, err := authInterceptor(ctx, nil, info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return limiterInterceptor(ctx, req, info,
+					func(context.Context, interface{}) (interface{}, error) {
+						return nil, nil
+					})
+			})
+		return err
+	}
+
+	assert.Nil(t, callWithKey())
+	err = callWithKey()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "rate limit exceeded")
+
+	// the rate limited call left the quota unchanged, one request is left
+	limiter.SetOptions(ratelimit.Options{})
+	assert.Nil(t, callWithKey())
+	err = callWithKey()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "daily quota")
+}
+
+func TestFairSemaphore(t *testing.T) {
+
+	sem := ratelimit.NewFairSemaphore(1)
+	ctx := context.Background()
+	assert.Nil(t, sem.Acquire(ctx, "noisy"))
+
+	// the noisy caller queues many calls before the quiet one
+	order := make(chan string, 4)
+	for _, caller := range []string{"noisy", "noisy", "noisy", "quiet"} {
+		caller := caller
+		go func() {
+			if err := sem.Acquire(ctx, caller); err == nil {
+				order <- caller
+			}
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sem.Release()
+	assert.Equal(t, "noisy", <-order)
+	sem.Release()
+	assert.Equal(t, "quiet", <-order)
+	sem.Release()
+	assert.Equal(t, "noisy", <-order)
+	sem.Release()
+	assert.Equal(t, "noisy", <-order)
+	assert.Equal(t, 1, sem.InFlight())
+}
+
+func TestFairSemaphore_withCanceledContext(t *testing.T) {
+
+	sem := ratelimit.NewFairSemaphore(1)
+	assert.Nil(t, sem.Acquire(context.Background(), "caller"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, sem.Acquire(ctx, "caller"), context.DeadlineExceeded)
+
+	sem.Release()
+	assert.Equal(t, 0, sem.InFlight())
+}
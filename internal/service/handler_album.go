@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Service) GetAlbum(ctx context.Context, params *pb.Parameters) (*pb.Results, error) {
+
+	if params.Query == "" {
+		return nil, status.Error(codes.InvalidArgument, "the album ID is required")
+	}
+
+	albumList, err := s.mySpotify.GetAlbums(ctx, []string{params.Query})
+	if err != nil {
+		s.raise(ctx,
+			fmt.Sprintf("failed to get album with params: %v", params),
+			err)
+		return nil, err
+	}
+	if len(albumList) == 0 || albumList[0] == nil {
+		return nil, status.Errorf(codes.NotFound, "album %s not found", params.Query)
+	}
+	album := albumList[0]
+
+	artistList, err := s.mySpotify.GetArtists(ctx, album.ArtistIDs)
+	if err != nil {
+		s.raise(ctx,
+			fmt.Sprintf("failed to get album artists with params: %v", params),
+			err)
+		return nil, err
+	}
+
+	trackList, err := s.mySpotify.GetTracks(ctx, album.TrackIDs)
+	if err != nil {
+		s.raise(ctx,
+			fmt.Sprintf("failed to get album tracks with params: %v", params),
+			err)
+		return nil, err
+	}
+
+	return &pb.Results{
+		Albums:  []*pb.Album{album.Album},
+		Artists: compact(artistList),
+		Tracks:  compact(trackList),
+	}, nil
+}
+
+// removes the entities not found
+func compact[T any](list []*T) []*T {
+	out := make([]*T, 0, len(list))
+	for _, item := range list {
+		if item != nil {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Service) GetArtist(ctx context.Context, params *pb.Parameters) (*pb.Results, error) {
+
+	if params.Query == "" {
+		return nil, status.Error(codes.InvalidArgument, "the artist ID is required")
+	}
+
+	artistList, err := s.mySpotify.GetArtists(ctx, []string{params.Query})
+	if err != nil {
+		s.raise(ctx,
+			fmt.Sprintf("failed to get artist with params: %v", params),
+			err)
+		return nil, err
+	}
+	if len(artistList) == 0 || artistList[0] == nil {
+		return nil, status.Errorf(codes.NotFound, "artist %s not found", params.Query)
+	}
+
+	albumList, err := s.mySpotify.GetArtistAlbums(ctx, params.Query, int(params.Limit))
+	if err != nil {
+		s.raise(ctx,
+			fmt.Sprintf("failed to get artist albums with params: %v", params),
+			err)
+		return nil, err
+	}
+
+	return &pb.Results{
+		Albums:  albumList,
+		Artists: artistList[:1],
+		Tracks:  nil,
+	}, nil
+}
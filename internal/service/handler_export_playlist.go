@@ -0,0 +1,115 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/internal/playlist"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// the maximum number of tracks of a playlist given by IDs
+	maxPlaylistTracks = 500
+
+	defaultPlaylistTitle = "musicresearcher"
+)
+
+// returns the track IDs of the x-track-ids metadata,
+// given as spotify IDs, URIs or URLs separated by commas or spaces
+func getTrackIDs(ctx context.Context) ([]string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var ids []string
+	for _, value := range md.Get(trackIDsMetadataKey) {
+		for _, ref := range strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == ' '
+		}) {
+			refType, id, err := parseSpotifyRef(ref)
+			if err != nil {
+				return nil, err
+			}
+			if refType != pb.Type_TRACK {
+				return nil, fmt.Errorf("%q is not a track", ref)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) > maxPlaylistTracks {
+		return nil, fmt.Errorf("too many tracks, %d at most", maxPlaylistTracks)
+	}
+
+	return ids, nil
+}
+
+func (s *Service) ExportPlaylist(ctx context.Context, params *pb.Parameters) (*httpbody.HttpBody, error) {
+
+	format, err := playlist.ParseFormat(getMetadataValue(ctx, playlistFormatKey))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ids, err := getTrackIDs(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid %s metadata: %v", trackIDsMetadataKey, err)
+	}
+
+	title := getMetadataValue(ctx, playlistTitleKey)
+
+	var trackList []*pb.Track
+	switch {
+	case len(ids) > 0:
+		trackList, err = s.mySpotify.GetTracks(ctx, ids)
+		if err != nil {
+			s.raise(ctx,
+				fmt.Sprintf("failed to get playlist tracks with params: %v", params),
+				err)
+			return nil, err
+		}
+		trackList = compact(trackList)
+	case params.Query != "":
+		results, err := s.Search(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		trackList = results.Tracks
+		if title == "" {
+			title = params.Query
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument,
+			"either the %s metadata or the query is required", trackIDsMetadataKey)
+	}
+
+	if title == "" {
+		title = defaultPlaylistTitle
+	}
+
+	// the players skip the tracks without location, as a partial result
+	if count := playlist.CountWithoutLocation(trackList); count > 0 {
+		setTrailer(ctx, metadata.Pairs(warningKey,
+			fmt.Sprintf("%d of the %d tracks have no location, the players skip them",
+				count, len(trackList))))
+	}
+
+	out := &bytes.Buffer{}
+	if err := playlist.Encode(out, format, playlist.Playlist{
+		Title:  title,
+		Tracks: trackList,
+	}); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode the playlist: %v", err)
+	}
+
+	return &httpbody.HttpBody{
+		ContentType: format.ContentType(),
+		Data:        out.Bytes(),
+	}, nil
+}
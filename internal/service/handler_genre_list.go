@@ -10,9 +10,9 @@ func (s *Service) GetGenreList(ctx context.Context, empty *pb.Empty) (*pb.GenreL
 
 	genreList, err := s.mySpotify.GetGenreList(ctx)
 	if err != nil {
-		s.srv.Raise(
+		s.raise(ctx,
 			"failed to get genre list from spotify",
-			err, nil)
+			err)
 		return nil, err
 	}
 
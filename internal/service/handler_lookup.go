@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the maximum number of references of a lookup
+const maxLookupRefs = 100
+
+// parses a spotify reference: an ID, a `spotify:<type>:<id>` URI,
+// or an `https://open.spotify.com/<type>/<id>` URL. The IDs without
+// type are tracks.
+func parseSpotifyRef(ref string) (pb.Type, string, error) {
+	typeName, id := "track", ref
+
+	switch {
+	case strings.HasPrefix(ref, "spotify:"):
+		parts := strings.Split(ref, ":")
+		if len(parts) != 3 {
+			return pb.Type_UNKNOWN, "", fmt.Errorf("invalid spotify URI %q", ref)
+		}
+		typeName, id = parts[1], parts[2]
+	case strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://"):
+		u, err := url.Parse(ref)
+		if err != nil {
+			return pb.Type_UNKNOWN, "", fmt.Errorf("invalid spotify URL %q: %v", ref, err)
+		}
+		// the path may start with a locale, e.g. /intl-fr/track/<id>
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) < 2 {
+			return pb.Type_UNKNOWN, "", fmt.Errorf("invalid spotify URL %q", ref)
+		}
+		typeName, id = parts[len(parts)-2], parts[len(parts)-1]
+	}
+
+	if id == "" {
+		return pb.Type_UNKNOWN, "", fmt.Errorf("no ID in %q", ref)
+	}
+
+	switch typeName {
+	case "track":
+		return pb.Type_TRACK, id, nil
+	case "album":
+		return pb.Type_ALBUM, id, nil
+	case "artist":
+		return pb.Type_ARTIST, id, nil
+	default:
+		return pb.Type_UNKNOWN, "", fmt.Errorf("unsupported type %q in %q", typeName, ref)
+	}
+}
+
+func (s *Service) Lookup(ctx context.Context, params *pb.Parameters) (*pb.Results, error) {
+
+	refList := strings.FieldsFunc(params.Query, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	if len(refList) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no reference to look up")
+	}
+	if len(refList) > maxLookupRefs {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"too many references, %d at most", maxLookupRefs)
+	}
+
+	idsByType := make(map[pb.Type][]string)
+	for _, ref := range refList {
+		refType, id, err := parseSpotifyRef(ref)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		idsByType[refType] = append(idsByType[refType], id)
+	}
+
+	results := &pb.Results{}
+
+	if ids := idsByType[pb.Type_TRACK]; len(ids) > 0 {
+		trackList, err := s.mySpotify.GetTracks(ctx, ids)
+		if err != nil {
+			s.raise(ctx, fmt.Sprintf("failed to look tracks up with params: %v", params), err)
+			return nil, err
+		}
+		results.Tracks = compact(trackList)
+	}
+
+	if ids := idsByType[pb.Type_ALBUM]; len(ids) > 0 {
+		albumList, err := s.mySpotify.GetAlbums(ctx, ids)
+		if err != nil {
+			s.raise(ctx, fmt.Sprintf("failed to look albums up with params: %v", params), err)
+			return nil, err
+		}
+		for _, album := range albumList {
+			if album != nil {
+				results.Albums = append(results.Albums, album.Album)
+			}
+		}
+	}
+
+	if ids := idsByType[pb.Type_ARTIST]; len(ids) > 0 {
+		artistList, err := s.mySpotify.GetArtists(ctx, ids)
+		if err != nil {
+			s.raise(ctx, fmt.Sprintf("failed to look artists up with params: %v", params), err)
+			return nil, err
+		}
+		results.Artists = compact(artistList)
+	}
+
+	return results, nil
+}
@@ -5,25 +5,77 @@ import (
 	"fmt"
 
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/tracing"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-func (s *Service) Search(ctx context.Context, params *pb.Parameters) (*pb.Results, error) {
+func (s *Service) Search(ctx context.Context, params *pb.Parameters) (_ *pb.Results, err error) {
 
-	trackList, err := s.mySpotify.Search(ctx,
-		params.Query,
-		params.GenreFilters,
-		int(params.Limit),
-	)
+	ctx, span := tracing.Start(ctx, "Service.Search")
+	defer func() { tracing.End(span, err) }()
+
+	dedup, err := myspotify.ParseDedupMode(getMetadataValue(ctx, dedupMetadataKey))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid %s metadata: %v", dedupMetadataKey, err)
+	}
+
+	explain, err := getMetadataFlag(ctx, explainMetadataKey)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	rerank, err := getMetadataFlag(ctx, rerankMetadataKey)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	offset, err := getMetadataInt(ctx, offsetMetadataKey)
 	if err != nil {
-		s.srv.Raise(
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	result, err := s.mySpotify.SearchWithOptions(ctx, myspotify.SearchOptions{
+		Query:        params.Query,
+		GenreFilters: params.GenreFilters,
+		Limit:        int(params.Limit),
+		Offset:       offset,
+		Dedup:        dedup,
+		Explain:      explain,
+		Rerank:       rerank,
+	})
+	if err != nil {
+		s.raise(ctx,
 			fmt.Sprintf("failed to search spotify with params: %v", params),
-			err, nil)
+			err)
+		// the deadline of the request expired before any result
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
 		return nil, err
 	}
 
+	trailer := metadata.Pairs(effectiveQueryKey, result.EffectiveQuery)
+	if len(result.Alternates) > 0 {
+		trailer.Set(alternatesMetadataKey, formatAlternates(result.Alternates)...)
+	}
+	if result.Relaxation != "" {
+		trailer.Set(relaxationKey, result.Relaxation)
+	}
+	if len(result.Warnings) > 0 {
+		trailer.Set(warningKey, result.Warnings...)
+	}
+	if explain {
+		trailer.Set(explainMetadataKey, formatScores(result.Scores)...)
+	}
+	setTrailer(ctx, trailer)
+
 	return &pb.Results{
 		Albums:  nil,
 		Artists: nil,
-		Tracks:  trackList,
+		Tracks:  result.Tracks,
 	}, nil
 }
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+)
+
+func (s *Service) Suggest(ctx context.Context, params *pb.Parameters) (*pb.Results, error) {
+
+	results, err := s.mySpotify.Suggest(ctx, params.Query, int(params.Limit))
+	if err != nil {
+		s.raise(ctx,
+			fmt.Sprintf("failed to suggest with params: %v", params),
+			err)
+		return nil, err
+	}
+
+	return results, nil
+}
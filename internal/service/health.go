@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/pkg/extension"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	readinessCheckInterval = 30 * time.Second
+	readinessCheckTimeout  = 10 * time.Second
+)
+
+// the services whose readiness depends on spotify
+var readinessServiceNames = []string{
+	pb.MusicResearcher_ServiceDesc.ServiceName,
+	extension.MusicResearcherExtension_ServiceDesc.ServiceName,
+}
+
+func newHealthServer() *health.Server {
+	healthSrv := health.NewServer()
+
+	// not alive until the listener is up, not ready until spotify is reachable
+	healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	for _, name := range readinessServiceNames {
+		healthSrv.SetServingStatus(name, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+
+	return healthSrv
+}
+
+// checks the readiness of the services, i.e. if a spotify token
+// can be obtained and the genre seed list loaded
+func (s *Service) checkReadiness(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	servingStatus := healthpb.HealthCheckResponse_SERVING
+	if err := s.mySpotify.CheckReadiness(ctx); err != nil {
+		s.logger.WarnContext(ctx, "readiness check failed", "error", err)
+		servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	for _, name := range readinessServiceNames {
+		s.healthSrv.SetServingStatus(name, servingStatus)
+	}
+}
+
+// runs the readiness checks periodically, until the context is done
+func (s *Service) watchReadiness(ctx context.Context) {
+	ticker := time.NewTicker(readinessCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkReadiness(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
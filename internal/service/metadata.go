@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// The search options not carried by the pb.Parameters message
+// are read from the request metadata, and the search details not carried
+// by the pb.Results message are sent back in the response trailer.
+const (
+	dedupMetadataKey      = "x-dedup"
+	explainMetadataKey    = "x-explain"
+	rerankMetadataKey     = "x-rerank"
+	offsetMetadataKey     = "x-offset"
+	trackIDsMetadataKey   = "x-track-ids"
+	playlistFormatKey     = "x-playlist-format"
+	playlistTitleKey      = "x-playlist-title"
+	alternatesMetadataKey = "x-dedup-alternates"
+	effectiveQueryKey     = "x-effective-query"
+	relaxationKey         = "x-relaxation"
+	warningKey            = "x-warning"
+)
+
+// ResponseMetadataKeys are the keys of the search details
+// sent back in the response trailer
+var ResponseMetadataKeys = []string{
+	alternatesMetadataKey, effectiveQueryKey, relaxationKey,
+	explainMetadataKey, warningKey,
+}
+
+// returns the first value of the given key in the request metadata
+func getMetadataValue(ctx context.Context, key string) string {
+	md, check := metadata.FromIncomingContext(ctx)
+	if !check {
+		return ""
+	}
+
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// reads a boolean flag from the request metadata, false when not set
+func getMetadataFlag(ctx context.Context, key string) (bool, error) {
+	value := getMetadataValue(ctx, key)
+	if value == "" {
+		return false, nil
+	}
+
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s metadata: %v", key, err)
+	}
+
+	return flag, nil
+}
+
+// reads a non-negative integer from the request metadata, 0 when not set
+func getMetadataInt(ctx context.Context, key string) (int, error) {
+	value := getMetadataValue(ctx, key)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s metadata: %q is not a non-negative integer", key, value)
+	}
+
+	return n, nil
+}
+
+// formats the score breakdowns as json entries
+func formatScores(scoreList []myspotify.ScoreBreakdown) []string {
+	out := make([]string, 0, len(scoreList))
+	for _, score := range scoreList {
+		entry, err := json.Marshal(score)
+		if err != nil {
+			continue
+		}
+		out = append(out, string(entry))
+	}
+
+	return out
+}
+
+// formats the alternates as `canonicalID=altID1,altID2` entries
+func formatAlternates(alternates map[string][]string) []string {
+	out := make([]string, 0, len(alternates))
+	for canonicalId, alternateIdList := range alternates {
+		out = append(out, fmt.Sprintf("%s=%s",
+			canonicalId, strings.Join(alternateIdList, ",")))
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// sets the response trailer, ignoring the calls made outside of
+// a grpc stream (i.e. when the handler is called directly)
+func setTrailer(ctx context.Context, md metadata.MD) {
+	if len(md) == 0 || grpc.ServerTransportStreamFromContext(ctx) == nil {
+		return
+	}
+
+	_ = grpc.SetTrailer(ctx, md)
+}
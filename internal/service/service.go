@@ -1,68 +1,223 @@
 package service
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net"
-	"os"
-	"os/signal"
-	"syscall"
+	"time"
 
 	"github.com/planetfall/framework/pkg/server"
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/internal/metrics"
+	"github.com/planetfall/musicresearcher/internal/ratelimit"
 	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/pkg/extension"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type Service struct {
 	pb.UnimplementedMusicResearcherServer
-	grpcSrv *grpc.Server
+	extension.UnimplementedMusicResearcherExtensionServer
+	grpcSrv   *grpc.Server
+	healthSrv *health.Server
 
-	srv *server.Server
+	srv    *server.Server
+	logger *slog.Logger
 
 	mySpotify myspotify.MySpotify
 }
 
-func NewService(
-	grpcSrv *grpc.Server,
-	srv *server.Server,
+// Options configures the service
+type Options struct {
+	// GRPCServer is the server the services are registered on
+	GRPCServer *grpc.Server
 
-	spotifyClientId string,
-	spotifyClientSecret string,
-) *Service {
+	// Reporter reports the errors to the cloud error reporting,
+	// the errors are only logged when nil
+	Reporter *server.Server
 
-	mySpotify := myspotify.NewMySpotify(myspotify.MySpotifyOptions{
-		ClientId:     spotifyClientId,
-		ClientSecret: spotifyClientSecret,
-		BaseLogger:   srv.Logger,
+	Logger  *slog.Logger
+	Metrics *metrics.Metrics
+
+	// Upstream caps the in-flight spotify calls, unlimited when nil
+	Upstream *ratelimit.FairSemaphore
+
+	// Spotify is the spotify client, created from
+	// the credentials when not provided
+	Spotify             myspotify.MySpotify
+	SpotifyClientId     string
+	SpotifyClientSecret string
+	SpotifySettings     *myspotify.Settings
+}
+
+func (opt Options) getLogger() *slog.Logger {
+	if opt.Logger == nil {
+		return slog.Default()
+	}
+
+	return opt.Logger
+}
+
+func (opt Options) getSpotify() myspotify.MySpotify {
+	if opt.Spotify != nil {
+		return opt.Spotify
+	}
+
+	return myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:     opt.SpotifyClientId,
+		ClientSecret: opt.SpotifyClientSecret,
+		Logger:       opt.getLogger(),
+		Metrics:      opt.Metrics,
+		Upstream:     opt.Upstream,
+		Settings:     opt.SpotifySettings,
 	})
+}
+
+func NewService(opt Options) *Service {
 
 	newService := &Service{
-		grpcSrv: grpcSrv,
-		srv:     srv,
+		grpcSrv:   opt.GRPCServer,
+		healthSrv: newHealthServer(),
+		srv:       opt.Reporter,
+		logger:    opt.getLogger().With("component", "service"),
 
-		mySpotify: mySpotify,
+		mySpotify: opt.getSpotify(),
 	}
 
-	pb.RegisterMusicResearcherServer(grpcSrv, newService)
+	pb.RegisterMusicResearcherServer(opt.GRPCServer, newService)
+	extension.RegisterMusicResearcherExtensionServer(opt.GRPCServer, newService)
+	healthpb.RegisterHealthServer(opt.GRPCServer, newService.healthSrv)
 
 	return newService
 }
 
-func (s *Service) Start(lis net.Listener) error {
+// Spotify returns the spotify client of the service
+func (s *Service) Spotify() myspotify.MySpotify {
+	return s.mySpotify
+}
+
+// raise logs the error with the request context
+// and reports it using the server error reporting
+func (s *Service) raise(ctx context.Context, message string, err error) {
+	s.logger.ErrorContext(ctx, message, "error", err)
+	if s.srv != nil {
+		s.srv.Raise(message, err, nil)
+	}
+}
+
+// Transport serves the gRPC server along with other protocols,
+// multiplexed on the listener
+type Transport interface {
+	Serve(lis net.Listener) error
+
+	// Shutdown stops accepting requests, then waits for
+	// the in-flight requests until the context is done
+	Shutdown(ctx context.Context) error
+
+	Close() error
+}
+
+// Serve serves the requests on the listener until the context is done,
+// then drains the in-flight requests. The requests still running after
+// the drain timeout are aborted, the drain being unbounded when the
+// timeout is not positive. The ready callback, if any, is called once
+// the service is alive.
+func (s *Service) Serve(ctx context.Context, lis net.Listener,
+	drainTimeout time.Duration, onReady func()) error {
+
+	return s.ServeTransport(ctx, lis, nil, drainTimeout, onReady)
+}
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+// ServeTransport serves as Serve, through the transport
+// when not nil, the gRPC server itself otherwise
+func (s *Service) ServeTransport(ctx context.Context, lis net.Listener,
+	transport Transport, drainTimeout time.Duration, onReady func()) error {
 
+	serveErr := make(chan error, 1)
 	go func() {
-		if err := s.grpcSrv.Serve(lis); err != nil {
-			log.Fatalf("grpc.Serve: %v", err)
+		if transport != nil {
+			serveErr <- transport.Serve(lis)
+			return
 		}
+		serveErr <- s.grpcSrv.Serve(lis)
 	}()
 
-	<-done
+	// the listener is up, the service is alive
+	s.healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	readinessCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.watchReadiness(readinessCtx)
+
+	if onReady != nil {
+		onReady()
+	}
 
-	defer s.srv.Close()
-	s.grpcSrv.GracefulStop()
+	select {
+	case err := <-serveErr:
+		s.healthSrv.Shutdown()
+		return fmt.Errorf("Serve: %v", err)
+	case <-ctx.Done():
+	}
+
+	// not serving anymore, so that the load balancers drain the service
+	cancel()
+	s.healthSrv.Shutdown()
+	if transport != nil {
+		s.stopTransport(transport, drainTimeout)
+	} else {
+		s.stop(drainTimeout)
+	}
 
 	return nil
 }
+
+// stops the transport gracefully, forcing it after the drain timeout.
+// The gRPC server cannot drain the requests served through a transport,
+// it is stopped once they are done.
+func (s *Service) stopTransport(transport Transport, drainTimeout time.Duration) {
+	ctx := context.Background()
+	if drainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, drainTimeout)
+		defer cancel()
+	}
+
+	if err := transport.Shutdown(ctx); err != nil {
+		s.logger.Warn("drain timeout exceeded, aborting the in-flight requests",
+			"drain_timeout", drainTimeout, "error", err)
+	}
+	if err := transport.Close(); err != nil {
+		s.logger.Error("transport.Close failed", "error", err)
+	}
+	s.grpcSrv.Stop()
+}
+
+// stops the server gracefully, forcing it after the drain timeout
+func (s *Service) stop(drainTimeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+
+	if drainTimeout <= 0 {
+		<-stopped
+		return
+	}
+
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.logger.Warn("drain timeout exceeded, aborting the in-flight requests",
+			"drain_timeout", drainTimeout)
+		s.grpcSrv.Stop()
+		<-stopped
+	}
+}
@@ -0,0 +1,80 @@
+package myspotify
+
+import (
+	"context"
+	"time"
+)
+
+// StageBudget splits the remaining time of a search request across
+// its stages: the search call, the paging and the artist enrichment.
+// Each stage gets its share of the time left when it starts,
+// the time unused by a stage being left to the next ones.
+type StageBudget struct {
+	Search     float64
+	Paging     float64
+	Enrichment float64
+
+	// Reserve is the time kept to build and send the response
+	Reserve time.Duration
+}
+
+// DefaultStageBudget gives most of the time to the enrichment,
+// which makes a call per distinct artist
+var DefaultStageBudget = StageBudget{
+	Search:     0.3,
+	Paging:     0.2,
+	Enrichment: 0.5,
+	Reserve:    100 * time.Millisecond,
+}
+
+func (b StageBudget) searchShare() float64 {
+	return share(b.Search, b.Search+b.Paging+b.Enrichment)
+}
+
+func (b StageBudget) pagingShare() float64 {
+	return share(b.Paging, b.Paging+b.Enrichment)
+}
+
+func share(stage float64, total float64) float64 {
+	if total <= 0 {
+		return 1
+	}
+
+	return stage / total
+}
+
+// remaining returns the time left for the stages, false when
+// the request has no deadline
+func (b StageBudget) remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, check := ctx.Deadline()
+	if !check {
+		return 0, false
+	}
+
+	return time.Until(deadline) - b.Reserve, true
+}
+
+// exhausted checks if no time is left for a stage
+func (b StageBudget) exhausted(ctx context.Context) bool {
+	remaining, check := b.remaining(ctx)
+	return check && remaining <= 0
+}
+
+// stageContext bounds a stage to its share of the remaining time,
+// the stage is not bounded when the request has no deadline
+func (b StageBudget) stageContext(ctx context.Context,
+	share float64) (context.Context, context.CancelFunc) {
+
+	remaining, check := b.remaining(ctx)
+	if !check {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Duration(float64(remaining)*share))
+}
+
+// stageExpired checks if the stage ran out of its budget
+// while the request is still alive
+func stageExpired(ctx context.Context, stageCtx context.Context) bool {
+	return stageCtx.Err() != nil && ctx.Err() == nil
+}
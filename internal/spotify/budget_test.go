@@ -0,0 +1,213 @@
+package myspotify_test
+
+import (
+	"context"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/metrics"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+// slowClient never answers for the slow artist, until the context is done
+type slowClient struct {
+	*mocks.ClientMock
+	slowArtistId spotify.ID
+}
+
+func (c *slowClient) GetArtist(ctx context.Context,
+	artistID spotify.ID) (*spotify.FullArtist, error) {
+
+	if artistID == c.slowArtistId {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return c.ClientMock.GetArtist(ctx, artistID)
+}
+
+func TestSearchWithOptions_withEnrichmentBudgetExhausted(t *testing.T) {
+
+	ctxGiven, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	queryGiven := "chilly gonzales crying"
+
+	artistIdGiven := spotify.ID("artist-id-1")
+	slowArtistIdGiven := spotify.ID("artist-id-2")
+	searchResultsGiven := getSearchResults(artistIdGiven)
+	searchResultsGiven.Tracks.Tracks[1].Artists[0].ID = slowArtistIdGiven
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", queryGiven).Return(searchResultsGiven, nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.
+		On("NewClient", "client-id", "client-secret").
+		Return(&slowClient{clientGiven, slowArtistIdGiven}, time.Now().Add(time.Minute), nil)
+
+	budgetGiven := myspotify.DefaultStageBudget
+	budgetGiven.Reserve = 500 * time.Millisecond
+	mySpotifyClient := myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:     "client-id",
+		ClientSecret: "client-secret",
+		BaseLogger:   log.Default(),
+		Provider:     providerGiven,
+		Budget:       &budgetGiven,
+	})
+
+	result, err := mySpotifyClient.SearchWithOptions(ctxGiven,
+		myspotify.SearchOptions{Query: queryGiven})
+	assert.Nil(t, err)
+	assert.Nil(t, ctxGiven.Err())
+
+	// the tracks are returned, the slow artist without enrichment
+	assert.Len(t, result.Tracks, 2)
+	assert.Equal(t, []string{"genre1"}, result.Tracks[0].Artists[0].Genres)
+	assert.Equal(t, slowArtistIdGiven.String(), result.Tracks[1].Artists[0].ID)
+	assert.Empty(t, result.Tracks[1].Artists[0].Genres)
+	assert.Len(t, result.Warnings, 1)
+
+	clientGiven.AssertExpectations(t)
+}
+
+// slowPagingClient never answers for the page after an empty page,
+// until the context is done
+type slowPagingClient struct {
+	*mocks.ClientMock
+}
+
+func (c *slowPagingClient) NextPage(ctx context.Context, p *spotify.FullTrackPage) error {
+	if len(p.Tracks) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return c.ClientMock.NextPage(ctx, p)
+}
+
+func TestSearchWithOptions_withWarningBeforeRelaxation(t *testing.T) {
+
+	ctxGiven, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", "gogol genre:piano").Return(getEmptySearchResults(), nil)
+	clientGiven.On("Search", "gogol").Return(getSearchResults(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.
+		On("NewClient", "client-id", "client-secret").
+		Return(&slowPagingClient{clientGiven}, time.Now().Add(time.Minute), nil)
+
+	mySpotifyClient := myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:     "client-id",
+		ClientSecret: "client-secret",
+		BaseLogger:   log.Default(),
+		Provider:     providerGiven,
+	})
+
+	result, err := mySpotifyClient.SearchWithOptions(ctxGiven,
+		myspotify.SearchOptions{Query: "gogol", GenreFilters: []string{"piano"}})
+	assert.Nil(t, err)
+
+	// the paging warning of the first attempt is kept along with
+	// the results of the relaxed search
+	assert.Len(t, result.Tracks, 2)
+	assert.Equal(t, "drop-genre:piano", result.Relaxation)
+	assert.Len(t, result.Warnings, 1)
+
+	clientGiven.AssertExpectations(t)
+}
+
+func TestSearchWithOptions_withEnrichmentCallsObserved(t *testing.T) {
+
+	ctxGiven, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	queryGiven := "chilly gonzales crying"
+
+	artistIdGiven := spotify.ID("artist-id-1")
+	slowArtistIdGiven := spotify.ID("artist-id-2")
+	searchResultsGiven := getSearchResults(artistIdGiven)
+	searchResultsGiven.Tracks.Tracks[1].Artists[0].ID = slowArtistIdGiven
+	lastTrackGiven := searchResultsGiven.Tracks.Tracks[1]
+	lastTrackGiven.ID = "track-3"
+	lastTrackGiven.Artists = []spotify.SimpleArtist{{ID: "artist-id-3"}}
+	searchResultsGiven.Tracks.Tracks = append(searchResultsGiven.Tracks.Tracks, lastTrackGiven)
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", queryGiven).Return(searchResultsGiven, nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.
+		On("NewClient", "client-id", "client-secret").
+		Return(&slowClient{clientGiven, slowArtistIdGiven}, time.Now().Add(time.Minute), nil)
+
+	metricsGiven := metrics.New()
+	mySpotifyClient := myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:     "client-id",
+		ClientSecret: "client-secret",
+		BaseLogger:   log.Default(),
+		Provider:     providerGiven,
+		Metrics:      metricsGiven,
+	})
+
+	result, err := mySpotifyClient.SearchWithOptions(ctxGiven,
+		myspotify.SearchOptions{Query: queryGiven})
+	assert.Nil(t, err)
+	assert.Len(t, result.Tracks, 3)
+
+	// the third artist is not requested once the enrichment ran out of time
+	recorder := httptest.NewRecorder()
+	metricsGiven.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), "musicresearcher_search_enrichment_calls_sum 2\n")
+	assert.Contains(t, recorder.Body.String(), "musicresearcher_search_enrichment_calls_count 1\n")
+}
+
+func TestSearchWithOptions_withEnrichmentCallsOfRelaxation(t *testing.T) {
+
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", "gogol genre:piano").Return(getEmptySearchResults(), nil)
+	clientGiven.On("Search", "gogol").Return(getSearchResults(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.
+		On("NewClient", "client-id", "client-secret").
+		Return(clientGiven, time.Now().Add(time.Minute), nil)
+
+	metricsGiven := metrics.New()
+	mySpotifyClient := myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:     "client-id",
+		ClientSecret: "client-secret",
+		BaseLogger:   log.Default(),
+		Provider:     providerGiven,
+		Metrics:      metricsGiven,
+	})
+
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{Query: "gogol", GenreFilters: []string{"piano"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "drop-genre:piano", result.Relaxation)
+
+	// the attempts of the search are observed as a single sample
+	recorder := httptest.NewRecorder()
+	metricsGiven.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), "musicresearcher_search_enrichment_calls_sum 1\n")
+	assert.Contains(t, recorder.Body.String(), "musicresearcher_search_enrichment_calls_count 1\n")
+}
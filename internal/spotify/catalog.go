@@ -0,0 +1,172 @@
+package myspotify
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/zmb3/spotify/v2"
+)
+
+// the maximum IDs of a spotify lookup
+const (
+	maxTrackBatchSize  = 50
+	maxAlbumBatchSize  = 20
+	maxArtistBatchSize = 50
+)
+
+const (
+	defaultArtistAlbumLimit = 10
+	maxArtistAlbumLimit     = 50
+)
+
+// Album is an album of the catalog,
+// along with the IDs of its artists and of its tracks
+type Album struct {
+	*pb.Album
+
+	ArtistIDs []string
+	TrackIDs  []string
+	Genres    []string
+}
+
+// splits the IDs into batches of at most size IDs
+func splitBatches(ids []string, size int) [][]spotify.ID {
+	batches := make([][]spotify.ID, 0, (len(ids)+size-1)/size)
+	for start := 0; start < len(ids); start += size {
+		end := min(start+size, len(ids))
+
+		batch := make([]spotify.ID, 0, end-start)
+		for _, id := range ids[start:end] {
+			batch = append(batch, spotify.ID(id))
+		}
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+func mapSpotifyFullAlbum(album spotify.FullAlbum) *Album {
+	out := &Album{
+		Album:  mapSpotifyAlbum(album.SimpleAlbum),
+		Genres: album.Genres,
+	}
+
+	for _, artist := range album.Artists {
+		out.ArtistIDs = append(out.ArtistIDs, artist.ID.String())
+	}
+	for _, track := range album.Tracks.Tracks {
+		out.TrackIDs = append(out.TrackIDs, track.ID.String())
+	}
+
+	return out
+}
+
+// GetTracks looks the tracks up by ID, in as few spotify calls
+// as possible. The tracks not found are nil, at their position.
+// The artists of the tracks are not enriched.
+func (s *MySpotifyImpl) GetTracks(ctx context.Context, ids []string) ([]*pb.Track, error) {
+	if err := s.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("myspotify.refresh: %v", err)
+	}
+	client := s.currentClient()
+
+	out := make([]*pb.Track, 0, len(ids))
+	for _, batch := range splitBatches(ids, maxTrackBatchSize) {
+		trackList, err := client.GetTracks(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("client.GetTracks: %v", err)
+		}
+
+		for _, track := range trackList {
+			if track == nil {
+				out = append(out, nil)
+				continue
+			}
+			out = append(out, mapSpotifyTrack(*track, simpleArtistList(*track)))
+		}
+	}
+
+	return out, nil
+}
+
+// GetAlbums looks the albums up by ID, in as few spotify calls
+// as possible. The albums not found are nil, at their position.
+func (s *MySpotifyImpl) GetAlbums(ctx context.Context, ids []string) ([]*Album, error) {
+	if err := s.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("myspotify.refresh: %v", err)
+	}
+	client := s.currentClient()
+
+	out := make([]*Album, 0, len(ids))
+	for _, batch := range splitBatches(ids, maxAlbumBatchSize) {
+		albumList, err := client.GetAlbums(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("client.GetAlbums: %v", err)
+		}
+
+		for _, album := range albumList {
+			if album == nil {
+				out = append(out, nil)
+				continue
+			}
+			out = append(out, mapSpotifyFullAlbum(*album))
+		}
+	}
+
+	return out, nil
+}
+
+// GetArtists looks the artists up by ID, in as few spotify calls
+// as possible. The artists not found are nil, at their position.
+func (s *MySpotifyImpl) GetArtists(ctx context.Context, ids []string) ([]*pb.Artist, error) {
+	if err := s.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("myspotify.refresh: %v", err)
+	}
+	client := s.currentClient()
+
+	out := make([]*pb.Artist, 0, len(ids))
+	for _, batch := range splitBatches(ids, maxArtistBatchSize) {
+		artistList, err := client.GetArtists(ctx, batch...)
+		if err != nil {
+			return nil, fmt.Errorf("client.GetArtists: %v", err)
+		}
+
+		for _, artist := range artistList {
+			if artist == nil {
+				out = append(out, nil)
+				continue
+			}
+			out = append(out, mapSpotifyArtist(*artist))
+		}
+	}
+
+	return out, nil
+}
+
+// GetArtistAlbums lists the albums of the artist, up to the limit
+func (s *MySpotifyImpl) GetArtistAlbums(ctx context.Context,
+	id string, limit int) ([]*pb.Album, error) {
+
+	if err := s.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("myspotify.refresh: %v", err)
+	}
+	client := s.currentClient()
+
+	if limit <= 0 {
+		limit = defaultArtistAlbumLimit
+	}
+	limit = min(limit, maxArtistAlbumLimit)
+
+	page, err := client.GetArtistAlbums(ctx, spotify.ID(id), nil, spotify.Limit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("client.GetArtistAlbums: %v", err)
+	}
+
+	out := make([]*pb.Album, 0, len(page.Albums))
+	for _, album := range page.Albums {
+		out = append(out, mapSpotifyAlbum(album))
+	}
+
+	return out, nil
+}
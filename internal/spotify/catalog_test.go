@@ -0,0 +1,75 @@
+package myspotify_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestGetTracks_batches(t *testing.T) {
+
+	idsGiven := make([]string, 0, 60)
+	batchesGiven := [][]spotify.ID{{}, {}}
+	tracksGiven := [][]*spotify.FullTrack{{}, {}}
+	for i := 0; i < 60; i++ {
+		id := spotify.ID(fmt.Sprintf("track-%d", i))
+		idsGiven = append(idsGiven, id.String())
+		batchesGiven[i/50] = append(batchesGiven[i/50], id)
+		tracksGiven[i/50] = append(tracksGiven[i/50],
+			&spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: id}})
+	}
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("GetTracks", batchesGiven[0]).Return(tracksGiven[0], nil)
+	clientGiven.On("GetTracks", batchesGiven[1]).Return(tracksGiven[1], nil)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+
+	tracks, err := mySpotifyClient.GetTracks(context.Background(), idsGiven)
+	assert.Nil(t, err)
+	assert.Len(t, tracks, 60)
+	assert.Equal(t, "track-59", tracks[59].ID)
+
+	// 50 tracks per call
+	clientGiven.AssertNumberOfCalls(t, "GetTracks", 2)
+}
+
+func TestGetAlbums(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("GetAlbums", []spotify.ID{"album-1", "album-2"}).Return([]*spotify.FullAlbum{{
+		SimpleAlbum: spotify.SimpleAlbum{
+			ID:      "album-1",
+			Name:    "Solo Piano",
+			Artists: []spotify.SimpleArtist{{ID: "artist-1"}},
+		},
+		Tracks: spotify.SimpleTrackPage{Tracks: []spotify.SimpleTrack{{ID: "track-1"}}},
+	}, nil}, nil)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+
+	albums, err := mySpotifyClient.GetAlbums(context.Background(),
+		[]string{"album-1", "album-2"})
+	assert.Nil(t, err)
+	assert.Len(t, albums, 2)
+	assert.Equal(t, "Solo Piano", albums[0].Name)
+	assert.Equal(t, []string{"artist-1"}, albums[0].ArtistIDs)
+	assert.Equal(t, []string{"track-1"}, albums[0].TrackIDs)
+	assert.Nil(t, albums[1])
+}
+
+func TestGetArtistAlbums_withError(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("GetArtistAlbums", spotify.ID("artist-1")).
+		Return((*spotify.SimpleAlbumPage)(nil), fmt.Errorf("not found"))
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+
+	_, err := mySpotifyClient.GetArtistAlbums(context.Background(), "artist-1", 5)
+	assert.NotNil(t, err)
+}
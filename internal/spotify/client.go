@@ -2,9 +2,19 @@ package myspotify
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/planetfall/musicresearcher/internal/logging"
+	"github.com/planetfall/musicresearcher/internal/metrics"
+	"github.com/planetfall/musicresearcher/internal/ratelimit"
+	"github.com/planetfall/musicresearcher/internal/tracing"
 	"github.com/zmb3/spotify/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Client interface {
@@ -18,6 +28,19 @@ type Client interface {
 	Search(ctx context.Context, query string,
 		t spotify.SearchType,
 		opts ...spotify.RequestOption) (*spotify.SearchResult, error)
+
+	GetTracks(ctx context.Context, ids []spotify.ID,
+		opts ...spotify.RequestOption) ([]*spotify.FullTrack, error)
+
+	GetAlbums(ctx context.Context, ids []spotify.ID,
+		opts ...spotify.RequestOption) ([]*spotify.FullAlbum, error)
+
+	GetArtists(ctx context.Context,
+		ids ...spotify.ID) ([]*spotify.FullArtist, error)
+
+	GetArtistAlbums(ctx context.Context, artistID spotify.ID,
+		ts []spotify.AlbumType,
+		opts ...spotify.RequestOption) (*spotify.SimpleAlbumPage, error)
 }
 
 // clientImpl is a wrapper around spotify.Client
@@ -59,3 +82,399 @@ func (c *clientImpl) Search(ctx context.Context, query string,
 
 	return c.spotifyClient.Search(ctx, query, t, opts...)
 }
+
+func (c *clientImpl) GetTracks(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullTrack, error) {
+
+	return c.spotifyClient.GetTracks(ctx, ids, opts...)
+}
+
+func (c *clientImpl) GetAlbums(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullAlbum, error) {
+
+	return c.spotifyClient.GetAlbums(ctx, ids, opts...)
+}
+
+func (c *clientImpl) GetArtists(ctx context.Context,
+	ids ...spotify.ID) ([]*spotify.FullArtist, error) {
+
+	return c.spotifyClient.GetArtists(ctx, ids...)
+}
+
+func (c *clientImpl) GetArtistAlbums(ctx context.Context, artistID spotify.ID,
+	ts []spotify.AlbumType,
+	opts ...spotify.RequestOption) (*spotify.SimpleAlbumPage, error) {
+
+	return c.spotifyClient.GetArtistAlbums(ctx, artistID, ts, opts...)
+}
+
+// countingClient counts the upstream calls in the request context
+type countingClient struct {
+	Client
+}
+
+func (c *countingClient) GetArtist(ctx context.Context,
+	artistID spotify.ID) (*spotify.FullArtist, error) {
+
+	logging.CountUpstreamCall(ctx)
+	return c.Client.GetArtist(ctx, artistID)
+}
+
+func (c *countingClient) GetAvailableGenreSeeds(
+	ctx context.Context) ([]string, error) {
+
+	logging.CountUpstreamCall(ctx)
+	return c.Client.GetAvailableGenreSeeds(ctx)
+}
+
+func (c *countingClient) NextPage(
+	ctx context.Context, p *spotify.FullTrackPage) error {
+
+	logging.CountUpstreamCall(ctx)
+	return c.Client.NextPage(ctx, p)
+}
+
+func (c *countingClient) Search(ctx context.Context, query string,
+	t spotify.SearchType,
+	opts ...spotify.RequestOption) (*spotify.SearchResult, error) {
+
+	logging.CountUpstreamCall(ctx)
+	return c.Client.Search(ctx, query, t, opts...)
+}
+
+func (c *countingClient) GetTracks(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullTrack, error) {
+
+	logging.CountUpstreamCall(ctx)
+	return c.Client.GetTracks(ctx, ids, opts...)
+}
+
+func (c *countingClient) GetAlbums(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullAlbum, error) {
+
+	logging.CountUpstreamCall(ctx)
+	return c.Client.GetAlbums(ctx, ids, opts...)
+}
+
+func (c *countingClient) GetArtists(ctx context.Context,
+	ids ...spotify.ID) ([]*spotify.FullArtist, error) {
+
+	logging.CountUpstreamCall(ctx)
+	return c.Client.GetArtists(ctx, ids...)
+}
+
+func (c *countingClient) GetArtistAlbums(ctx context.Context, artistID spotify.ID,
+	ts []spotify.AlbumType,
+	opts ...spotify.RequestOption) (*spotify.SimpleAlbumPage, error) {
+
+	logging.CountUpstreamCall(ctx)
+	return c.Client.GetArtistAlbums(ctx, artistID, ts, opts...)
+}
+
+// limitingClient waits for an upstream slot before each call,
+// the slots being shared fairly across the callers
+type limitingClient struct {
+	Client
+	upstream *ratelimit.FairSemaphore
+}
+
+func (c *limitingClient) GetArtist(ctx context.Context,
+	artistID spotify.ID) (*spotify.FullArtist, error) {
+
+	if err := c.upstream.Acquire(ctx, ratelimit.Caller(ctx)); err != nil {
+		return nil, fmt.Errorf("upstream.Acquire: %v", err)
+	}
+	defer c.upstream.Release()
+
+	return c.Client.GetArtist(ctx, artistID)
+}
+
+func (c *limitingClient) GetAvailableGenreSeeds(
+	ctx context.Context) ([]string, error) {
+
+	if err := c.upstream.Acquire(ctx, ratelimit.Caller(ctx)); err != nil {
+		return nil, fmt.Errorf("upstream.Acquire: %v", err)
+	}
+	defer c.upstream.Release()
+
+	return c.Client.GetAvailableGenreSeeds(ctx)
+}
+
+func (c *limitingClient) NextPage(
+	ctx context.Context, p *spotify.FullTrackPage) error {
+
+	if err := c.upstream.Acquire(ctx, ratelimit.Caller(ctx)); err != nil {
+		return fmt.Errorf("upstream.Acquire: %v", err)
+	}
+	defer c.upstream.Release()
+
+	return c.Client.NextPage(ctx, p)
+}
+
+func (c *limitingClient) Search(ctx context.Context, query string,
+	t spotify.SearchType,
+	opts ...spotify.RequestOption) (*spotify.SearchResult, error) {
+
+	if err := c.upstream.Acquire(ctx, ratelimit.Caller(ctx)); err != nil {
+		return nil, fmt.Errorf("upstream.Acquire: %v", err)
+	}
+	defer c.upstream.Release()
+
+	return c.Client.Search(ctx, query, t, opts...)
+}
+
+func (c *limitingClient) GetTracks(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullTrack, error) {
+
+	if err := c.upstream.Acquire(ctx, ratelimit.Caller(ctx)); err != nil {
+		return nil, fmt.Errorf("upstream.Acquire: %v", err)
+	}
+	defer c.upstream.Release()
+
+	return c.Client.GetTracks(ctx, ids, opts...)
+}
+
+func (c *limitingClient) GetAlbums(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullAlbum, error) {
+
+	if err := c.upstream.Acquire(ctx, ratelimit.Caller(ctx)); err != nil {
+		return nil, fmt.Errorf("upstream.Acquire: %v", err)
+	}
+	defer c.upstream.Release()
+
+	return c.Client.GetAlbums(ctx, ids, opts...)
+}
+
+func (c *limitingClient) GetArtists(ctx context.Context,
+	ids ...spotify.ID) ([]*spotify.FullArtist, error) {
+
+	if err := c.upstream.Acquire(ctx, ratelimit.Caller(ctx)); err != nil {
+		return nil, fmt.Errorf("upstream.Acquire: %v", err)
+	}
+	defer c.upstream.Release()
+
+	return c.Client.GetArtists(ctx, ids...)
+}
+
+func (c *limitingClient) GetArtistAlbums(ctx context.Context, artistID spotify.ID,
+	ts []spotify.AlbumType,
+	opts ...spotify.RequestOption) (*spotify.SimpleAlbumPage, error) {
+
+	if err := c.upstream.Acquire(ctx, ratelimit.Caller(ctx)); err != nil {
+		return nil, fmt.Errorf("upstream.Acquire: %v", err)
+	}
+	defer c.upstream.Release()
+
+	return c.Client.GetArtistAlbums(ctx, artistID, ts, opts...)
+}
+
+// the upstream operations, as labelled in the metrics
+const (
+	opGetAvailableGenreSeeds = "GetAvailableGenreSeeds"
+	opGetArtist              = "GetArtist"
+	opNextPage               = "NextPage"
+	opSearch                 = "Search"
+	opGetTracks              = "GetTracks"
+	opGetAlbums              = "GetAlbums"
+	opGetArtists             = "GetArtists"
+	opGetArtistAlbums        = "GetArtistAlbums"
+)
+
+// metricsClient records the latency and the result of the upstream calls
+type metricsClient struct {
+	Client
+	metrics *metrics.Metrics
+}
+
+// checks if the upstream call was rejected by the spotify rate limit
+func isRateLimited(err error) bool {
+	var spotifyErr spotify.Error
+	if errors.As(err, &spotifyErr) {
+		return spotifyErr.Status == http.StatusTooManyRequests
+	}
+
+	return err != nil && strings.Contains(err.Error(),
+		fmt.Sprintf("HTTP %d", http.StatusTooManyRequests))
+}
+
+func (c *metricsClient) observe(operation string, start time.Time, err error) {
+	// the end of the pages is not a failure
+	if errors.Is(err, spotify.ErrNoMorePages) {
+		err = nil
+	}
+
+	c.metrics.ObserveUpstreamCall(operation, time.Since(start), err, isRateLimited(err))
+}
+
+func (c *metricsClient) GetArtist(ctx context.Context,
+	artistID spotify.ID) (*spotify.FullArtist, error) {
+
+	start := time.Now()
+	artist, err := c.Client.GetArtist(ctx, artistID)
+	c.observe(opGetArtist, start, err)
+
+	return artist, err
+}
+
+func (c *metricsClient) GetAvailableGenreSeeds(
+	ctx context.Context) ([]string, error) {
+
+	start := time.Now()
+	genreList, err := c.Client.GetAvailableGenreSeeds(ctx)
+	c.observe(opGetAvailableGenreSeeds, start, err)
+
+	return genreList, err
+}
+
+func (c *metricsClient) NextPage(
+	ctx context.Context, p *spotify.FullTrackPage) error {
+
+	start := time.Now()
+	err := c.Client.NextPage(ctx, p)
+	c.observe(opNextPage, start, err)
+
+	return err
+}
+
+func (c *metricsClient) Search(ctx context.Context, query string,
+	t spotify.SearchType,
+	opts ...spotify.RequestOption) (*spotify.SearchResult, error) {
+
+	start := time.Now()
+	results, err := c.Client.Search(ctx, query, t, opts...)
+	c.observe(opSearch, start, err)
+
+	return results, err
+}
+
+func (c *metricsClient) GetTracks(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullTrack, error) {
+
+	start := time.Now()
+	tracks, err := c.Client.GetTracks(ctx, ids, opts...)
+	c.observe(opGetTracks, start, err)
+
+	return tracks, err
+}
+
+func (c *metricsClient) GetAlbums(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullAlbum, error) {
+
+	start := time.Now()
+	albums, err := c.Client.GetAlbums(ctx, ids, opts...)
+	c.observe(opGetAlbums, start, err)
+
+	return albums, err
+}
+
+func (c *metricsClient) GetArtists(ctx context.Context,
+	ids ...spotify.ID) ([]*spotify.FullArtist, error) {
+
+	start := time.Now()
+	artists, err := c.Client.GetArtists(ctx, ids...)
+	c.observe(opGetArtists, start, err)
+
+	return artists, err
+}
+
+func (c *metricsClient) GetArtistAlbums(ctx context.Context, artistID spotify.ID,
+	ts []spotify.AlbumType,
+	opts ...spotify.RequestOption) (*spotify.SimpleAlbumPage, error) {
+
+	start := time.Now()
+	albums, err := c.Client.GetArtistAlbums(ctx, artistID, ts, opts...)
+	c.observe(opGetArtistAlbums, start, err)
+
+	return albums, err
+}
+
+// tracingClient creates a span for each upstream call
+type tracingClient struct {
+	Client
+}
+
+func (c *tracingClient) GetArtist(ctx context.Context,
+	artistID spotify.ID) (artist *spotify.FullArtist, err error) {
+
+	ctx, span := tracing.Start(ctx, "Client."+opGetArtist,
+		trace.WithAttributes(attribute.String("spotify.artist_id", artistID.String())))
+	defer func() { tracing.End(span, err) }()
+
+	return c.Client.GetArtist(ctx, artistID)
+}
+
+func (c *tracingClient) GetAvailableGenreSeeds(
+	ctx context.Context) (genreList []string, err error) {
+
+	ctx, span := tracing.Start(ctx, "Client."+opGetAvailableGenreSeeds)
+	defer func() { tracing.End(span, err) }()
+
+	return c.Client.GetAvailableGenreSeeds(ctx)
+}
+
+func (c *tracingClient) NextPage(
+	ctx context.Context, p *spotify.FullTrackPage) (err error) {
+
+	ctx, span := tracing.Start(ctx, "Client."+opNextPage)
+	defer func() {
+		if errors.Is(err, spotify.ErrNoMorePages) {
+			tracing.End(span, nil)
+			return
+		}
+		tracing.End(span, err)
+	}()
+
+	return c.Client.NextPage(ctx, p)
+}
+
+func (c *tracingClient) Search(ctx context.Context, query string,
+	t spotify.SearchType,
+	opts ...spotify.RequestOption) (results *spotify.SearchResult, err error) {
+
+	ctx, span := tracing.Start(ctx, "Client."+opSearch,
+		trace.WithAttributes(attribute.String("spotify.query", query)))
+	defer func() { tracing.End(span, err) }()
+
+	return c.Client.Search(ctx, query, t, opts...)
+}
+
+func (c *tracingClient) GetTracks(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) (tracks []*spotify.FullTrack, err error) {
+
+	ctx, span := tracing.Start(ctx, "Client."+opGetTracks,
+		trace.WithAttributes(attribute.Int("spotify.id_count", len(ids))))
+	defer func() { tracing.End(span, err) }()
+
+	return c.Client.GetTracks(ctx, ids, opts...)
+}
+
+func (c *tracingClient) GetAlbums(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) (albums []*spotify.FullAlbum, err error) {
+
+	ctx, span := tracing.Start(ctx, "Client."+opGetAlbums,
+		trace.WithAttributes(attribute.Int("spotify.id_count", len(ids))))
+	defer func() { tracing.End(span, err) }()
+
+	return c.Client.GetAlbums(ctx, ids, opts...)
+}
+
+func (c *tracingClient) GetArtists(ctx context.Context,
+	ids ...spotify.ID) (artists []*spotify.FullArtist, err error) {
+
+	ctx, span := tracing.Start(ctx, "Client."+opGetArtists,
+		trace.WithAttributes(attribute.Int("spotify.id_count", len(ids))))
+	defer func() { tracing.End(span, err) }()
+
+	return c.Client.GetArtists(ctx, ids...)
+}
+
+func (c *tracingClient) GetArtistAlbums(ctx context.Context, artistID spotify.ID,
+	ts []spotify.AlbumType,
+	opts ...spotify.RequestOption) (albums *spotify.SimpleAlbumPage, err error) {
+
+	ctx, span := tracing.Start(ctx, "Client."+opGetArtistAlbums,
+		trace.WithAttributes(attribute.String("spotify.artist_id", artistID.String())))
+	defer func() { tracing.End(span, err) }()
+
+	return c.Client.GetArtistAlbums(ctx, artistID, ts, opts...)
+}
@@ -0,0 +1,179 @@
+package myspotify
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+)
+
+type DedupMode int
+
+const (
+	// DedupNone keeps every track returned by spotify
+	DedupNone DedupMode = iota
+	// DedupEarliest keeps the track with the earliest release date
+	DedupEarliest
+	// DedupPopular keeps the most popular track
+	DedupPopular
+)
+
+// maximum duration difference for two tracks without ISRC
+// to be considered as the same recording
+const dedupDurationToleranceMs = 3000
+
+var dedupModeNames = map[string]DedupMode{
+	"":         DedupNone,
+	"none":     DedupNone,
+	"earliest": DedupEarliest,
+	"popular":  DedupPopular,
+}
+
+// ParseDedupMode converts a dedup mode name (none, earliest, popular)
+// into its DedupMode
+func ParseDedupMode(name string) (DedupMode, error) {
+	mode, check := dedupModeNames[strings.ToLower(strings.TrimSpace(name))]
+	if !check {
+		return DedupNone, fmt.Errorf("unknown dedup mode `%s`", name)
+	}
+
+	return mode, nil
+}
+
+// matches the version qualifiers added to the title of
+// remastered, reissued or compiled tracks, such as
+// `Song - Remastered 2011` or `Song (Single Version)`
+var titleVersionRegexp = regexp.MustCompile(
+	`(?i)\s*(-\s+.*(remaster|version|edit|mono|stereo|reissue).*$` +
+		`|[\(\[][^\)\]]*(remaster|version|edit|mono|stereo|reissue)[^\)\]]*[\)\]])`)
+
+var titleNoiseRegexp = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+func normalizeTitle(title string) string {
+	title = titleVersionRegexp.ReplaceAllString(title, "")
+	title = titleNoiseRegexp.ReplaceAllString(
+		strings.ToLower(foldUnicode(title)), " ")
+
+	return strings.TrimSpace(title)
+}
+
+func primaryArtistName(track *pb.Track) string {
+	if len(track.Artists) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(foldUnicode(track.Artists[0].Name))
+}
+
+// checks if two tracks without ISRC are the same recording
+func isSameRecording(a *pb.Track, b *pb.Track) bool {
+	if normalizeTitle(a.Name) != normalizeTitle(b.Name) {
+		return false
+	}
+
+	if primaryArtistName(a) != primaryArtistName(b) {
+		return false
+	}
+
+	delta := a.DurationMs - b.DurationMs
+	if delta < 0 {
+		delta = -delta
+	}
+
+	return delta <= dedupDurationToleranceMs
+}
+
+// checks if the candidate track should replace the current canonical track
+func isBetterCanonical(candidate *pb.Track, current *pb.Track, mode DedupMode) bool {
+	switch mode {
+	case DedupPopular:
+		return candidate.Popularity > current.Popularity
+
+	case DedupEarliest:
+		candidateDate := candidate.GetAlbum().GetReleaseDate()
+		currentDate := current.GetAlbum().GetReleaseDate()
+		if candidateDate == "" {
+			return false
+		}
+
+		// spotify release dates are formatted as YYYY, YYYY-MM or YYYY-MM-DD,
+		// hence can be compared lexicographically
+		return currentDate == "" || candidateDate < currentDate
+	}
+
+	return false
+}
+
+type dedupGroup struct {
+	isrc      string
+	canonical *pb.Track
+	tracks    []*pb.Track
+}
+
+// dedupTracks groups the tracks by ISRC, or by normalized title,
+// primary artist and duration when the ISRC of either track is missing.
+// It returns one canonical track per group, following the ranking
+// of the first track of the group, and the alternate track IDs
+// by canonical track ID.
+func dedupTracks(trackList []*pb.Track, isrcList map[string]string,
+	mode DedupMode) ([]*pb.Track, map[string][]string) {
+
+	alternates := make(map[string][]string)
+	if mode == DedupNone {
+		return trackList, alternates
+	}
+
+	groups := make([]*dedupGroup, 0)
+	groupByIsrc := make(map[string]*dedupGroup)
+
+	for _, track := range trackList {
+		isrc := strings.ToUpper(isrcList[track.ID])
+
+		var group *dedupGroup
+		if isrc != "" {
+			group = groupByIsrc[isrc]
+		}
+		if group == nil {
+			// a track without ISRC may join any group, and a track with
+			// an ISRC the groups without one, whatever their order
+			for _, candidate := range groups {
+				if (isrc == "" || candidate.isrc == "") &&
+					isSameRecording(candidate.canonical, track) {
+					group = candidate
+					break
+				}
+			}
+			if group != nil && isrc != "" {
+				group.isrc = isrc
+				groupByIsrc[isrc] = group
+			}
+		}
+
+		if group == nil {
+			group = &dedupGroup{isrc: isrc, canonical: track}
+			groups = append(groups, group)
+			if isrc != "" {
+				groupByIsrc[isrc] = group
+			}
+		} else if isBetterCanonical(track, group.canonical, mode) {
+			group.canonical = track
+		}
+
+		group.tracks = append(group.tracks, track)
+	}
+
+	out := make([]*pb.Track, 0, len(groups))
+	for _, group := range groups {
+		out = append(out, group.canonical)
+
+		for _, track := range group.tracks {
+			if track != group.canonical {
+				alternates[group.canonical.ID] = append(
+					alternates[group.canonical.ID], track.ID)
+			}
+		}
+	}
+
+	return out, alternates
+}
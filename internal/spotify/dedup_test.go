@@ -0,0 +1,150 @@
+package myspotify_test
+
+import (
+	"context"
+	"testing"
+
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+func getTrack(id spotify.ID, name string, artistId spotify.ID,
+	releaseDate string, popularity int, isrc string) spotify.FullTrack {
+
+	track := spotify.FullTrack{
+		Album: spotify.SimpleAlbum{
+			ID:          spotify.ID("album-" + id),
+			Name:        "album",
+			ReleaseDate: releaseDate,
+		},
+		SimpleTrack: spotify.SimpleTrack{
+			ID:       id,
+			Name:     name,
+			Duration: 180000,
+			Artists: []spotify.SimpleArtist{
+				{ID: artistId},
+			},
+		},
+		Popularity:  popularity,
+		ExternalIDs: map[string]string{},
+	}
+	if isrc != "" {
+		track.ExternalIDs["isrc"] = isrc
+	}
+
+	return track
+}
+
+func getDuplicatedSearchResults(artistId spotify.ID) *spotify.SearchResult {
+	return &spotify.SearchResult{
+		Tracks: &spotify.FullTrackPage{
+			Tracks: []spotify.FullTrack{
+				getTrack("t1", "Song - Remastered 2011", artistId, "2011-05-01", 80, "ISRC1"),
+				getTrack("t2", "Song", artistId, "1975-10-31", 40, "ISRC1"),
+				getTrack("t3", "Song (Single Version)", artistId, "1976", 60, ""),
+				getTrack("t4", "Other Song", artistId, "1975-10-31", 50, "ISRC2"),
+			},
+		},
+	}
+}
+
+func searchWithDedup(t *testing.T,
+	dedup myspotify.DedupMode) *myspotify.SearchResult {
+
+	return searchTracksWithDedup(t, dedup,
+		getDuplicatedSearchResults("artist-id-1").Tracks.Tracks)
+}
+
+func searchTracksWithDedup(t *testing.T, dedup myspotify.DedupMode,
+	trackList []spotify.FullTrack) *myspotify.SearchResult {
+
+	queryGiven := "song"
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.
+		On("Search", queryGiven).
+		Return(&spotify.SearchResult{
+			Tracks: &spotify.FullTrackPage{Tracks: trackList},
+		}, nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{
+			Query: queryGiven,
+			Dedup: dedup,
+		})
+	assert.Nil(t, err)
+
+	clientGiven.AssertExpectations(t)
+
+	return result
+}
+
+func trackIdList(result *myspotify.SearchResult) []string {
+	out := make([]string, 0)
+	for _, track := range result.Tracks {
+		out = append(out, track.ID)
+	}
+
+	return out
+}
+
+func TestSearchWithOptions_withoutDedup(t *testing.T) {
+
+	result := searchWithDedup(t, myspotify.DedupNone)
+	assert.Equal(t, []string{"t1", "t2", "t3", "t4"}, trackIdList(result))
+	assert.Empty(t, result.Alternates)
+}
+
+func TestSearchWithOptions_withDedupEarliest(t *testing.T) {
+
+	result := searchWithDedup(t, myspotify.DedupEarliest)
+	assert.Equal(t, []string{"t2", "t4"}, trackIdList(result))
+	assert.Equal(t, map[string][]string{
+		"t2": {"t1", "t3"},
+	}, result.Alternates)
+}
+
+func TestSearchWithOptions_withDedupPopular(t *testing.T) {
+
+	result := searchWithDedup(t, myspotify.DedupPopular)
+	assert.Equal(t, []string{"t1", "t4"}, trackIdList(result))
+	assert.Equal(t, map[string][]string{
+		"t1": {"t2", "t3"},
+	}, result.Alternates)
+}
+
+func TestSearchWithOptions_withDedupInAnyOrder(t *testing.T) {
+
+	artistIdGiven := spotify.ID("artist-id-1")
+	withoutIsrc := getTrack("t3", "Song (Single Version)", artistIdGiven, "1976", 60, "")
+	withIsrc := getTrack("t2", "Song", artistIdGiven, "1975-10-31", 40, "ISRC1")
+
+	for _, trackList := range [][]spotify.FullTrack{
+		{withoutIsrc, withIsrc},
+		{withIsrc, withoutIsrc},
+	} {
+		result := searchTracksWithDedup(t, myspotify.DedupEarliest, trackList)
+		assert.Equal(t, []string{"t2"}, trackIdList(result))
+		assert.Equal(t, map[string][]string{"t2": {"t3"}}, result.Alternates)
+	}
+}
+
+func TestParseDedupMode(t *testing.T) {
+
+	mode, err := myspotify.ParseDedupMode("Popular")
+	assert.Nil(t, err)
+	assert.Equal(t, myspotify.DedupPopular, mode)
+
+	mode, err = myspotify.ParseDedupMode("")
+	assert.Nil(t, err)
+	assert.Equal(t, myspotify.DedupNone, mode)
+
+	_, err = myspotify.ParseDedupMode("latest")
+	assert.NotNil(t, err)
+}
@@ -12,13 +12,28 @@ func (s *MySpotifyImpl) GetGenreList(ctx context.Context) (*pb.GenreList, error)
 	if err := s.refresh(ctx); err != nil {
 		return nil, fmt.Errorf("myspotify.refresh: %v", err)
 	}
+	client := s.currentClient()
 
-	genreList, err := s.client.GetAvailableGenreSeeds(ctx)
+	genreList, err := client.GetAvailableGenreSeeds(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("client.GetAvailableGenreSeeds: %v", genreList)
+		return nil, fmt.Errorf("client.GetAvailableGenreSeeds: %v", err)
 	}
 
 	return &pb.GenreList{
 		Genres: genreList,
 	}, nil
 }
+
+func (s *MySpotifyImpl) CheckReadiness(ctx context.Context) error {
+
+	genreList, err := s.GetGenreList(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(genreList.Genres) == 0 {
+		return fmt.Errorf("genre seed list is empty")
+	}
+
+	return nil
+}
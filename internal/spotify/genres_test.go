@@ -189,3 +189,40 @@ func TestGetGenreList_withClientError(t *testing.T) {
 	providerGiven.AssertExpectations(t)
 	clientGiven.AssertExpectations(t)
 }
+
+func TestCheckReadiness(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("GetAvailableGenreSeeds").Return([]string{"genre1"}, nil)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	err := mySpotifyClient.CheckReadiness(context.Background())
+	assert.Nil(t, err)
+
+	clientGiven.AssertExpectations(t)
+}
+
+func TestCheckReadiness_withEmptyGenreList(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("GetAvailableGenreSeeds").Return([]string{}, nil)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	err := mySpotifyClient.CheckReadiness(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "genre seed list is empty")
+}
+
+func TestCheckReadiness_withGenreSeedsError(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.
+		On("GetAvailableGenreSeeds").
+		Return([]string(nil), fmt.Errorf("spotify is unavailable"))
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	err := mySpotifyClient.CheckReadiness(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "client.GetAvailableGenreSeeds")
+	assert.Contains(t, err.Error(), "spotify is unavailable")
+}
@@ -4,24 +4,65 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/planetfall/musicresearcher/internal/metrics"
+	"github.com/planetfall/musicresearcher/internal/ratelimit"
 )
 
 type MySpotifyImpl struct {
+	mu              sync.RWMutex
 	client          Client
 	clientId        string
 	clientSecret    string
 	tokenExpiryTime time.Time
-
-	provider Provider
-	logger   *log.Logger
+	refreshCount    int64
+
+	provider   Provider
+	logger     *slog.Logger
+	dictionary *nameDictionary
+	index      *prefixIndex
+	scorer     Scorer
+	metrics    *metrics.Metrics
+	upstream   *ratelimit.FairSemaphore
+	budget     StageBudget
+
+	currentSettings atomic.Pointer[Settings]
 }
 
 type MySpotifyOptions struct {
 	ClientId     string
 	ClientSecret string
-	BaseLogger   *log.Logger
+	Logger       *slog.Logger
 	Provider     Provider
+
+	// Deprecated: use Logger, BaseLogger is only
+	// used for its writer when Logger is not provided
+	BaseLogger *log.Logger
+
+	// Scorer computes the relevance of the tracks,
+	// DefaultScorer when not provided
+	Scorer *Scorer
+
+	// Metrics records the upstream calls, nothing is recorded when nil
+	Metrics *metrics.Metrics
+
+	// Upstream caps the in-flight spotify calls, unlimited when nil
+	Upstream *ratelimit.FairSemaphore
+
+	// Budget splits the deadline of the searches across their stages,
+	// DefaultStageBudget when not provided
+	Budget *StageBudget
+
+	// Settings are the initial settings, DefaultSettings when not provided
+	Settings *Settings
+
+	// SuggestIndexSize is the maximum number of keys of the suggestion
+	// index, frozen once full until flushed, 200000 when not positive
+	SuggestIndexSize int
 }
 
 func (opt MySpotifyOptions) getProvider() Provider {
@@ -32,42 +73,109 @@ func (opt MySpotifyOptions) getProvider() Provider {
 	return opt.Provider
 }
 
+func (opt MySpotifyOptions) getScorer() Scorer {
+	if opt.Scorer == nil {
+		return DefaultScorer
+	}
+
+	return *opt.Scorer
+}
+
+func (opt MySpotifyOptions) getBudget() StageBudget {
+	if opt.Budget == nil {
+		return DefaultStageBudget
+	}
+
+	return *opt.Budget
+}
+
+func (opt MySpotifyOptions) getSettings() Settings {
+	if opt.Settings == nil {
+		return DefaultSettings
+	}
+
+	return *opt.Settings
+}
+
+func (opt MySpotifyOptions) getLogger() *slog.Logger {
+	logger := opt.Logger
+	if logger == nil && opt.BaseLogger != nil {
+		logger = slog.New(slog.NewTextHandler(opt.BaseLogger.Writer(), nil))
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return logger.With("component", "spotify")
+}
+
 func NewMySpotify(opt MySpotifyOptions) MySpotify {
 
-	prefix := fmt.Sprintf("%s[%s] ", opt.BaseLogger.Prefix(), "SPOTIFY")
-	logger := log.New(opt.BaseLogger.Writer(), prefix, opt.BaseLogger.Flags())
+	logger := opt.getLogger()
 
-	return &MySpotifyImpl{
+	s := &MySpotifyImpl{
 		client:          nil,
 		clientId:        opt.ClientId,
 		clientSecret:    opt.ClientSecret,
 		tokenExpiryTime: time.Now(),
 
-		provider: opt.getProvider(),
-		logger:   logger,
+		provider:   opt.getProvider(),
+		logger:     logger,
+		dictionary: newNameDictionary(),
+		index:      newPrefixIndex(opt.SuggestIndexSize),
+		scorer:     opt.getScorer(),
+		metrics:    opt.Metrics,
+		upstream:   opt.Upstream,
+		budget:     opt.getBudget(),
 	}
+
+	settings := opt.getSettings()
+	s.currentSettings.Store(&settings)
+
+	return s
+}
+
+// setClient replaces the client and its token expiry,
+// the lock being held by the caller
+func (s *MySpotifyImpl) setClient(client Client, expiryTime time.Time) {
+	s.client = &countingClient{&limitingClient{
+		&metricsClient{&tracingClient{client}, s.metrics}, s.upstream}}
+	s.tokenExpiryTime = expiryTime
+	s.refreshCount++
+}
+
+// currentClient returns the client, to be used for the whole request:
+// a credential rotation replaces it while the requests run
+func (s *MySpotifyImpl) currentClient() Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.client
 }
 
 func (s *MySpotifyImpl) refresh(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// current token is valid, no need to refresh
 	if s.client != nil && s.tokenExpiryTime.After(time.Now()) {
 		return nil
 	}
 
 	// current token expired, refreshing...
-	s.logger.Println("refreshing spotify client...")
+	s.logger.InfoContext(ctx, "refreshing spotify client")
 
 	client, expiryTime, err := s.provider.NewClient(ctx, s.clientId, s.clientSecret)
+	s.metrics.ObserveTokenRefresh(err)
 	if err != nil {
 		return fmt.Errorf("provider.NewClient: %v", err)
 	}
 
-	s.client = client
-	s.tokenExpiryTime = expiryTime
+	s.setClient(client, expiryTime)
 
 	// refreshed
-	s.logger.Printf("spotify client refreshed, token expires in %v",
-		time.Until(s.tokenExpiryTime))
+	s.logger.InfoContext(ctx, "spotify client refreshed",
+		"expires_in", time.Until(s.tokenExpiryTime))
 
 	return nil
 }
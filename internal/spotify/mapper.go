@@ -2,13 +2,27 @@ package myspotify
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/internal/tracing"
 	"github.com/zmb3/spotify/v2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-const spotifyUrlKey = "spotify"
+const (
+	spotifyUrlKey = "spotify"
+	isrcKey       = "isrc"
+)
+
+// the warnings of the searches returning partial results
+const (
+	pagingBudgetWarning     = "paging ran out of time, the next pages were not fetched"
+	enrichmentBudgetWarning = "enrichment ran out of time, some artists are not enriched"
+	retryBudgetWarning      = "no time left to retry with the raw query"
+	relaxationBudgetWarning = "no time left to relax the search"
+)
 
 type ItemType int
 
@@ -33,24 +47,32 @@ func getImageUrl(images []spotify.Image, itemType pb.Type) string {
 	return images[0].URL
 }
 
-func mapSpotifyTrack(track spotify.FullTrack, artistList []spotify.FullArtist) *pb.Track {
-	albumDto := &pb.Album{
-		ID:          track.Album.ID.String(),
-		Name:        track.Album.Name,
-		ReleaseDate: track.Album.ReleaseDate,
-		SpotifyUrl:  track.Album.ExternalURLs[spotifyUrlKey],
-		ImageUrl:    getImageUrl(track.Album.Images, pb.Type_ALBUM),
+func mapSpotifyAlbum(album spotify.SimpleAlbum) *pb.Album {
+	return &pb.Album{
+		ID:          album.ID.String(),
+		Name:        album.Name,
+		ReleaseDate: album.ReleaseDate,
+		SpotifyUrl:  album.ExternalURLs[spotifyUrlKey],
+		ImageUrl:    getImageUrl(album.Images, pb.Type_ALBUM),
+	}
+}
+
+func mapSpotifyArtist(artist spotify.FullArtist) *pb.Artist {
+	return &pb.Artist{
+		ID:         artist.ID.String(),
+		Name:       artist.Name,
+		SpotifyUrl: artist.ExternalURLs[spotifyUrlKey],
+		Genres:     artist.Genres,
+		ImageUrl:   getImageUrl(artist.Images, pb.Type_ARTIST),
 	}
+}
+
+func mapSpotifyTrack(track spotify.FullTrack, artistList []spotify.FullArtist) *pb.Track {
+	albumDto := mapSpotifyAlbum(track.Album)
 
 	artistDtoList := make([]*pb.Artist, 0)
 	for _, artist := range artistList {
-		artistDtoList = append(artistDtoList, &pb.Artist{
-			ID:         artist.ID.String(),
-			Name:       artist.Name,
-			SpotifyUrl: artist.ExternalURLs[spotifyUrlKey],
-			Genres:     artist.Genres,
-			ImageUrl:   getImageUrl(artist.Images, pb.Type_ARTIST),
-		})
+		artistDtoList = append(artistDtoList, mapSpotifyArtist(artist))
 	}
 
 	trackDto := &pb.Track{
@@ -68,9 +90,10 @@ func mapSpotifyTrack(track spotify.FullTrack, artistList []spotify.FullArtist) *
 	return trackDto
 }
 
-// lists the full artists metadatas from a full spotify trac
-func (s *MySpotifyImpl) listArtistsFromTrack(ctx context.Context,
-	track spotify.FullTrack, artistBufferList *[]spotify.FullArtist,
+// lists the full artists metadatas from a full spotify trac,
+// counting the artists requested from the API
+func (s *MySpotifyImpl) listArtistsFromTrack(ctx context.Context, client Client,
+	track spotify.FullTrack, artistBufferList *[]spotify.FullArtist, calls *int,
 ) ([]spotify.FullArtist, error) {
 
 	out := make([]spotify.FullArtist, 0)
@@ -87,7 +110,8 @@ func (s *MySpotifyImpl) listArtistsFromTrack(ctx context.Context,
 
 		// if not, request the artist from API
 		if !inBuffer {
-			artist, err := s.client.GetArtist(ctx, artist.ID)
+			*calls++
+			artist, err := client.GetArtist(ctx, artist.ID)
 			if err != nil {
 				return nil, fmt.Errorf("client.GetArtist: %v", err)
 			}
@@ -101,28 +125,88 @@ func (s *MySpotifyImpl) listArtistsFromTrack(ctx context.Context,
 }
 
 // converts a list of track pages into the output format
-// and enrich the result with the full artist metadatas
+// and enrich the result with the full artist metadatas.
+// The ISRC of the tracks are returned by track ID.
+// The paging and the enrichment are bounded by their stage budget:
+// when one runs out of time, the tracks fetched so far are returned
+// along with a warning. The enrichment calls made, whether they
+// failed or not, are added to enrichmentCalls.
 func (s *MySpotifyImpl) pagesToTrackList(
-	ctx context.Context, pages *spotify.FullTrackPage) ([]*pb.Track, error) {
+	ctx context.Context, client Client, pages *spotify.FullTrackPage,
+	enrichmentCalls *int,
+) (trackList []*pb.Track, isrcList map[string]string, warnings []string, err error) {
 
-	var trackList = make([]*pb.Track, 0)
-	var artistBufferList = make([]spotify.FullArtist, 0)
+	ctx, span := tracing.Start(ctx, "MySpotifyImpl.pagesToTrackList")
+	defer func() {
+		span.SetAttributes(attribute.Int("search.tracks", len(trackList)))
+		tracing.End(span, err)
+	}()
 
+	warnings = make([]string, 0)
+
+	// fetch the next pages
+	pagingCtx, cancel := s.budget.stageContext(ctx, s.budget.pagingShare())
+	fullTrackList := append([]spotify.FullTrack(nil), pages.Tracks...)
 	for {
-		for _, track := range pages.Tracks {
-			artistList, err := s.listArtistsFromTrack(ctx, track, &artistBufferList)
-			if err != nil {
-				return nil, err
+		err := client.NextPage(pagingCtx, pages)
+		if errors.Is(err, spotify.ErrNoMorePages) {
+			break
+		}
+		if err != nil {
+			if stageExpired(ctx, pagingCtx) {
+				warnings = append(warnings, pagingBudgetWarning)
+				break
 			}
+			cancel()
+			return nil, nil, nil, fmt.Errorf("client.NextPage: %v", err)
+		}
+		fullTrackList = append(fullTrackList, pages.Tracks...)
+	}
+	cancel()
+
+	// enrich the artists, with the time left
+	enrichmentCtx, cancel := s.budget.stageContext(ctx, 1)
+	defer cancel()
 
-			track := mapSpotifyTrack(track, artistList)
-			trackList = append(trackList, track)
+	trackList = make([]*pb.Track, 0, len(fullTrackList))
+	isrcList = make(map[string]string)
+	var artistBufferList = make([]spotify.FullArtist, 0)
+	enriching := true
+
+	for _, track := range fullTrackList {
+		artistList := simpleArtistList(track)
+		if enriching {
+			enrichedArtistList, err := s.listArtistsFromTrack(
+				enrichmentCtx, client, track, &artistBufferList, enrichmentCalls)
+			switch {
+			case err == nil:
+				artistList = enrichedArtistList
+			case stageExpired(ctx, enrichmentCtx):
+				// keep the remaining tracks without enrichment
+				warnings = append(warnings, enrichmentBudgetWarning)
+				enriching = false
+			default:
+				return nil, nil, nil, err
+			}
 		}
 
-		if err := s.client.NextPage(ctx, pages); err == spotify.ErrNoMorePages {
-			break
+		if isrc := track.ExternalIDs[isrcKey]; isrc != "" {
+			isrcList[track.ID.String()] = isrc
 		}
+
+		track := mapSpotifyTrack(track, artistList)
+		trackList = append(trackList, track)
+	}
+
+	return trackList, isrcList, warnings, nil
+}
+
+// lists the artists of a track, without enrichment
+func simpleArtistList(track spotify.FullTrack) []spotify.FullArtist {
+	out := make([]spotify.FullArtist, 0, len(track.Artists))
+	for _, artist := range track.Artists {
+		out = append(out, spotify.FullArtist{SimpleArtist: artist})
 	}
 
-	return trackList, nil
+	return out
 }
@@ -39,3 +39,32 @@ func (m *ClientMock) Search(ctx context.Context, query string,
 	args := m.Called(query)
 	return args.Get(0).(*spotify.SearchResult), args.Error(1)
 }
+
+func (m *ClientMock) GetTracks(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullTrack, error) {
+
+	args := m.Called(ids)
+	return args.Get(0).([]*spotify.FullTrack), args.Error(1)
+}
+
+func (m *ClientMock) GetAlbums(ctx context.Context, ids []spotify.ID,
+	opts ...spotify.RequestOption) ([]*spotify.FullAlbum, error) {
+
+	args := m.Called(ids)
+	return args.Get(0).([]*spotify.FullAlbum), args.Error(1)
+}
+
+func (m *ClientMock) GetArtists(ctx context.Context,
+	ids ...spotify.ID) ([]*spotify.FullArtist, error) {
+
+	args := m.Called(ids)
+	return args.Get(0).([]*spotify.FullArtist), args.Error(1)
+}
+
+func (m *ClientMock) GetArtistAlbums(ctx context.Context, artistID spotify.ID,
+	ts []spotify.AlbumType,
+	opts ...spotify.RequestOption) (*spotify.SimpleAlbumPage, error) {
+
+	args := m.Called(artistID)
+	return args.Get(0).(*spotify.SimpleAlbumPage), args.Error(1)
+}
@@ -0,0 +1,86 @@
+package myspotify
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// matches the featuring credits markers: ft, ft., feat, feat., featuring
+var featuringRegexp = regexp.MustCompile(`(?i)(^|\s)(ft\.?|feat\.?|featuring)(\s|$)`)
+
+// matches the punctuation that does not carry meaning for the
+// spotify search syntax: field filters (:), phrases ("),
+// exclusions (-), apostrophes and ampersands are kept
+var queryNoiseRegexp = regexp.MustCompile(`[^\p{L}\p{N}\s:"'&-]+`)
+
+var whitespaceRegexp = regexp.MustCompile(`\s+`)
+
+// foldUnicode removes the diacritics and the compatibility variants
+// of the characters (e.g. `Beyoncé` becomes `Beyonce`)
+func foldUnicode(s string) string {
+	t := transform.Chain(
+		norm.NFKD,
+		runes.Remove(runes.In(unicode.Mn)),
+		norm.NFC)
+
+	out, _, err := transform.String(t, s)
+	if err != nil {
+		return s
+	}
+
+	return out
+}
+
+// matches the tokens starting with a field qualifier, such as
+// artist:Beyoncé or -genre:pop, whose values are kept as is
+var fieldQualifierTokenRegexp = regexp.MustCompile(`(?i)^-?[a-z]+:`)
+
+// the operators of the spotify search syntax, uppercase only
+var queryOperators = map[string]bool{"AND": true, "OR": true, "NOT": true}
+
+// checks if the token of the query is an operator or a field qualifier
+func isQuerySyntax(token string) bool {
+	return queryOperators[token] || fieldQualifierTokenRegexp.MatchString(token)
+}
+
+// normalizeText folds the free text of a query: the unicode is folded,
+// the featuring credits are canonicalized, the noise punctuation is
+// stripped and the whitespaces collapsed
+func normalizeText(text string) string {
+	text = strings.ToLower(foldUnicode(text))
+	text = featuringRegexp.ReplaceAllString(text, " feat ")
+	text = queryNoiseRegexp.ReplaceAllString(text, " ")
+	text = whitespaceRegexp.ReplaceAllString(text, " ")
+
+	return strings.TrimSpace(text)
+}
+
+// normalizeQuery prepares a user query before it is sent to spotify,
+// normalizing its free text while keeping the operators and the
+// field qualifiers as they are
+func normalizeQuery(query string) string {
+	var out, text []string
+	flush := func() {
+		if normalized := normalizeText(strings.Join(text, " ")); normalized != "" {
+			out = append(out, normalized)
+		}
+		text = text[:0]
+	}
+
+	for _, token := range strings.Fields(query) {
+		if isQuerySyntax(token) {
+			flush()
+			out = append(out, token)
+			continue
+		}
+		text = append(text, token)
+	}
+	flush()
+
+	return strings.Join(out, " ")
+}
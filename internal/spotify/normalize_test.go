@@ -0,0 +1,103 @@
+package myspotify_test
+
+import (
+	"context"
+	"testing"
+
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestSearchWithOptions_withNormalizedQuery(t *testing.T) {
+
+	queryGiven := "  Beyoncé ft. Jay-Z!!  Crazy   in Love "
+	normalizedQueryGiven := "beyonce feat jay-z crazy in love"
+
+	artistIdGiven := spotify.ID("artist-id-1")
+	searchResultsGiven := getDuplicatedSearchResults(artistIdGiven)
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.
+		On("Search", normalizedQueryGiven+" genre:pop").
+		Return(searchResultsGiven, nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{
+			Query:        queryGiven,
+			GenreFilters: []string{"pop"},
+		})
+	assert.Nil(t, err)
+	assert.Len(t, result.Tracks, 4)
+	assert.Equal(t, normalizedQueryGiven+" genre:pop", result.EffectiveQuery)
+
+	clientGiven.AssertExpectations(t)
+	clientGiven.AssertNumberOfCalls(t, "Search", 1)
+}
+
+func TestSearchWithOptions_withFewNormalizedResults(t *testing.T) {
+
+	queryGiven := "Sigur Rós"
+	normalizedQueryGiven := "sigur ros"
+
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.
+		On("Search", normalizedQueryGiven).
+		Return(&spotify.SearchResult{Tracks: &spotify.FullTrackPage{}}, nil)
+	clientGiven.
+		On("Search", queryGiven).
+		Return(getSearchResults(artistIdGiven), nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{
+			Query: queryGiven,
+		})
+	assert.Nil(t, err)
+	assert.Len(t, result.Tracks, 2)
+	assert.Equal(t, queryGiven, result.EffectiveQuery)
+
+	clientGiven.AssertExpectations(t)
+	clientGiven.AssertNumberOfCalls(t, "Search", 2)
+}
+
+func TestSearchWithOptions_withQueryOperators(t *testing.T) {
+
+	tests := []struct {
+		query           string
+		normalizedQuery string
+	}{
+		{"Beyoncé NOT Jay-Z", "beyonce NOT jay-z"},
+		{"Sigur Rós OR Björk!", "sigur ros OR bjork"},
+		{"Crazy in Love artist:Beyoncé NOT year:2003", "crazy in love artist:Beyoncé NOT year:2003"},
+	}
+
+	for _, test := range tests {
+		artistIdGiven := spotify.ID("artist-id-1")
+
+		clientGiven := &mocks.ClientMock{}
+		clientGiven.
+			On("Search", test.normalizedQuery).
+			Return(getDuplicatedSearchResults(artistIdGiven), nil)
+		clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+		clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+		mySpotifyClient := newMySpotifyClient(clientGiven)
+		result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+			myspotify.SearchOptions{
+				Query: test.query,
+			})
+		assert.Nil(t, err)
+		assert.Equal(t, test.normalizedQuery, result.EffectiveQuery)
+
+		clientGiven.AssertExpectations(t)
+	}
+}
@@ -3,8 +3,11 @@ package myspotify
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 	"golang.org/x/oauth2/endpoints"
 
@@ -23,6 +26,11 @@ type providerImpl struct {
 func (p *providerImpl) NewClient(ctx context.Context,
 	clientId string, clientSecret string) (Client, time.Time, error) {
 
+	// the spotify http calls, token included, are traced
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	})
+
 	oauthConfig := clientcredentials.Config{
 		ClientID:     clientId,
 		ClientSecret: clientSecret,
@@ -0,0 +1,229 @@
+package myspotify
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// maximum number of words kept in the spelling dictionary
+	maxDictionarySize = 50000
+
+	// maximum edit distance for a word to be corrected
+	maxSpellingDistance = 2
+
+	// words shorter than this are never corrected
+	minSpellingWordLength = 4
+)
+
+// the field filters of the spotify search, telling if their value
+// is free text, kept once the qualifier is removed
+var searchFields = map[string]bool{
+	"album":  true,
+	"artist": true,
+	"track":  true,
+	"genre":  true,
+	"year":   false,
+	"upc":    false,
+	"isrc":   false,
+	"tag":    false,
+}
+
+// matches a token starting with a field qualifier, such as
+// `artist:gonzales` or `-genre:pop`
+var fieldQualifierRegexp = regexp.MustCompile(`(?i)^(-?)([a-z]+):(.*)$`)
+
+// removeFieldQualifiers removes the qualifiers of the known spotify fields:
+// the free text values are kept, while the exclusions and the other values
+// (e.g. `year:2020-2022`) are dropped along with their qualifier.
+// The other tokens, such as URLs, are kept as they are.
+func removeFieldQualifiers(query string) string {
+	out := make([]string, 0)
+	tokens := strings.Fields(query)
+	for i := 0; i < len(tokens); i++ {
+		match := fieldQualifierRegexp.FindStringSubmatch(tokens[i])
+		if match == nil {
+			out = append(out, tokens[i])
+			continue
+		}
+
+		freeText, known := searchFields[strings.ToLower(match[2])]
+		if !known {
+			out = append(out, tokens[i])
+			continue
+		}
+
+		// a quoted value spans the tokens until its closing quote
+		value := []string{match[3]}
+		if strings.HasPrefix(match[3], `"`) &&
+			(len(match[3]) == 1 || !strings.HasSuffix(match[3], `"`)) {
+			for i+1 < len(tokens) {
+				i++
+				value = append(value, tokens[i])
+				if strings.HasSuffix(tokens[i], `"`) {
+					break
+				}
+			}
+		}
+
+		if freeText && match[1] == "" && match[3] != "" {
+			out = append(out, value...)
+		}
+	}
+
+	return strings.Join(out, " ")
+}
+
+// relaxation is a less restrictive form of a search without results
+type relaxation struct {
+	step         string
+	query        string
+	genreFilters []string
+}
+
+// listRelaxations lists the relaxations of a search, from the least
+// to the most permissive: the genre filters are dropped one at a time,
+// then the field qualifiers are removed, then the spelling is corrected
+func listRelaxations(query string, genreFilters []string,
+	dictionary *nameDictionary) []relaxation {
+
+	out := make([]relaxation, 0)
+
+	// drop the genre filters one at a time, starting from the last one
+	for i := len(genreFilters) - 1; i >= 0; i-- {
+		out = append(out, relaxation{
+			step:         fmt.Sprintf("drop-genre:%s", genreFilters[i]),
+			query:        query,
+			genreFilters: genreFilters[:i],
+		})
+	}
+
+	// remove the field qualifiers
+	unqualifiedQuery := removeFieldQualifiers(query)
+	if unqualifiedQuery != query && unqualifiedQuery != "" {
+		out = append(out, relaxation{
+			step:  "remove-field-qualifiers",
+			query: unqualifiedQuery,
+		})
+		query = unqualifiedQuery
+	}
+
+	// correct the spelling from the names already seen
+	if correctedQuery := dictionary.correct(query); correctedQuery != query {
+		out = append(out, relaxation{
+			step:  "spelling-correction",
+			query: correctedQuery,
+		})
+	}
+
+	return out
+}
+
+// nameDictionary holds the words of the artist and track names
+// previously returned by spotify, used to correct the spelling of queries
+type nameDictionary struct {
+	mu    sync.RWMutex
+	words map[string]struct{}
+}
+
+func newNameDictionary() *nameDictionary {
+	return &nameDictionary{
+		words: make(map[string]struct{}),
+	}
+}
+
+func (d *nameDictionary) add(names ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, name := range names {
+		for _, word := range strings.Fields(normalizeTitle(name)) {
+			if len(d.words) >= maxDictionarySize {
+				return
+			}
+			d.words[word] = struct{}{}
+		}
+	}
+}
+
+func (d *nameDictionary) size() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.words)
+}
+
+func (d *nameDictionary) flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.words = make(map[string]struct{})
+}
+
+// correct replaces each unknown word of the query by
+// the closest known word, when close enough
+func (d *nameDictionary) correct(query string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	words := strings.Fields(query)
+	for i, word := range words {
+		if _, check := d.words[word]; check || len([]rune(word)) < minSpellingWordLength {
+			continue
+		}
+
+		bestWord := ""
+		bestDistance := maxSpellingDistance + 1
+		for candidate := range d.words {
+			distance := levenshtein(word, candidate, bestDistance)
+			if distance < bestDistance ||
+				(distance == bestDistance && candidate < bestWord) {
+				bestWord = candidate
+				bestDistance = distance
+			}
+		}
+
+		if bestWord != "" {
+			words[i] = bestWord
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// levenshtein computes the edit distance between two words,
+// giving up as soon as it exceeds the bound
+func levenshtein(a string, b string, bound int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > bound || -diff > bound {
+		return bound + 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			rowMin = min(rowMin, current[j])
+		}
+
+		if rowMin > bound {
+			return bound + 1
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
@@ -0,0 +1,128 @@
+package myspotify_test
+
+import (
+	"context"
+	"testing"
+
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+func getEmptySearchResults() *spotify.SearchResult {
+	return &spotify.SearchResult{
+		Tracks: &spotify.FullTrackPage{},
+	}
+}
+
+func TestSearchWithOptions_withGenreRelaxation(t *testing.T) {
+
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.
+		On("Search", "artist:gonzales genre:piano genre:jazz").
+		Return(getEmptySearchResults(), nil)
+	clientGiven.
+		On("Search", "artist:gonzales genre:piano").
+		Return(getSearchResults(artistIdGiven), nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{
+			Query:        "artist:gonzales",
+			GenreFilters: []string{"piano", "jazz"},
+		})
+	assert.Nil(t, err)
+	assert.Len(t, result.Tracks, 2)
+	assert.Equal(t, "drop-genre:jazz", result.Relaxation)
+	assert.Equal(t, "artist:gonzales genre:piano", result.EffectiveQuery)
+
+	clientGiven.AssertExpectations(t)
+}
+
+func TestSearchWithOptions_withSpellingRelaxation(t *testing.T) {
+
+	artistIdGiven := spotify.ID("artist-id-1")
+	searchResultsGiven := getSearchResults(artistIdGiven)
+	searchResultsGiven.Tracks.Tracks[0].Name = "Gonzales"
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", "gonzales").Return(searchResultsGiven, nil)
+	clientGiven.On("Search", "artist:gonzalez").Return(getEmptySearchResults(), nil)
+	clientGiven.On("Search", "gonzalez").Return(getEmptySearchResults(), nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+
+	// first search, learns the names
+	_, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{Query: "gonzales"})
+	assert.Nil(t, err)
+
+	// second search, misspelled
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{Query: "artist:gonzalez"})
+	assert.Nil(t, err)
+	assert.Len(t, result.Tracks, 2)
+	assert.Equal(t, "spelling-correction", result.Relaxation)
+	assert.Equal(t, "gonzales", result.EffectiveQuery)
+
+	clientGiven.AssertExpectations(t)
+}
+
+func TestSearchWithOptions_withoutRelaxationResults(t *testing.T) {
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", "unknown").Return(getEmptySearchResults(), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{Query: "unknown"})
+	assert.Nil(t, err)
+	assert.Empty(t, result.Tracks)
+	assert.Empty(t, result.Relaxation)
+}
+
+func TestSearchWithOptions_withQualifierRelaxation(t *testing.T) {
+
+	tests := []struct {
+		query        string
+		relaxedQuery string
+	}{
+		// the exclusions are dropped rather than turned into inclusions
+		{"artist:gonzales -genre:pop", "gonzales"},
+		{`crying -artist:"chilly gonzales" track:crying`, "crying crying"},
+		// the values which are not free text are dropped
+		{"gonzales year:2020-2022", "gonzales"},
+		// the unknown qualifiers are kept
+		{"gonzales spotify:track:abc label:gentle", "gonzales spotify:track:abc label:gentle"},
+	}
+
+	for _, test := range tests {
+		artistIdGiven := spotify.ID("artist-id-1")
+
+		clientGiven := &mocks.ClientMock{}
+		clientGiven.On("Search", test.query).Return(getEmptySearchResults(), nil)
+		clientGiven.On("Search", test.relaxedQuery).Return(getSearchResults(artistIdGiven), nil)
+		clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+		clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+		mySpotifyClient := newMySpotifyClient(clientGiven)
+		result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+			myspotify.SearchOptions{Query: test.query})
+		assert.Nil(t, err)
+
+		if test.query == test.relaxedQuery {
+			assert.Empty(t, result.Relaxation)
+			continue
+		}
+		assert.Equal(t, "remove-field-qualifiers", result.Relaxation)
+		assert.Equal(t, test.relaxedQuery, result.EffectiveQuery)
+	}
+}
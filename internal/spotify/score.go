@@ -0,0 +1,177 @@
+package myspotify
+
+import (
+	"sort"
+	"strings"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+)
+
+// ScoreBreakdown explains the relevance score of a track
+type ScoreBreakdown struct {
+	TrackID string  `json:"trackId"`
+	Score   float64 `json:"score"`
+
+	// UpstreamRank is the rank of the track in the spotify results, from 0
+	UpstreamRank int `json:"upstreamRank"`
+	// TitleMatch is the share of the query words found in the title
+	TitleMatch float64 `json:"titleMatch"`
+	// ArtistMatch is the share of the query words found in the artist names
+	ArtistMatch float64 `json:"artistMatch"`
+	// GenreMatch tells if a genre filter matched the enriched artist genres
+	GenreMatch bool  `json:"genreMatch"`
+	Popularity int32 `json:"popularity"`
+}
+
+// Scorer computes the relevance score of the tracks
+// from the weighted signals of the ScoreBreakdown
+type Scorer struct {
+	RankWeight       float64
+	TitleWeight      float64
+	ArtistWeight     float64
+	GenreWeight      float64
+	PopularityWeight float64
+}
+
+// DefaultScorer trusts the upstream rank the most,
+// then how well the query matched the track
+var DefaultScorer = Scorer{
+	RankWeight:       0.35,
+	TitleWeight:      0.25,
+	ArtistWeight:     0.2,
+	GenreWeight:      0.1,
+	PopularityWeight: 0.1,
+}
+
+// computes the share of the query words found in the text
+func matchRatio(queryWords []string, text string) float64 {
+	if len(queryWords) == 0 {
+		return 0
+	}
+
+	textWords := make(map[string]struct{})
+	for _, word := range strings.Fields(normalizeTitle(text)) {
+		textWords[word] = struct{}{}
+	}
+
+	found := 0
+	for _, word := range queryWords {
+		if _, check := textWords[word]; check {
+			found++
+		}
+	}
+
+	return float64(found) / float64(len(queryWords))
+}
+
+func matchGenres(genreFilters []string, track *pb.Track) bool {
+	for _, genre := range genreFilters {
+		genre = strings.ToLower(strings.TrimSpace(genre))
+		if genre == "" {
+			continue
+		}
+
+		for _, artist := range track.Artists {
+			for _, artistGenre := range artist.Genres {
+				if strings.Contains(strings.ToLower(artistGenre), genre) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// Score computes the relevance of a track ranked at the given
+// position of the upstream results
+func (sc Scorer) Score(query string, genreFilters []string,
+	rank int, total int, track *pb.Track) ScoreBreakdown {
+
+	// field qualifiers are not part of the matched words
+	queryWords := strings.Fields(normalizeTitle(
+		removeFieldQualifiers(query)))
+
+	artistNames := make([]string, 0, len(track.Artists))
+	for _, artist := range track.Artists {
+		artistNames = append(artistNames, artist.Name)
+	}
+
+	breakdown := ScoreBreakdown{
+		TrackID:      track.ID,
+		UpstreamRank: rank,
+		TitleMatch:   matchRatio(queryWords, track.Name),
+		ArtistMatch:  matchRatio(queryWords, strings.Join(artistNames, " ")),
+		GenreMatch:   matchGenres(genreFilters, track),
+		Popularity:   track.Popularity,
+	}
+
+	rankScore := 1.0
+	if total > 1 {
+		rankScore = 1 - float64(rank)/float64(total-1)
+	}
+
+	genreScore := 0.0
+	if breakdown.GenreMatch {
+		genreScore = 1
+	}
+
+	breakdown.Score = sc.RankWeight*rankScore +
+		sc.TitleWeight*breakdown.TitleMatch +
+		sc.ArtistWeight*breakdown.ArtistMatch +
+		sc.GenreWeight*genreScore +
+		sc.PopularityWeight*float64(track.Popularity)/100
+
+	return breakdown
+}
+
+// ScoreAll scores the tracks from their rank in the upstream results,
+// given by track ID along with the number of upstream results,
+// as the merged duplicates changed their position in the list
+func (sc Scorer) ScoreAll(query string, genreFilters []string,
+	trackList []*pb.Track, upstreamRanks map[string]int, upstreamTotal int) []ScoreBreakdown {
+
+	out := make([]ScoreBreakdown, 0, len(trackList))
+	for i, track := range trackList {
+		rank, check := upstreamRanks[track.ID]
+		if !check {
+			rank = i
+		}
+		out = append(out, sc.Score(query, genreFilters, rank, upstreamTotal, track))
+	}
+
+	return out
+}
+
+// lists the rank of the tracks by ID, in the upstream order
+func listUpstreamRanks(trackList []*pb.Track) map[string]int {
+	out := make(map[string]int, len(trackList))
+	for rank, track := range trackList {
+		if _, check := out[track.ID]; !check {
+			out[track.ID] = rank
+		}
+	}
+
+	return out
+}
+
+// Rank sorts the tracks and their scores by decreasing score
+func (sc Scorer) Rank(trackList []*pb.Track, scoreList []ScoreBreakdown) {
+	sort.Stable(byScore{trackList, scoreList})
+}
+
+type byScore struct {
+	trackList []*pb.Track
+	scoreList []ScoreBreakdown
+}
+
+func (b byScore) Len() int { return len(b.trackList) }
+
+func (b byScore) Less(i, j int) bool {
+	return b.scoreList[i].Score > b.scoreList[j].Score
+}
+
+func (b byScore) Swap(i, j int) {
+	b.trackList[i], b.trackList[j] = b.trackList[j], b.trackList[i]
+	b.scoreList[i], b.scoreList[j] = b.scoreList[j], b.scoreList[i]
+}
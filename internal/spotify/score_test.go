@@ -0,0 +1,88 @@
+package myspotify_test
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestScorer_Score(t *testing.T) {
+
+	trackGiven := &pb.Track{
+		ID:         "track-1",
+		Name:       "Crying - Remastered",
+		Popularity: 50,
+		Artists: []*pb.Artist{
+			{Name: "Chilly Gonzales", Genres: []string{"neo-classical piano"}},
+		},
+	}
+
+	breakdown := myspotify.DefaultScorer.Score(
+		"artist:gonzales crying", []string{"piano"}, 0, 1, trackGiven)
+	assert.Equal(t, "track-1", breakdown.TrackID)
+	assert.Equal(t, 0, breakdown.UpstreamRank)
+	assert.Equal(t, 0.5, breakdown.TitleMatch)
+	assert.Equal(t, 0.5, breakdown.ArtistMatch)
+	assert.True(t, breakdown.GenreMatch)
+	assert.InDelta(t, 0.35+0.125+0.1+0.1+0.05, breakdown.Score, 1e-9)
+}
+
+func TestSearchWithOptions_withRerank(t *testing.T) {
+
+	queryGiven := "other song"
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.
+		On("Search", queryGiven).
+		Return(getDuplicatedSearchResults(artistIdGiven), nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{
+			Query:  queryGiven,
+			Rerank: true,
+		})
+	assert.Nil(t, err)
+	assert.Len(t, result.Scores, len(result.Tracks))
+	for i, score := range result.Scores {
+		assert.Equal(t, result.Tracks[i].ID, score.TrackID)
+		if i > 0 {
+			assert.GreaterOrEqual(t, result.Scores[i-1].Score, score.Score)
+		}
+	}
+}
+
+func TestSearchWithOptions_withExplainAndDedup(t *testing.T) {
+
+	queryGiven := "song"
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.
+		On("Search", queryGiven).
+		Return(getDuplicatedSearchResults(artistIdGiven), nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{
+			Query:   queryGiven,
+			Dedup:   myspotify.DedupEarliest,
+			Explain: true,
+		})
+	assert.Nil(t, err)
+
+	// the ranks are the ones of spotify, before the duplicates were merged
+	assert.Equal(t, []string{"t2", "t4"}, trackIdList(result))
+	assert.Equal(t, 1, result.Scores[0].UpstreamRank)
+	assert.Equal(t, 3, result.Scores[1].UpstreamRank)
+}
@@ -5,11 +5,20 @@ import (
 	"fmt"
 
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/internal/tracing"
 	"github.com/zmb3/spotify/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
 	defaultSearchLimit = 10
+
+	// below this number of results, the normalized query
+	// is retried with its un-normalized form
+	fewResultsThreshold = 3
 )
 
 func addGenreListToQuery(query string, genreFilters []string) string {
@@ -25,34 +34,187 @@ func addGenreListToQuery(query string, genreFilters []string) string {
 func (s *MySpotifyImpl) Search(ctx context.Context,
 	query string, genreFilters []string, limit int) ([]*pb.Track, error) {
 
+	result, err := s.SearchWithOptions(ctx, SearchOptions{
+		Query:        query,
+		GenreFilters: genreFilters,
+		Limit:        limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Tracks, nil
+}
+
+func (s *MySpotifyImpl) SearchWithOptions(ctx context.Context,
+	opt SearchOptions) (result *SearchResult, err error) {
+
+	ctx, span := tracing.Start(ctx, "MySpotifyImpl.Search",
+		trace.WithAttributes(
+			attribute.String("search.query", opt.Query),
+			attribute.StringSlice("search.genre_filters", opt.GenreFilters),
+			attribute.Int("search.limit", opt.Limit)))
+	defer func() { tracing.End(span, err) }()
+
+	// validate query
+	if opt.Query == "" {
+		return nil, status.Error(codes.InvalidArgument, "provided query is empty")
+	}
+
+	// validate offset
+	if opt.Offset < 0 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"the offset must not be negative, got %d", opt.Offset)
+	}
+
 	if err := s.refresh(ctx); err != nil {
 		return nil, err
 	}
+	client := s.currentClient()
+
+	settings := s.settings()
 
 	// validate limit
+	limit := opt.Limit
 	if limit <= 0 {
-		limit = defaultSearchLimit
+		limit = settings.DefaultSearchLimit
 	}
 
-	// validate query
-	if query == "" {
-		return nil, fmt.Errorf("provided query is empty")
+	// normalize the query, falling back on the raw query
+	// when the normalization leaves nothing to search
+	normalizedQuery := normalizeQuery(opt.Query)
+	if normalizedQuery == "" {
+		normalizedQuery = opt.Query
+	}
+
+	// the enrichment calls made by every attempt of the search
+	enrichmentCalls := 0
+	defer func() { s.metrics.ObserveEnrichmentCalls(enrichmentCalls) }()
+
+	effectiveQuery := normalizedQuery
+	trackList, isrcList, warnings, err := s.searchTracks(ctx, client,
+		effectiveQuery, opt.GenreFilters, limit, opt.Offset, &enrichmentCalls)
+	if err != nil {
+		return nil, err
+	}
+
+	// too few results, retry with the query as typed by the user,
+	// when some time is left
+	if len(trackList) < min(limit, fewResultsThreshold) &&
+		normalizedQuery != opt.Query && !s.budget.exhausted(ctx) {
+
+		s.logger.InfoContext(ctx, "few results for normalized query, retrying with raw query",
+			"normalized_query", normalizedQuery, "query", opt.Query)
+
+		rawTrackList, rawIsrcList, rawWarnings, err := s.searchTracks(ctx, client,
+			opt.Query, opt.GenreFilters, limit, opt.Offset, &enrichmentCalls)
+		switch {
+		case err != nil && len(trackList) > 0 && s.budget.exhausted(ctx):
+			// keep the results of the normalized query
+			warnings = append(warnings, retryBudgetWarning)
+		case err != nil:
+			return nil, err
+		case len(rawTrackList) > len(trackList):
+			effectiveQuery = opt.Query
+			trackList = rawTrackList
+			isrcList = rawIsrcList
+			warnings = append(warnings, rawWarnings...)
+		}
+	}
+
+	// no results, relax the search until something is found
+	relaxationStep := ""
+	genreFilters := opt.GenreFilters
+	if len(trackList) == 0 && settings.Relaxation {
+		for _, r := range listRelaxations(effectiveQuery, genreFilters, s.dictionary) {
+			if s.budget.exhausted(ctx) {
+				warnings = append(warnings, relaxationBudgetWarning)
+				break
+			}
+
+			s.logger.InfoContext(ctx, "no results, relaxing the search",
+				"step", r.step)
+
+			var stepWarnings []string
+			trackList, isrcList, stepWarnings, err = s.searchTracks(ctx, client,
+				r.query, r.genreFilters, limit, opt.Offset, &enrichmentCalls)
+			if err != nil {
+				return nil, err
+			}
+			warnings = append(warnings, stepWarnings...)
+
+			if len(trackList) > 0 {
+				relaxationStep = r.step
+				effectiveQuery = r.query
+				genreFilters = r.genreFilters
+				break
+			}
+		}
+	}
+
+	if len(warnings) > 0 {
+		s.logger.WarnContext(ctx, "returning partial results", "warnings", warnings)
+	}
+
+	// merge the duplicated recordings, keeping the upstream ranks
+	upstreamRanks := listUpstreamRanks(trackList)
+	upstreamTotal := len(trackList)
+	trackList, alternates := dedupTracks(trackList, isrcList, opt.Dedup)
+
+	// score the tracks against the original request
+	var scoreList []ScoreBreakdown
+	if opt.Explain || opt.Rerank {
+		scoreList = s.scorer.ScoreAll(opt.Query, opt.GenreFilters,
+			trackList, upstreamRanks, upstreamTotal)
+		if opt.Rerank {
+			s.scorer.Rank(trackList, scoreList)
+		}
 	}
 
+	return &SearchResult{
+		Tracks:         trackList,
+		Alternates:     alternates,
+		EffectiveQuery: addGenreListToQuery(effectiveQuery, genreFilters),
+		Relaxation:     relaxationStep,
+		Scores:         scoreList,
+		Warnings:       warnings,
+	}, nil
+}
+
+// searches the tracks matching the query and the genres,
+// and enrich them with the full artist metadatas, counting
+// the enrichment calls in enrichmentCalls
+func (s *MySpotifyImpl) searchTracks(ctx context.Context, client Client,
+	query string, genreFilters []string, limit int, offset int,
+	enrichmentCalls *int,
+) ([]*pb.Track, map[string]string, []string, error) {
+
 	// format query with genre list
 	query = addGenreListToQuery(query, genreFilters)
 
-	// performs the search
-	s.logger.Printf("querying spotify with query `%v`", query)
-	results, err := s.client.Search(ctx, query, spotify.SearchTypeTrack, spotify.Limit(limit))
+	// performs the search, within its stage budget
+	s.logger.InfoContext(ctx, "querying spotify", "query", query)
+	searchCtx, cancel := s.budget.stageContext(ctx, s.budget.searchShare())
+	results, err := client.Search(searchCtx, query, spotify.SearchTypeTrack,
+		spotify.Limit(limit), spotify.Offset(offset))
+	cancel()
 	if err != nil {
-		return nil, fmt.Errorf("client.Search: %v", err)
+		return nil, nil, nil, fmt.Errorf("client.Search: %v", err)
 	}
 
-	trackList, err := s.pagesToTrackList(ctx, results.Tracks)
+	trackList, isrcList, warnings, err := s.pagesToTrackList(ctx, client, results.Tracks, enrichmentCalls)
 	if err != nil {
-		return nil, fmt.Errorf("pagesToTrackList: %v", err)
+		return nil, nil, nil, fmt.Errorf("pagesToTrackList: %v", err)
+	}
+
+	// learn the names for the spelling corrections and the suggestions
+	for _, track := range trackList {
+		s.dictionary.add(track.Name)
+		for _, artist := range track.Artists {
+			s.dictionary.add(artist.Name)
+		}
+		s.index.addTrack(track)
 	}
 
-	return trackList, nil
+	return trackList, isrcList, warnings, nil
 }
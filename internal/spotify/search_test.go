@@ -11,6 +11,8 @@ import (
 	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/zmb3/spotify/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func getArtist(artistId spotify.ID) *spotify.FullArtist {
@@ -152,6 +154,7 @@ func TestSearch_withGetArtistError(t *testing.T) {
 
 	clientGiven := &mocks.ClientMock{}
 	clientGiven.On("Search", queryGiven).Return(searchResultsGiven, nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
 	clientGiven.
 		On("GetArtist", artistIdGiven).
 		Return(&spotify.FullArtist{}, errorGiven)
@@ -166,25 +169,58 @@ func TestSearch_withGetArtistError(t *testing.T) {
 	clientGiven.AssertExpectations(t)
 }
 
-func TestSearch_withEmptyQuery(t *testing.T) {
+func TestSearch_withNextPageError(t *testing.T) {
 
 	ctxGiven := context.Background()
-	queryGiven := ""
+	queryGiven := "chilly gonzales crying"
 	genreListGiven := []string{}
 	limitGiven := 10
 
+	artistIdGiven := spotify.ID("artist-id-1")
+	searchResultsGiven := getSearchResults(artistIdGiven)
+	errorGiven := fmt.Errorf("failed to get next page")
+
 	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", queryGiven).Return(searchResultsGiven, nil)
+	clientGiven.On("NextPage").Return(errorGiven)
+
 	mySpotifyClient := newMySpotifyClient(clientGiven)
 	results, err := mySpotifyClient.Search(
 		ctxGiven, queryGiven, genreListGiven, limitGiven)
+	assert.Nil(t, results)
 	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "client.NextPage")
+
+	clientGiven.AssertExpectations(t)
+}
+
+func TestSearch_withEmptyQuery(t *testing.T) {
+
+	ctxGiven := context.Background()
+	queryGiven := ""
+	genreListGiven := []string{}
+	limitGiven := 10
+
+	providerGiven := &mocks.ProviderMock{}
+	mySpotifyClient := myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:     "client-id",
+		ClientSecret: "client-secret",
+		BaseLogger:   log.Default(),
+		Provider:     providerGiven,
+	})
+	results, err := mySpotifyClient.Search(
+		ctxGiven, queryGiven, genreListGiven, limitGiven)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 	assert.Nil(t, results)
+
+	// the query is validated before any token is requested
+	providerGiven.AssertNotCalled(t, "NewClient", "client-id", "client-secret")
 }
 
 func TestSearch_withNewClientError(t *testing.T) {
 
 	ctxGiven := context.Background()
-	queryGiven := ""
+	queryGiven := "chilly gonzales crying"
 	genreListGiven := []string{}
 	limitGiven := 10
 
@@ -213,3 +249,20 @@ func TestSearch_withNewClientError(t *testing.T) {
 
 	providerGiven.AssertExpectations(t)
 }
+
+func TestSearchWithOptions_withNegativeOffset(t *testing.T) {
+
+	providerGiven := &mocks.ProviderMock{}
+	mySpotifyClient := myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:     "client-id",
+		ClientSecret: "client-secret",
+		BaseLogger:   log.Default(),
+		Provider:     providerGiven,
+	})
+	result, err := mySpotifyClient.SearchWithOptions(context.Background(),
+		myspotify.SearchOptions{Query: "chilly gonzales", Offset: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Nil(t, result)
+
+	providerGiven.AssertNotCalled(t, "NewClient", "client-id", "client-secret")
+}
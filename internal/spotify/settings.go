@@ -0,0 +1,86 @@
+package myspotify
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Settings holds the settings of the spotify client
+// that can be changed while it runs
+type Settings struct {
+	// DefaultSearchLimit is the limit of the searches without one
+	DefaultSearchLimit int
+
+	// Relaxation relaxes the searches without results
+	Relaxation bool
+
+	// SuggestUpstreamFallback searches spotify for the
+	// suggestions when none is known
+	SuggestUpstreamFallback bool
+}
+
+// DefaultSettings enables every feature
+var DefaultSettings = Settings{
+	DefaultSearchLimit:      defaultSearchLimit,
+	Relaxation:              true,
+	SuggestUpstreamFallback: true,
+}
+
+// Validate checks the settings
+func (st Settings) Validate() error {
+	if st.DefaultSearchLimit <= 0 {
+		return fmt.Errorf("the default search limit must be positive, got %d",
+			st.DefaultSearchLimit)
+	}
+
+	return nil
+}
+
+func (s *MySpotifyImpl) settings() Settings {
+	return *s.currentSettings.Load()
+}
+
+// UpdateSettings replaces the settings, applied from the next requests
+func (s *MySpotifyImpl) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	s.currentSettings.Store(&settings)
+	s.logger.Info("settings updated",
+		"default_search_limit", settings.DefaultSearchLimit,
+		"relaxation", settings.Relaxation,
+		"suggest_upstream_fallback", settings.SuggestUpstreamFallback)
+
+	return nil
+}
+
+// UpdateCredentials replaces the spotify credentials. A token is
+// obtained with the new credentials before they replace the previous
+// ones, which are kept when it fails.
+func (s *MySpotifyImpl) UpdateCredentials(ctx context.Context,
+	clientId string, clientSecret string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if clientId == s.clientId && clientSecret == s.clientSecret {
+		return nil
+	}
+
+	client, expiryTime, err := s.provider.NewClient(ctx, clientId, clientSecret)
+	s.metrics.ObserveTokenRefresh(err)
+	if err != nil {
+		return fmt.Errorf("provider.NewClient: %v", err)
+	}
+
+	s.clientId = clientId
+	s.clientSecret = clientSecret
+	s.setClient(client, expiryTime)
+
+	s.logger.InfoContext(ctx, "spotify credentials rotated",
+		"expires_in", time.Until(s.tokenExpiryTime))
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package myspotify_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestUpdateCredentials_withSearchesRunning(t *testing.T) {
+
+	queryGiven := "chilly gonzales"
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	newClient := func() *mocks.ClientMock {
+		clientGiven := &mocks.ClientMock{}
+		clientGiven.On("Search", queryGiven).Return(getSearchResults(artistIdGiven), nil)
+		clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+		clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+		return clientGiven
+	}
+
+	expiryGiven := time.Now().Add(time.Minute)
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.On("NewClient", "client-id", "client-secret").Return(newClient(), expiryGiven, nil)
+	for i := 0; i < 10; i++ {
+		providerGiven.
+			On("NewClient", "client-id", fmt.Sprintf("client-secret-%d", i)).
+			Return(newClient(), expiryGiven, nil)
+	}
+
+	mySpotifyClient := myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:     "client-id",
+		ClientSecret: "client-secret",
+		BaseLogger:   log.New(io.Discard, "", 0),
+		Provider:     providerGiven,
+	})
+
+	// a first search gets the initial client
+	_, err := mySpotifyClient.Search(context.Background(), queryGiven, nil, 10)
+	assert.Nil(t, err)
+
+	// the credentials are rotated while the searches run
+	done := make(chan struct{})
+	rotated := make(chan struct{})
+	go func() {
+		defer close(rotated)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			err := mySpotifyClient.UpdateCredentials(context.Background(),
+				"client-id", fmt.Sprintf("client-secret-%d", i%10))
+			assert.Nil(t, err)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				trackList, err := mySpotifyClient.Search(context.Background(), queryGiven, nil, 10)
+				assert.Nil(t, err)
+				assert.Len(t, trackList, 2)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-rotated
+}
@@ -11,5 +11,85 @@ type MySpotify interface {
 		query string, genreFilters []string,
 		limit int) ([]*pb.Track, error)
 
+	SearchWithOptions(ctx context.Context,
+		opt SearchOptions) (*SearchResult, error)
+
 	GetGenreList(ctx context.Context) (*pb.GenreList, error)
+
+	Suggest(ctx context.Context,
+		prefix string, limit int) (*pb.Results, error)
+
+	// CheckReadiness checks that a spotify token can be
+	// obtained and the genre seed list loaded
+	CheckReadiness(ctx context.Context) error
+
+	// State describes the token and the caches
+	State() State
+
+	// FlushCache empties the named cache, or all of them
+	FlushCache(name string) error
+
+	// UpdateSettings replaces the runtime settings
+	UpdateSettings(settings Settings) error
+
+	// UpdateCredentials rotates the spotify credentials,
+	// forcing a token refresh
+	UpdateCredentials(ctx context.Context,
+		clientId string, clientSecret string) error
+
+	// GetTracks, GetAlbums and GetArtists look the entities
+	// up by ID, the ones not found being nil at their position
+	GetTracks(ctx context.Context, ids []string) ([]*pb.Track, error)
+	GetAlbums(ctx context.Context, ids []string) ([]*Album, error)
+	GetArtists(ctx context.Context, ids []string) ([]*pb.Artist, error)
+
+	GetArtistAlbums(ctx context.Context,
+		id string, limit int) ([]*pb.Album, error)
+}
+
+// SearchOptions holds the parameters of a track search
+type SearchOptions struct {
+	Query        string
+	GenreFilters []string
+	Limit        int
+
+	// Offset skips the first tracks found by spotify
+	Offset int
+
+	// Dedup groups the duplicated recordings of a track
+	// (remasters, reissues, compilations) into a single canonical track
+	Dedup DedupMode
+
+	// Explain computes the relevance score of each track
+	Explain bool
+
+	// Rerank sorts the tracks by relevance score
+	// instead of keeping the spotify order
+	Rerank bool
+}
+
+// SearchResult holds the tracks found by a search,
+// along with the metadatas describing how they were produced
+type SearchResult struct {
+	Tracks []*pb.Track
+
+	// Alternates lists, by canonical track ID, the IDs
+	// of the tracks that were merged into it by the dedup
+	Alternates map[string][]string
+
+	// EffectiveQuery is the query, normalized or not,
+	// that produced the tracks
+	EffectiveQuery string
+
+	// Relaxation is the relaxation step that produced the tracks,
+	// when the original search returned nothing
+	Relaxation string
+
+	// Scores holds the relevance score of each track, in the
+	// same order as Tracks, when explained or reranked
+	Scores []ScoreBreakdown
+
+	// Warnings tells why the tracks are partial,
+	// when a stage of the search ran out of time
+	Warnings []string
 }
@@ -0,0 +1,52 @@
+package myspotify
+
+import (
+	"fmt"
+	"time"
+)
+
+// the names of the caches held by MySpotifyImpl
+const (
+	DictionaryCache  = "dictionary"
+	SuggestionsCache = "suggestions"
+)
+
+// State describes the runtime state of the spotify client
+type State struct {
+	TokenExpiry  time.Time      `json:"tokenExpiry"`
+	RefreshCount int64          `json:"refreshCount"`
+	CacheSizes   map[string]int `json:"cacheSizes"`
+}
+
+func (s *MySpotifyImpl) State() State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return State{
+		TokenExpiry:  s.tokenExpiryTime,
+		RefreshCount: s.refreshCount,
+		CacheSizes: map[string]int{
+			DictionaryCache:  s.dictionary.size(),
+			SuggestionsCache: s.index.size(),
+		},
+	}
+}
+
+// FlushCache empties the named cache, or all of them when no name is given
+func (s *MySpotifyImpl) FlushCache(name string) error {
+	switch name {
+	case DictionaryCache:
+		s.dictionary.flush()
+	case SuggestionsCache:
+		s.index.flush()
+	case "":
+		s.dictionary.flush()
+		s.index.flush()
+	default:
+		return fmt.Errorf("unknown cache `%s`", name)
+	}
+
+	s.logger.Info("cache flushed", "cache", name)
+
+	return nil
+}
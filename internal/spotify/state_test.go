@@ -0,0 +1,47 @@
+package myspotify_test
+
+import (
+	"context"
+	"testing"
+
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestState(t *testing.T) {
+
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", "song").Return(getDuplicatedSearchResults(artistIdGiven), nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(getArtist(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	state := mySpotifyClient.State()
+	assert.Equal(t, int64(0), state.RefreshCount)
+
+	_, err := mySpotifyClient.Search(context.Background(), "song", nil, 10)
+	assert.Nil(t, err)
+
+	state = mySpotifyClient.State()
+	assert.Equal(t, int64(1), state.RefreshCount)
+	assert.Greater(t, state.CacheSizes[myspotify.DictionaryCache], 0)
+	assert.Greater(t, state.CacheSizes[myspotify.SuggestionsCache], 0)
+
+	err = mySpotifyClient.FlushCache(myspotify.SuggestionsCache)
+	assert.Nil(t, err)
+
+	state = mySpotifyClient.State()
+	assert.Greater(t, state.CacheSizes[myspotify.DictionaryCache], 0)
+	assert.Equal(t, 0, state.CacheSizes[myspotify.SuggestionsCache])
+
+	err = mySpotifyClient.FlushCache("")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, mySpotifyClient.State().CacheSizes[myspotify.DictionaryCache])
+
+	err = mySpotifyClient.FlushCache("unknown")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,297 @@
+package myspotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/zmb3/spotify/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultSuggestLimit = 8
+	maxSuggestLimit     = 20
+
+	// default maximum number of keys held by the prefix index
+	defaultPrefixIndexSize = 200000
+
+	// maximum number of index matches ranked for a suggestion
+	maxPrefixMatches = 500
+
+	// latency budget of the upstream fallback
+	suggestUpstreamTimeout = 400 * time.Millisecond
+)
+
+// suggestion is an artist, album or track of the prefix index
+type suggestion struct {
+	itemType pb.Type
+	id       string
+	name     string
+	key      string
+
+	artist *pb.Artist
+	album  *pb.Album
+	track  *pb.Track
+}
+
+type prefixIndexKey struct {
+	key string
+	id  string
+}
+
+// prefixIndex indexes the names of the artists, albums and tracks
+// already fetched from spotify by each of their word starts,
+// so that `gonz` suggests `Chilly Gonzales`.
+// Nothing is evicted: once full, the index is frozen until it is
+// flushed, through the admin server.
+type prefixIndex struct {
+	mu          sync.RWMutex
+	maxSize     int
+	keys        []prefixIndexKey
+	suggestions map[string]*suggestion
+}
+
+func newPrefixIndex(maxSize int) *prefixIndex {
+	if maxSize <= 0 {
+		maxSize = defaultPrefixIndexSize
+	}
+
+	return &prefixIndex{
+		maxSize:     maxSize,
+		keys:        make([]prefixIndexKey, 0),
+		suggestions: make(map[string]*suggestion),
+	}
+}
+
+// normalizes a name or a prefix for the index lookups
+func normalizePrefix(s string) string {
+	return strings.Join(strings.Fields(
+		titleNoiseRegexp.ReplaceAllString(strings.ToLower(foldUnicode(s)), " ")), " ")
+}
+
+func (idx *prefixIndex) add(items ...*suggestion) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, item := range items {
+		if item.id == "" || item.name == "" {
+			continue
+		}
+
+		id := fmt.Sprintf("%d:%s", item.itemType, item.id)
+		if _, check := idx.suggestions[id]; check {
+			continue
+		}
+
+		// index the name from each of its word starts,
+		// the items whose keys do not all fit being skipped
+		normalized := normalizePrefix(item.name)
+		words := strings.Fields(normalized)
+		if len(idx.keys)+len(words) > idx.maxSize {
+			continue
+		}
+
+		item.key = normalized
+		for i := range words {
+			key := prefixIndexKey{key: strings.Join(words[i:], " "), id: id}
+			pos := sort.Search(len(idx.keys), func(j int) bool {
+				return idx.keys[j].key >= key.key
+			})
+			idx.keys = append(idx.keys, prefixIndexKey{})
+			copy(idx.keys[pos+1:], idx.keys[pos:])
+			idx.keys[pos] = key
+		}
+		idx.suggestions[id] = item
+	}
+}
+
+func (idx *prefixIndex) size() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.suggestions)
+}
+
+func (idx *prefixIndex) flush() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.keys = make([]prefixIndexKey, 0)
+	idx.suggestions = make(map[string]*suggestion)
+}
+
+func (idx *prefixIndex) lookup(prefix string, limit int) []*suggestion {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	prefix = normalizePrefix(prefix)
+	if prefix == "" {
+		return nil
+	}
+
+	start := sort.Search(len(idx.keys), func(j int) bool {
+		return idx.keys[j].key >= prefix
+	})
+
+	// collect the matching items, the ones matching from
+	// the first word of their name first
+	seen := make(map[string]struct{})
+	matches := make([]*suggestion, 0)
+	for j := start; j < len(idx.keys) && len(matches) < maxPrefixMatches; j++ {
+		if !strings.HasPrefix(idx.keys[j].key, prefix) {
+			break
+		}
+		if _, check := seen[idx.keys[j].id]; check {
+			continue
+		}
+		seen[idx.keys[j].id] = struct{}{}
+		if item, check := idx.suggestions[idx.keys[j].id]; check {
+			matches = append(matches, item)
+		}
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool {
+		aFirst := strings.HasPrefix(matches[a].key, prefix)
+		bFirst := strings.HasPrefix(matches[b].key, prefix)
+		if aFirst != bFirst {
+			return aFirst
+		}
+		return len(matches[a].name) < len(matches[b].name)
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches
+}
+
+func (idx *prefixIndex) addTrack(track *pb.Track) {
+	items := []*suggestion{{
+		itemType: pb.Type_TRACK, id: track.ID, name: track.Name, track: track,
+	}}
+	if track.Album != nil {
+		items = append(items, &suggestion{
+			itemType: pb.Type_ALBUM, id: track.Album.ID, name: track.Album.Name,
+			album: track.Album,
+		})
+	}
+	for _, artist := range track.Artists {
+		items = append(items, &suggestion{
+			itemType: pb.Type_ARTIST, id: artist.ID, name: artist.Name,
+			artist: artist,
+		})
+	}
+
+	idx.add(items...)
+}
+
+func suggestionsToResults(suggestionList []*suggestion) *pb.Results {
+	results := &pb.Results{
+		Albums:  make([]*pb.Album, 0),
+		Artists: make([]*pb.Artist, 0),
+		Tracks:  make([]*pb.Track, 0),
+	}
+
+	for _, item := range suggestionList {
+		switch item.itemType {
+		case pb.Type_ARTIST:
+			results.Artists = append(results.Artists, item.artist)
+		case pb.Type_ALBUM:
+			results.Albums = append(results.Albums, item.album)
+		case pb.Type_TRACK:
+			results.Tracks = append(results.Tracks, item.track)
+		}
+	}
+
+	return results
+}
+
+// Suggest returns the artists, albums and tracks whose name starts
+// with the prefix. The suggestions come from the names already fetched,
+// with an upstream search as fallback when none is known.
+func (s *MySpotifyImpl) Suggest(ctx context.Context,
+	prefix string, limit int) (*pb.Results, error) {
+
+	// validate limit
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+	limit = min(limit, maxSuggestLimit)
+
+	// validate prefix
+	if normalizePrefix(prefix) == "" {
+		return nil, status.Error(codes.InvalidArgument, "provided prefix is empty")
+	}
+
+	suggestionList := s.index.lookup(prefix, limit)
+	if len(suggestionList) > 0 || !s.settings().SuggestUpstreamFallback {
+		return suggestionsToResults(suggestionList), nil
+	}
+
+	if err := s.refresh(ctx); err != nil {
+		return nil, err
+	}
+	client := s.currentClient()
+
+	// nothing known yet, fallback on spotify within the latency budget
+	ctx, cancel := context.WithTimeout(ctx, suggestUpstreamTimeout)
+	defer cancel()
+
+	results, err := client.Search(ctx, prefix,
+		spotify.SearchTypeArtist|spotify.SearchTypeAlbum|spotify.SearchTypeTrack,
+		spotify.Limit(limit))
+	if errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		s.logger.WarnContext(ctx, "suggest upstream fallback exceeded its budget",
+			"prefix", prefix)
+		return suggestionsToResults(nil), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("client.Search: %v", err)
+	}
+
+	s.index.add(searchResultToSuggestions(results)...)
+
+	return suggestionsToResults(s.index.lookup(prefix, limit)), nil
+}
+
+// converts the upstream search results, without enrichment
+func searchResultToSuggestions(results *spotify.SearchResult) []*suggestion {
+	out := make([]*suggestion, 0)
+
+	if results.Artists != nil {
+		for _, artist := range results.Artists.Artists {
+			out = append(out, &suggestion{
+				itemType: pb.Type_ARTIST, id: artist.ID.String(), name: artist.Name,
+				artist: mapSpotifyArtist(artist),
+			})
+		}
+	}
+
+	if results.Albums != nil {
+		for _, album := range results.Albums.Albums {
+			out = append(out, &suggestion{
+				itemType: pb.Type_ALBUM, id: album.ID.String(), name: album.Name,
+				album: mapSpotifyAlbum(album),
+			})
+		}
+	}
+
+	if results.Tracks != nil {
+		for _, track := range results.Tracks.Tracks {
+			out = append(out, &suggestion{
+				itemType: pb.Type_TRACK, id: track.ID.String(), name: track.Name,
+				track: mapSpotifyTrack(track, simpleArtistList(track)),
+			})
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,140 @@
+package myspotify_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSuggest_fromIndex(t *testing.T) {
+
+	artistIdGiven := spotify.ID("artist-id-1")
+	searchResultsGiven := getSearchResults(artistIdGiven)
+	searchResultsGiven.Tracks.Tracks[0].ID = "track-1"
+	searchResultsGiven.Tracks.Tracks[0].Name = "Gogol"
+	searchResultsGiven.Tracks.Tracks[1].ID = "track-2"
+	searchResultsGiven.Tracks.Tracks[1].Name = "Crying"
+
+	artistGiven := getArtist(artistIdGiven)
+	artistGiven.Name = "Chilly Gonzales"
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", "chilly gonzales").Return(searchResultsGiven, nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(artistGiven, nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	_, err := mySpotifyClient.Search(context.Background(), "chilly gonzales", nil, 10)
+	assert.Nil(t, err)
+
+	results, err := mySpotifyClient.Suggest(context.Background(), "Go", 10)
+	assert.Nil(t, err)
+	assert.Len(t, results.Tracks, 1)
+	assert.Equal(t, "Gogol", results.Tracks[0].Name)
+	assert.Len(t, results.Artists, 1)
+	assert.Equal(t, "Chilly Gonzales", results.Artists[0].Name)
+
+	// the index is used, spotify is called by the search only
+	clientGiven.AssertNumberOfCalls(t, "Search", 1)
+}
+
+func TestSuggest_withUpstreamFallback(t *testing.T) {
+
+	searchResultsGiven := &spotify.SearchResult{
+		Artists: &spotify.FullArtistPage{
+			Artists: []spotify.FullArtist{
+				*getArtist("artist-id-1"),
+			},
+		},
+		Albums: &spotify.SimpleAlbumPage{
+			Albums: []spotify.SimpleAlbum{
+				{ID: "album-id-1", Name: "Solo Piano"},
+			},
+		},
+	}
+	searchResultsGiven.Artists.Artists[0].Name = "Sonic Youth"
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", "so").Return(searchResultsGiven, nil)
+
+	mySpotifyClient := newMySpotifyClient(clientGiven)
+	results, err := mySpotifyClient.Suggest(context.Background(), "so", 5)
+	assert.Nil(t, err)
+	assert.Len(t, results.Artists, 1)
+	assert.Len(t, results.Albums, 1)
+	assert.Empty(t, results.Tracks)
+
+	clientGiven.AssertExpectations(t)
+}
+
+func TestSuggest_withEmptyPrefix(t *testing.T) {
+
+	mySpotifyClient := newMySpotifyClient(&mocks.ClientMock{})
+	results, err := mySpotifyClient.Suggest(context.Background(), " !", 5)
+	assert.Nil(t, results)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestSuggest_withFullIndex(t *testing.T) {
+
+	artistIdGiven := spotify.ID("artist-id-1")
+	searchResultsGiven := getSearchResults(artistIdGiven)
+	searchResultsGiven.Tracks.Tracks = searchResultsGiven.Tracks.Tracks[:1]
+	searchResultsGiven.Tracks.Tracks[0].ID = "track-1"
+	searchResultsGiven.Tracks.Tracks[0].Name = "Gogol"
+	searchResultsGiven.Tracks.Tracks[0].Album.Name = "Solo Piano Extended Edition"
+
+	artistGiven := getArtist(artistIdGiven)
+	artistGiven.Name = "Chilly Gonzales"
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", "chilly gonzales").Return(searchResultsGiven, nil)
+	clientGiven.On("GetArtist", artistIdGiven).Return(artistGiven, nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.
+		On("NewClient", "client-id", "client-secret").
+		Return(clientGiven, time.Now().Add(time.Minute), nil)
+
+	settingsGiven := myspotify.DefaultSettings
+	settingsGiven.SuggestUpstreamFallback = false
+	mySpotifyClient := myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:         "client-id",
+		ClientSecret:     "client-secret",
+		BaseLogger:       log.New(io.Discard, "", 0),
+		Provider:         providerGiven,
+		Settings:         &settingsGiven,
+		SuggestIndexSize: 4,
+	})
+	_, err := mySpotifyClient.Search(context.Background(), "chilly gonzales", nil, 10)
+	assert.Nil(t, err)
+
+	// the album, whose 4 keys do not fit after the track, is skipped
+	// as a whole, and the artist after it is still indexed
+	results, err := mySpotifyClient.Suggest(context.Background(), "ext", 10)
+	assert.Nil(t, err)
+	assert.Empty(t, results.Albums)
+
+	results, err = mySpotifyClient.Suggest(context.Background(), "gon", 10)
+	assert.Nil(t, err)
+	assert.Len(t, results.Artists, 1)
+
+	results, err = mySpotifyClient.Suggest(context.Background(), "gog", 10)
+	assert.Nil(t, err)
+	assert.Len(t, results.Tracks, 1)
+
+	// the index is frozen until flushed
+	assert.Equal(t, 2, mySpotifyClient.State().CacheSizes[myspotify.SuggestionsCache])
+	assert.Nil(t, mySpotifyClient.FlushCache(myspotify.SuggestionsCache))
+	assert.Equal(t, 0, mySpotifyClient.State().CacheSizes[myspotify.SuggestionsCache])
+}
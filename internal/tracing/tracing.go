@@ -0,0 +1,108 @@
+// Package tracing sets up the OpenTelemetry tracing of the service,
+// exporting the spans to an OTLP collector or to the standard output.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer of the service
+const TracerName = "github.com/planetfall/musicresearcher"
+
+// the available exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+type Options struct {
+	// Exporter is one of none, stdout or otlp
+	Exporter string
+
+	// OTLPEndpoint is the host:port of the OTLP gRPC collector,
+	// the OTEL_EXPORTER_OTLP_ENDPOINT environment variable is used when empty
+	OTLPEndpoint string
+
+	ServiceName string
+}
+
+// Tracer returns the tracer of the service
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Start starts a span from the context, using the tracer of the service
+func Start(ctx context.Context, name string,
+	opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// End records the error on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func newExporter(ctx context.Context, opt Options) (sdktrace.SpanExporter, error) {
+	switch opt.Exporter {
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+	case ExporterOTLP:
+		opts := make([]otlptracegrpc.Option, 0)
+		if opt.OTLPEndpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(opt.OTLPEndpoint))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	return nil, fmt.Errorf("unknown trace exporter `%s`", opt.Exporter)
+}
+
+// Setup installs the global tracer provider and the trace context
+// propagator. It returns the function flushing and stopping the exporter.
+func Setup(ctx context.Context, opt Options) (func(context.Context) error, error) {
+
+	// the trace context is propagated even when the spans are not exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	if opt.Exporter == "" || opt.Exporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx, opt)
+	if err != nil {
+		return nil, fmt.Errorf("newExporter: %v", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL, semconv.ServiceName(opt.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("resource.Merge: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,33 @@
+package tracing_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/planetfall/musicresearcher/internal/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetup(t *testing.T) {
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    tracing.ExporterStdout,
+		ServiceName: "music-researcher",
+	})
+	assert.Nil(t, err)
+
+	_, span := tracing.Start(context.Background(), "span")
+	assert.True(t, span.SpanContext().IsValid())
+	tracing.End(span, fmt.Errorf("failed"))
+
+	assert.Nil(t, shutdown(context.Background()))
+}
+
+func TestSetup_withUnknownExporter(t *testing.T) {
+
+	_, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter: "zipkin",
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,207 @@
+// Package extension holds the client and server bindings of the
+// MusicResearcherExtension service, declared in api/music_researcher.proto.
+//
+// The service only uses the messages of the MusicResearcher service,
+// so its bindings are written by hand on top of the generated messages
+// of github.com/planetfall/genproto, until they are generated as well.
+package extension
+
+import (
+	"context"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const ServiceName = "musicresearcher.MusicResearcherExtension"
+
+const (
+	SuggestMethod        = "/" + ServiceName + "/Suggest"
+	GetArtistMethod      = "/" + ServiceName + "/GetArtist"
+	GetAlbumMethod       = "/" + ServiceName + "/GetAlbum"
+	LookupMethod         = "/" + ServiceName + "/Lookup"
+	ExportPlaylistMethod = "/" + ServiceName + "/ExportPlaylist"
+)
+
+// MusicResearcherExtensionClient is the client API for MusicResearcherExtension service.
+type MusicResearcherExtensionClient interface {
+	Suggest(ctx context.Context, in *pb.Parameters, opts ...grpc.CallOption) (*pb.Results, error)
+	GetArtist(ctx context.Context, in *pb.Parameters, opts ...grpc.CallOption) (*pb.Results, error)
+	GetAlbum(ctx context.Context, in *pb.Parameters, opts ...grpc.CallOption) (*pb.Results, error)
+	Lookup(ctx context.Context, in *pb.Parameters, opts ...grpc.CallOption) (*pb.Results, error)
+	ExportPlaylist(ctx context.Context, in *pb.Parameters, opts ...grpc.CallOption) (*httpbody.HttpBody, error)
+}
+
+type musicResearcherExtensionClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMusicResearcherExtensionClient(cc grpc.ClientConnInterface) MusicResearcherExtensionClient {
+	return &musicResearcherExtensionClient{cc}
+}
+
+func (c *musicResearcherExtensionClient) Suggest(ctx context.Context,
+	in *pb.Parameters, opts ...grpc.CallOption) (*pb.Results, error) {
+
+	return c.invoke(ctx, SuggestMethod, in, opts...)
+}
+
+func (c *musicResearcherExtensionClient) GetArtist(ctx context.Context,
+	in *pb.Parameters, opts ...grpc.CallOption) (*pb.Results, error) {
+
+	return c.invoke(ctx, GetArtistMethod, in, opts...)
+}
+
+func (c *musicResearcherExtensionClient) GetAlbum(ctx context.Context,
+	in *pb.Parameters, opts ...grpc.CallOption) (*pb.Results, error) {
+
+	return c.invoke(ctx, GetAlbumMethod, in, opts...)
+}
+
+func (c *musicResearcherExtensionClient) Lookup(ctx context.Context,
+	in *pb.Parameters, opts ...grpc.CallOption) (*pb.Results, error) {
+
+	return c.invoke(ctx, LookupMethod, in, opts...)
+}
+
+func (c *musicResearcherExtensionClient) ExportPlaylist(ctx context.Context,
+	in *pb.Parameters, opts ...grpc.CallOption) (*httpbody.HttpBody, error) {
+
+	out := new(httpbody.HttpBody)
+	if err := c.cc.Invoke(ctx, ExportPlaylistMethod, in, out, opts...); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (c *musicResearcherExtensionClient) invoke(ctx context.Context,
+	method string, in *pb.Parameters, opts ...grpc.CallOption) (*pb.Results, error) {
+
+	out := new(pb.Results)
+	if err := c.cc.Invoke(ctx, method, in, out, opts...); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// MusicResearcherExtensionServer is the server API for MusicResearcherExtension service.
+// All implementations must embed UnimplementedMusicResearcherExtensionServer
+// for forward compatibility
+type MusicResearcherExtensionServer interface {
+	// Suggest returns the artists, albums and tracks whose name
+	// starts with the query, used as a prefix
+	Suggest(context.Context, *pb.Parameters) (*pb.Results, error)
+	// GetArtist returns the artist whose ID is the query,
+	// along with its albums, up to the limit
+	GetArtist(context.Context, *pb.Parameters) (*pb.Results, error)
+	// GetAlbum returns the album whose ID is the query,
+	// along with its artists and its tracks
+	GetAlbum(context.Context, *pb.Parameters) (*pb.Results, error)
+	// Lookup returns the tracks, albums and artists referenced by the query,
+	// a list of spotify IDs, URIs or URLs separated by commas or spaces
+	Lookup(context.Context, *pb.Parameters) (*pb.Results, error)
+	// ExportPlaylist encodes as a playlist the tracks whose IDs are in the
+	// x-track-ids metadata, or else the tracks found by the search
+	ExportPlaylist(context.Context, *pb.Parameters) (*httpbody.HttpBody, error)
+	mustEmbedUnimplementedMusicResearcherExtensionServer()
+}
+
+// UnimplementedMusicResearcherExtensionServer must be embedded to have forward compatible implementations.
+type UnimplementedMusicResearcherExtensionServer struct {
+}
+
+func (UnimplementedMusicResearcherExtensionServer) Suggest(context.Context, *pb.Parameters) (*pb.Results, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Suggest not implemented")
+}
+func (UnimplementedMusicResearcherExtensionServer) GetArtist(context.Context, *pb.Parameters) (*pb.Results, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetArtist not implemented")
+}
+func (UnimplementedMusicResearcherExtensionServer) GetAlbum(context.Context, *pb.Parameters) (*pb.Results, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAlbum not implemented")
+}
+func (UnimplementedMusicResearcherExtensionServer) Lookup(context.Context, *pb.Parameters) (*pb.Results, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lookup not implemented")
+}
+func (UnimplementedMusicResearcherExtensionServer) ExportPlaylist(context.Context, *pb.Parameters) (*httpbody.HttpBody, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportPlaylist not implemented")
+}
+func (UnimplementedMusicResearcherExtensionServer) mustEmbedUnimplementedMusicResearcherExtensionServer() {
+}
+
+func RegisterMusicResearcherExtensionServer(s grpc.ServiceRegistrar, srv MusicResearcherExtensionServer) {
+	s.RegisterService(&MusicResearcherExtension_ServiceDesc, srv)
+}
+
+// methodHandler is the signature of grpc.MethodDesc.Handler
+type methodHandler = func(srv interface{}, ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor) (interface{}, error)
+
+// unaryHandler builds the grpc handler of an unary method
+func unaryHandler[Req any, Res any](fullMethod string,
+	call func(MusicResearcherExtensionServer, context.Context, *Req) (*Res, error),
+) methodHandler {
+
+	return func(srv interface{}, ctx context.Context,
+		dec func(interface{}) error,
+		interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+
+		in := new(Req)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(MusicResearcherExtensionServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: fullMethod,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(MusicResearcherExtensionServer), ctx, req.(*Req))
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+// MusicResearcherExtension_ServiceDesc is the grpc.ServiceDesc for MusicResearcherExtension service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MusicResearcherExtension_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*MusicResearcherExtensionServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Suggest",
+			Handler: unaryHandler(SuggestMethod,
+				MusicResearcherExtensionServer.Suggest),
+		},
+		{
+			MethodName: "GetArtist",
+			Handler: unaryHandler(GetArtistMethod,
+				MusicResearcherExtensionServer.GetArtist),
+		},
+		{
+			MethodName: "GetAlbum",
+			Handler: unaryHandler(GetAlbumMethod,
+				MusicResearcherExtensionServer.GetAlbum),
+		},
+		{
+			MethodName: "Lookup",
+			Handler: unaryHandler(LookupMethod,
+				MusicResearcherExtensionServer.Lookup),
+		},
+		{
+			MethodName: "ExportPlaylist",
+			Handler: unaryHandler(ExportPlaylistMethod,
+				MusicResearcherExtensionServer.ExportPlaylist),
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api/music_researcher.proto",
+}
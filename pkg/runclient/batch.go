@@ -0,0 +1,820 @@
+package runclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/spf13/cobra"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the input formats of the batch
+const (
+	inputLines = "lines"
+	inputCSV   = "csv"
+	inputTSV   = "tsv"
+)
+
+// the match statuses of the batch rows
+const (
+	statusMatched   = "matched"
+	statusUncertain = "uncertain"
+	statusFound     = "found"
+	statusNotFound  = "not_found"
+	statusError     = "error"
+)
+
+const (
+	defaultBatchConcurrency = 4
+	defaultBatchRate        = 5
+	defaultBatchRetries     = 2
+	defaultBatchLimit       = 5
+
+	// the first retry waits for this delay, doubled at each retry
+	batchRetryDelay = 500 * time.Millisecond
+
+	// the maximum number of failures listed by the summary
+	maxSummaryFailures = 20
+
+	// separates the artist from the title in the input lines
+	artistTitleSeparator = " - "
+)
+
+// the columns of the batch rows
+var batchFields = []string{
+	"line", "query", "status", "track_id", "track", "artists", "album", "spotify_url", "error",
+}
+
+// batchInput is a query of the batch, along with
+// the expected artist and title when they are known
+type batchInput struct {
+	Line   int
+	Query  string
+	Artist string
+	Title  string
+}
+
+// batchRow is the result of a query of the batch
+type batchRow struct {
+	Line       int    `json:"line"`
+	Query      string `json:"query"`
+	Status     string `json:"status"`
+	TrackID    string `json:"trackId,omitempty"`
+	Track      string `json:"track,omitempty"`
+	Artists    string `json:"artists,omitempty"`
+	Album      string `json:"album,omitempty"`
+	SpotifyUrl string `json:"spotifyUrl,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	err error
+}
+
+func (r *batchRow) values() []string {
+	return []string{
+		strconv.Itoa(r.Line), r.Query, r.Status, r.TrackID, r.Track,
+		r.Artists, r.Album, r.SpotifyUrl, r.Error,
+	}
+}
+
+// BatchOptions are the flags of the batch subcommand
+type BatchOptions struct {
+	Input        string
+	InputFormat  string
+	QueryColumns []string
+	Results      string
+	Checkpoint   string
+
+	GenreFilters []string
+	Limit        int32
+	Concurrency  int
+	Rate         float64
+	Retries      int
+}
+
+func newBatchCommand(c *client) *cobra.Command {
+	opt := &BatchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "batch",
+		Short: "Searches the queries of a file, one result row per query",
+		Long: "Searches the queries of a file, or of the standard input, with a bounded concurrency\n" +
+			"and rate, and writes one result row per query along with its match status:\n" +
+			"  matched    a track has the expected title and artist\n" +
+			"  uncertain  tracks were found, none with the expected title and artist\n" +
+			"  found      tracks were found, the query having no expected title and artist\n" +
+			"  not_found  no track was found\n" +
+			"  error      the search failed\n\n" +
+			"The lines \"artist - title\", and the csv or tsv rows with artist and title columns,\n" +
+			"have an expected title and artist. The rows are written as CSV, or as NDJSON with -o ndjson.\n" +
+			"With --checkpoint, the processed lines are recorded, and skipped when the batch is run again,\n" +
+			"the failed lines being searched again, and their previous rows removed from the results.\n" +
+			"The checkpoint of another input is refused.",
+		Example: "  musicresearcher batch --input tracks.txt --results results.csv --checkpoint tracks.checkpoint",
+		Args:    usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := opt.validate(c.out.Format); err != nil {
+				return usageError{err}
+			}
+
+			return runBatch(cmd, c, opt)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opt.Input, "input", "-", "the file of the queries, the standard input when -")
+	flags.StringVar(&opt.InputFormat, "input-format", "",
+		"the format of the input: lines, csv or tsv, from the file extension by default")
+	flags.StringSliceVar(&opt.QueryColumns, "query-columns", nil,
+		"the csv or tsv columns joined into the query, by default query, or else artist and title, or else the first column")
+	flags.StringVar(&opt.Results, "results", "", "the file of the result rows, the standard output when empty")
+	flags.StringVar(&opt.Checkpoint, "checkpoint", "", "the file recording the processed lines, to resume the batch")
+	flags.StringSliceVarP(&opt.GenreFilters, "genre", "g", nil, "the genres to filter, for every query")
+	flags.Int32VarP(&opt.Limit, "limit", "l", defaultBatchLimit, "the number of tracks searched for a match")
+	flags.IntVar(&opt.Concurrency, "concurrency", defaultBatchConcurrency, "the maximum number of concurrent searches")
+	flags.Float64Var(&opt.Rate, "rate", defaultBatchRate, "the maximum number of searches per second, unlimited when 0")
+	flags.IntVar(&opt.Retries, "retries", defaultBatchRetries,
+		"the retries of a search failing with UNAVAILABLE or RESOURCE_EXHAUSTED")
+
+	_ = cmd.RegisterFlagCompletionFunc("input-format", cobra.FixedCompletions(
+		[]string{inputLines, inputCSV, inputTSV}, cobra.ShellCompDirectiveNoFileComp))
+
+	return cmd
+}
+
+func (opt *BatchOptions) validate(outputFormat string) error {
+	if outputFormat != formatTable && outputFormat != formatCSV && outputFormat != formatNDJSON {
+		return fmt.Errorf("the batch rows are written as csv or ndjson, not %s", outputFormat)
+	}
+
+	switch opt.InputFormat {
+	case "", inputLines, inputCSV, inputTSV:
+	default:
+		return fmt.Errorf("unknown input format %q, expected lines, csv or tsv", opt.InputFormat)
+	}
+
+	if opt.Concurrency <= 0 {
+		return fmt.Errorf("the concurrency must be positive")
+	}
+	if opt.Rate < 0 || opt.Retries < 0 || opt.Limit < 0 {
+		return fmt.Errorf("the rate, the retries and the limit must not be negative")
+	}
+
+	return nil
+}
+
+// returns the format of the input, from its extension by default
+func (opt *BatchOptions) inputFormat() string {
+	if opt.InputFormat != "" {
+		return opt.InputFormat
+	}
+
+	switch strings.ToLower(filepath.Ext(opt.Input)) {
+	case ".csv":
+		return inputCSV
+	case ".tsv":
+		return inputTSV
+	default:
+		return inputLines
+	}
+}
+
+// splits an "artist - title" line
+func splitArtistTitle(line string) (string, string) {
+	artist, title, check := strings.Cut(line, artistTitleSeparator)
+	if !check {
+		return "", ""
+	}
+
+	return strings.TrimSpace(artist), strings.TrimSpace(title)
+}
+
+// newInput creates the input of the query, searched as "artist title"
+// when the artist and the title are known
+func newInput(line int, query string, artist string, title string) batchInput {
+	if artist != "" && title != "" {
+		query = artist + " " + title
+	}
+
+	return batchInput{Line: line, Query: query, Artist: artist, Title: title}
+}
+
+// reads the queries of the plain lines, the empty lines
+// and the lines starting with # being skipped
+func readLines(r io.Reader) ([]batchInput, error) {
+	var inputList []batchInput
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		artist, title := splitArtistTitle(text)
+		inputList = append(inputList, newInput(line, text, artist, title))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanner.Scan: %v", err)
+	}
+
+	return inputList, nil
+}
+
+// reads the queries of the csv or tsv rows, the first row being the header
+func readRecords(r io.Reader, comma rune, queryColumns []string) ([]batchInput, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	column := func(record []string, name string) string {
+		i, check := columns[name]
+		if !check || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	// the columns of the query
+	_, hasQuery := columns["query"]
+	_, hasArtist := columns["artist"]
+	_, hasTitle := columns["title"]
+	for _, name := range queryColumns {
+		if _, check := columns[strings.ToLower(name)]; !check {
+			return nil, fmt.Errorf("no column %q in the header", name)
+		}
+	}
+
+	var inputList []batchInput
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the line %d: %v", line, err)
+		}
+
+		artist, title := column(record, "artist"), column(record, "title")
+
+		var input batchInput
+		switch {
+		case len(queryColumns) > 0:
+			parts := make([]string, 0, len(queryColumns))
+			for _, name := range queryColumns {
+				if value := column(record, strings.ToLower(name)); value != "" {
+					parts = append(parts, value)
+				}
+			}
+			input = batchInput{Line: line, Query: strings.Join(parts, " "),
+				Artist: artist, Title: title}
+		case hasQuery:
+			input = batchInput{Line: line, Query: column(record, "query"),
+				Artist: artist, Title: title}
+		case hasArtist && hasTitle:
+			input = newInput(line, strings.TrimSpace(artist+" "+title), artist, title)
+		default:
+			input = batchInput{Line: line, Query: strings.TrimSpace(record[0])}
+		}
+
+		if input.Query != "" {
+			inputList = append(inputList, input)
+		}
+	}
+
+	return inputList, nil
+}
+
+// reads the queries of the input
+func (opt *BatchOptions) readInputs(stdin io.Reader) ([]batchInput, error) {
+	r := stdin
+	if opt.Input != "-" {
+		f, err := os.Open(opt.Input)
+		if err != nil {
+			return nil, fmt.Errorf("os.Open: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	switch opt.inputFormat() {
+	case inputCSV:
+		return readRecords(r, ',', opt.QueryColumns)
+	case inputTSV:
+		return readRecords(r, '\t', opt.QueryColumns)
+	default:
+		return readLines(r)
+	}
+}
+
+// the hash of the query of a line, recorded by the checkpoint
+// so that a checkpoint of another input is refused
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:8])
+}
+
+// reads the lines recorded by the checkpoint, along with the hash
+// of their query, none when it does not exist
+func readCheckpoint(path string) (map[int]string, error) {
+	done := make(map[int]string)
+	if path == "" {
+		return done, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.Open: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// a line cut by an interruption is ignored
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || len(fields[1]) != len(queryHash("")) {
+			continue
+		}
+		if line, err := strconv.Atoi(fields[0]); err == nil {
+			done[line] = fields[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanner.Scan: %v", err)
+	}
+
+	return done, nil
+}
+
+// checks that the lines of the checkpoint are lines of the input,
+// with the same query
+func checkCheckpoint(done map[int]string, inputList []batchInput) error {
+	queries := make(map[int]string, len(inputList))
+	for _, input := range inputList {
+		queries[input.Line] = input.Query
+	}
+
+	for line, hash := range done {
+		query, check := queries[line]
+		if !check || queryHash(query) != hash {
+			return fmt.Errorf("the checkpoint does not match the input at the line %d, "+
+				"remove it to run the batch again", line)
+		}
+	}
+
+	return nil
+}
+
+// folds the text for the matching: lowercase, without diacritics
+// and without punctuation
+func matchKey(text string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if folded, _, err := transform.String(t, text); err == nil {
+		text = folded
+	}
+
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// reports whether the track has the expected title, possibly
+// followed by a version (e.g. "Gogol - Remastered"), and artist
+func matches(track *pb.Track, artist string, title string) bool {
+	trackTitle, expectedTitle := matchKey(track.Name), matchKey(title)
+	if expectedTitle == "" || !strings.HasPrefix(trackTitle, expectedTitle) {
+		return false
+	}
+
+	expectedArtist := matchKey(artist)
+	for _, a := range track.Artists {
+		if name := matchKey(a.Name); name != "" &&
+			(strings.Contains(name, expectedArtist) || strings.Contains(expectedArtist, name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newRow creates the row of the tracks found for the input
+func newRow(input batchInput, trackList []*pb.Track) *batchRow {
+	row := &batchRow{Line: input.Line, Query: input.Query}
+	if len(trackList) == 0 {
+		row.Status = statusNotFound
+		return row
+	}
+
+	track := trackList[0]
+	switch {
+	case input.Artist == "" || input.Title == "":
+		row.Status = statusFound
+	default:
+		row.Status = statusUncertain
+		for _, t := range trackList {
+			if matches(t, input.Artist, input.Title) {
+				row.Status = statusMatched
+				track = t
+				break
+			}
+		}
+	}
+
+	row.TrackID = track.ID
+	row.Track = track.Name
+	row.Artists = artistNames(track.Artists)
+	row.Album = track.GetAlbum().GetName()
+	row.SpotifyUrl = track.SpotifyUrl
+
+	return row
+}
+
+// reports whether the error of a search is worth a retry
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
+
+// batchWriter writes the rows, and records their lines in the checkpoint
+type batchWriter struct {
+	mu         sync.Mutex
+	w          io.Writer
+	csv        *csv.Writer
+	checkpoint *os.File
+}
+
+func (bw *batchWriter) writeHeader() error {
+	if bw.csv == nil {
+		return nil
+	}
+
+	if err := bw.csv.Write(batchFields); err != nil {
+		return fmt.Errorf("csv.Write: %v", err)
+	}
+	bw.csv.Flush()
+
+	return bw.csv.Error()
+}
+
+// writes the row, then records its line, so that
+// an interrupted batch may write a row twice, but never skips one
+func (bw *batchWriter) write(row *batchRow) error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	if bw.csv != nil {
+		if err := bw.csv.Write(row.values()); err != nil {
+			return fmt.Errorf("csv.Write: %v", err)
+		}
+		bw.csv.Flush()
+		if err := bw.csv.Error(); err != nil {
+			return fmt.Errorf("csv.Flush: %v", err)
+		}
+	} else {
+		line, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("json.Marshal: %v", err)
+		}
+		if _, err := fmt.Fprintf(bw.w, "%s\n", line); err != nil {
+			return err
+		}
+	}
+
+	// the failed lines are searched again on resume
+	if bw.checkpoint != nil && row.Status != statusError {
+		if _, err := fmt.Fprintf(bw.checkpoint, "%d %s\n", row.Line, queryHash(row.Query)); err != nil {
+			return fmt.Errorf("failed to write the checkpoint: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// opens the results file, appended to when the batch is resumed,
+// and reports whether it is empty
+func openResults(path string, resumed bool) (*os.File, bool, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resumed {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, false, fmt.Errorf("os.OpenFile: %v", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, false, fmt.Errorf("f.Stat: %v", err)
+	}
+
+	return f, info.Size() == 0, nil
+}
+
+// rewrites the results file of a resumed batch with the rows of the lines
+// recorded by the checkpoint only, once each: the rows of the failed lines,
+// and of the lines cut by an interruption, are written again on resume
+func rewriteResults(path string, ndjson bool, done map[int]string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("os.ReadFile: %v", err)
+	}
+
+	kept := make(map[int]bool, len(done))
+	keep := func(line int) bool {
+		if _, check := done[line]; !check || kept[line] {
+			return false
+		}
+		kept[line] = true
+		return true
+	}
+
+	var out bytes.Buffer
+	if ndjson {
+		for _, text := range strings.Split(string(data), "\n") {
+			var row batchRow
+			if err := json.Unmarshal([]byte(text), &row); err != nil {
+				continue
+			}
+			if keep(row.Line) {
+				out.WriteString(text + "\n")
+			}
+		}
+	} else {
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.FieldsPerRecord = -1
+		writer := csv.NewWriter(&out)
+		for {
+			record, err := reader.Read()
+			if err != nil {
+				// the end of the file, or a row cut by an interruption
+				break
+			}
+
+			// the header, then the rows to keep
+			line, err := strconv.Atoi(record[0])
+			if (err != nil && record[0] == batchFields[0]) || (err == nil && keep(line)) {
+				if err := writer.Write(record); err != nil {
+					return fmt.Errorf("csv.Write: %v", err)
+				}
+			}
+		}
+		writer.Flush()
+	}
+
+	// replaced at once, so that an interruption keeps the previous rows
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("os.WriteFile: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+
+	return nil
+}
+
+// batchSummary counts the rows by status, and keeps the failures
+type batchSummary struct {
+	total    int
+	skipped  int
+	counts   map[string]int
+	failures []*batchRow
+}
+
+func (s *batchSummary) add(row *batchRow) {
+	s.counts[row.Status]++
+	if row.Status == statusError {
+		s.failures = append(s.failures, row)
+	}
+}
+
+func (s *batchSummary) print(w io.Writer) {
+	fmt.Fprintf(w, "%d queries, %d skipped from the checkpoint: %d matched, %d uncertain, %d found, %d not found, %d failed\n",
+		s.total, s.skipped, s.counts[statusMatched], s.counts[statusUncertain],
+		s.counts[statusFound], s.counts[statusNotFound], s.counts[statusError])
+
+	for i, row := range s.failures {
+		if i == maxSummaryFailures {
+			fmt.Fprintf(w, "  ... and %d more failures\n", len(s.failures)-i)
+			break
+		}
+		fmt.Fprintf(w, "  line %d %q: %s\n", row.Line, row.Query, row.Error)
+	}
+}
+
+// searchInput searches the input, retrying the transient failures
+func (c *client) searchInput(ctx context.Context, opt *BatchOptions,
+	limiter *rate.Limiter, input batchInput) *batchRow {
+
+	client := pb.NewMusicResearcherClient(c.conn)
+	params := &pb.Parameters{
+		Query:        input.Query,
+		GenreFilters: opt.GenreFilters,
+		Limit:        opt.Limit,
+	}
+
+	delay := batchRetryDelay
+	for attempt := 0; ; attempt++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return &batchRow{Line: input.Line, Query: input.Query, Status: statusError,
+				Error: err.Error(), err: status.FromContextError(ctx.Err()).Err()}
+		}
+
+		callCtx, cancel := c.opt.callContext(ctx)
+		results, err := client.Search(callCtx, params)
+		cancel()
+		if err == nil {
+			return newRow(input, results.Tracks)
+		}
+
+		if attempt >= opt.Retries || !retryable(err) || ctx.Err() != nil {
+			return &batchRow{Line: input.Line, Query: input.Query, Status: statusError,
+				Error: status.Convert(err).Message(), err: err}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		delay *= 2
+	}
+}
+
+func runBatch(cmd *cobra.Command, c *client, opt *BatchOptions) error {
+	inputList, err := opt.readInputs(cmd.InOrStdin())
+	if err != nil {
+		return usageError{fmt.Errorf("failed to read the input: %v", err)}
+	}
+
+	done, err := readCheckpoint(opt.Checkpoint)
+	if err != nil {
+		return fmt.Errorf("readCheckpoint: %v", err)
+	}
+	if err := checkCheckpoint(done, inputList); err != nil {
+		return usageError{err}
+	}
+	resumed := len(done) > 0
+
+	summary := &batchSummary{total: len(inputList), counts: make(map[string]int)}
+	pending := make([]batchInput, 0, len(inputList))
+	for _, input := range inputList {
+		if _, check := done[input.Line]; check {
+			summary.skipped++
+			continue
+		}
+		pending = append(pending, input)
+	}
+
+	// the writer of the rows
+	bw := &batchWriter{w: cmd.OutOrStdout()}
+	emptyResults := !resumed
+	if opt.Results != "" {
+		if resumed {
+			if err := rewriteResults(opt.Results, c.out.Format == formatNDJSON, done); err != nil {
+				return fmt.Errorf("failed to rewrite the results: %v", err)
+			}
+		}
+
+		f, empty, err := openResults(opt.Results, resumed)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		bw.w, emptyResults = f, empty
+	}
+	if c.out.Format != formatNDJSON {
+		bw.csv = csv.NewWriter(bw.w)
+	}
+	if emptyResults {
+		if err := bw.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	if opt.Checkpoint != "" {
+		f, err := os.OpenFile(opt.Checkpoint, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("os.OpenFile: %v", err)
+		}
+		defer f.Close()
+		bw.checkpoint = f
+	}
+
+	if len(pending) > 0 {
+		if _, err := c.connect(); err != nil {
+			return err
+		}
+	}
+
+	// the searches, with a bounded concurrency and rate
+	limit := rate.Limit(opt.Rate)
+	if opt.Rate == 0 {
+		limit = rate.Inf
+	}
+	limiter := rate.NewLimiter(limit, 1)
+
+	ctx := cmd.Context()
+	inputs := make(chan batchInput)
+	rows := make(chan *batchRow)
+
+	var wg sync.WaitGroup
+	for i := 0; i < min(opt.Concurrency, max(len(pending), 1)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range inputs {
+				rows <- c.searchInput(ctx, opt, limiter, input)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(inputs)
+		for _, input := range pending {
+			select {
+			case inputs <- input:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(rows)
+	}()
+
+	var writeErr error
+	var firstErr error
+	for row := range rows {
+		// the searches cancelled by an interruption are searched again on resume
+		if ctx.Err() != nil && row.Status == statusError {
+			continue
+		}
+
+		summary.add(row)
+		if row.err != nil && firstErr == nil {
+			firstErr = row.err
+		}
+		if writeErr == nil {
+			writeErr = bw.write(row)
+		}
+	}
+
+	summary.print(cmd.ErrOrStderr())
+
+	switch {
+	case writeErr != nil:
+		return fmt.Errorf("failed to write the results: %v", writeErr)
+	case ctx.Err() != nil:
+		return status.Error(codes.Canceled, "the batch was interrupted, run it again to resume")
+	case firstErr != nil:
+		return status.Errorf(status.Code(firstErr), "%d queries failed",
+			summary.counts[statusError])
+	}
+
+	return nil
+}
@@ -0,0 +1,653 @@
+package runclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	benchMethod = "/musicresearcher.MusicResearcher/Search"
+
+	benchModeOpen   = "open"
+	benchModeClosed = "closed"
+
+	defaultBenchDuration    = 30 * time.Second
+	defaultBenchConcurrency = 10
+
+	// a request of the open loop starting later than this
+	// after its intended time is late
+	lateStartThreshold = 10 * time.Millisecond
+
+	// the ratio of late requests above which the open loop is
+	// warned about, its latencies including the wait of the client
+	lateStartWarningRatio = 0.01
+)
+
+// the upper bounds of the histogram buckets, the last bucket being unbounded
+var histogramBounds = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second,
+}
+
+// BenchOptions are the flags of the bench subcommand
+type BenchOptions struct {
+	Corpus       string
+	Duration     time.Duration
+	RPS          float64
+	Concurrency  int
+	GenreFilters []string
+	Limit        int32
+
+	Report        string
+	Baseline      string
+	MaxRegression float64
+}
+
+// LatencyStats are the latency percentiles, in milliseconds
+type LatencyStats struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p999"`
+	Max  float64 `json:"max"`
+}
+
+// HistogramBucket counts the requests whose latency is at most
+// UpperBoundMs, and above the bound of the previous bucket.
+// The bound of the last bucket is 0, for unbounded.
+type HistogramBucket struct {
+	UpperBoundMs float64 `json:"upperBoundMs"`
+	Count        int     `json:"count"`
+}
+
+// BenchReport is the JSON report of a bench run
+type BenchReport struct {
+	Method      string    `json:"method"`
+	StartedAt   time.Time `json:"startedAt"`
+	DurationSec float64   `json:"durationSec"`
+	Mode        string    `json:"mode"`
+	TargetRPS   float64   `json:"targetRps,omitempty"`
+	Concurrency int       `json:"concurrency"`
+	Queries     int       `json:"queries"`
+
+	Requests    int     `json:"requests"`
+	AchievedRPS float64 `json:"achievedRps"`
+	ErrorRate   float64 `json:"errorRate"`
+	LateStarts  int     `json:"lateStarts"`
+
+	// Unsent counts the requests of the open loop due before the end
+	// of the run, but not sent, the concurrency being exhausted
+	Unsent int `json:"unsent"`
+
+	// Latency is measured from the intended start of the requests in the open
+	// loop, correcting the coordinated omission, and ServiceTime from their
+	// actual start
+	Latency     LatencyStats      `json:"latencyMs"`
+	ServiceTime LatencyStats      `json:"serviceTimeMs"`
+	Histogram   []HistogramBucket `json:"histogram"`
+	StatusCodes map[string]int    `json:"statusCodes"`
+
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// benchRecorder records the latencies and the status codes of the requests
+type benchRecorder struct {
+	mu          sync.Mutex
+	latency     []time.Duration
+	serviceTime []time.Duration
+	statusCodes map[codes.Code]int
+	lateStarts  int
+	unsent      int
+}
+
+func (r *benchRecorder) record(latency time.Duration, serviceTime time.Duration,
+	code codes.Code, late bool) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latency = append(r.latency, latency)
+	r.serviceTime = append(r.serviceTime, serviceTime)
+	r.statusCodes[code]++
+	if late {
+		r.lateStarts++
+	}
+}
+
+func (r *benchRecorder) recordUnsent(count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.unsent += count
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// returns the q quantile of the sorted durations, with the nearest-rank method
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+func computeStats(durations []time.Duration) LatencyStats {
+	if len(durations) == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	return LatencyStats{
+		Min:  milliseconds(sorted[0]),
+		Mean: milliseconds(total / time.Duration(len(sorted))),
+		P50:  milliseconds(quantile(sorted, 0.5)),
+		P90:  milliseconds(quantile(sorted, 0.9)),
+		P95:  milliseconds(quantile(sorted, 0.95)),
+		P99:  milliseconds(quantile(sorted, 0.99)),
+		P999: milliseconds(quantile(sorted, 0.999)),
+		Max:  milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+func computeHistogram(durations []time.Duration) []HistogramBucket {
+	buckets := make([]HistogramBucket, len(histogramBounds)+1)
+	for i, bound := range histogramBounds {
+		buckets[i].UpperBoundMs = milliseconds(bound)
+	}
+
+	for _, d := range durations {
+		i := sort.Search(len(histogramBounds), func(i int) bool {
+			return d <= histogramBounds[i]
+		})
+		buckets[i].Count++
+	}
+
+	return buckets
+}
+
+// report builds the report of the run
+func (r *benchRecorder) report(opt *BenchOptions, queries int,
+	startedAt time.Time, elapsed time.Duration) *BenchReport {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &BenchReport{
+		Method:      benchMethod,
+		StartedAt:   startedAt.UTC(),
+		DurationSec: math.Round(elapsed.Seconds()*1000) / 1000,
+		Mode:        opt.mode(),
+		Concurrency: opt.Concurrency,
+		Queries:     queries,
+		Requests:    len(r.latency),
+		LateStarts:  r.lateStarts,
+		Unsent:      r.unsent,
+		Latency:     computeStats(r.latency),
+		ServiceTime: computeStats(r.serviceTime),
+		Histogram:   computeHistogram(r.latency),
+		StatusCodes: make(map[string]int, len(r.statusCodes)),
+	}
+	if opt.RPS > 0 {
+		report.TargetRPS = opt.RPS
+	}
+
+	failures := 0
+	for code, count := range r.statusCodes {
+		report.StatusCodes[code.String()] = count
+		if code != codes.OK {
+			failures += count
+		}
+	}
+	if report.Requests > 0 {
+		report.ErrorRate = float64(failures) / float64(report.Requests)
+	}
+	if elapsed > 0 {
+		report.AchievedRPS = math.Round(float64(report.Requests)/elapsed.Seconds()*100) / 100
+	}
+
+	// coordinated omission
+	switch {
+	case report.Mode == benchModeClosed:
+		report.Warnings = append(report.Warnings, "closed loop: the requests wait for the previous ones, "+
+			"the latencies omit the time the slow responses delayed them (coordinated omission), "+
+			"use --rps to measure them")
+	case float64(r.lateStarts) > lateStartWarningRatio*float64(report.Requests):
+		report.Warnings = append(report.Warnings, fmt.Sprintf("open loop: %d of %d requests started more than %s "+
+			"after their intended time, the concurrency being exhausted, "+
+			"their latency includes this wait, raise --concurrency to reach the target rate",
+			r.lateStarts, report.Requests, lateStartThreshold))
+	}
+	if r.unsent > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("open loop: %d requests due before the end "+
+			"of the run were not sent, the concurrency being exhausted, raise --concurrency to reach the target rate",
+			r.unsent))
+	}
+	if report.Mode == benchModeOpen && report.AchievedRPS < 0.9*opt.RPS {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"the achieved rate, %.2f rps, is below the target rate, %.2f rps", report.AchievedRPS, opt.RPS))
+	}
+
+	return report
+}
+
+func newBenchCommand(c *client) *cobra.Command {
+	opt := &BenchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "bench [query]...",
+		Short: "Load-tests Search with a query corpus, and reports its latencies",
+		Long: "Load-tests Search with the queries of a corpus, replayed in turn for a duration.\n\n" +
+			"With --rps, the requests are sent at the target rate (open loop), at most --concurrency at a time,\n" +
+			"their latency being measured from their intended start, so that the slow responses are not\n" +
+			"hidden by the requests they delay (coordinated omission). Without --rps, --concurrency workers\n" +
+			"send the requests one after the other (closed loop).\n\n" +
+			"The JSON report of --report can be compared against the report of an earlier run with --baseline.",
+		Example: "  musicresearcher bench --corpus queries.txt --rps 50 --duration 1m --report bench.json\n" +
+			"  musicresearcher bench --corpus queries.txt --rps 50 --duration 1m --baseline bench.json --max-regression 0.2",
+		Args: usageArgs(func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && opt.Corpus == "" {
+				return fmt.Errorf("a query or --corpus is required")
+			}
+			return nil
+		}),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opt.validate(c.out.Format); err != nil {
+				return usageError{err}
+			}
+
+			return runBench(cmd, c, opt, args)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opt.Corpus, "corpus", "", "the file of the queries, one per line, - for the standard input")
+	flags.DurationVarP(&opt.Duration, "duration", "d", defaultBenchDuration, "the duration of the run")
+	flags.Float64Var(&opt.RPS, "rps", 0, "the target rate of the requests per second, closed loop when 0")
+	flags.IntVarP(&opt.Concurrency, "concurrency", "c", defaultBenchConcurrency,
+		"the number of workers of the closed loop, or the maximum in-flight requests of the open loop")
+	flags.StringSliceVarP(&opt.GenreFilters, "genre", "g", nil, "the genres to filter, for every query")
+	flags.Int32VarP(&opt.Limit, "limit", "l", 0, "the limit of the searches, the server default when 0")
+	flags.StringVar(&opt.Report, "report", "", "the file of the JSON report")
+	flags.StringVar(&opt.Baseline, "baseline", "", "the JSON report of an earlier run, to compare with")
+	flags.Float64Var(&opt.MaxRegression, "max-regression", 0,
+		"the maximum regression of the p99 latency against the baseline, as a ratio (e.g. 0.2), not checked when 0")
+
+	return cmd
+}
+
+func (opt *BenchOptions) validate(outputFormat string) error {
+	if outputFormat != formatTable && outputFormat != formatJSON {
+		return fmt.Errorf("the bench report is written as a table or as json, not %s", outputFormat)
+	}
+	if opt.Duration <= 0 || opt.Concurrency <= 0 {
+		return fmt.Errorf("the duration and the concurrency must be positive")
+	}
+	if opt.RPS < 0 || opt.Limit < 0 || opt.MaxRegression < 0 {
+		return fmt.Errorf("the rps, the limit and the max regression must not be negative")
+	}
+	if opt.MaxRegression > 0 && opt.Baseline == "" {
+		return fmt.Errorf("--max-regression requires --baseline")
+	}
+
+	return nil
+}
+
+// returns the mode of the run, open with a target rate
+func (opt *BenchOptions) mode() string {
+	if opt.RPS > 0 {
+		return benchModeOpen
+	}
+
+	return benchModeClosed
+}
+
+// reads the queries of the corpus and of the arguments
+func (opt *BenchOptions) readQueries(stdin io.Reader, args []string) ([]string, error) {
+	queries := append([]string(nil), args...)
+	if opt.Corpus == "" {
+		return queries, nil
+	}
+
+	r := stdin
+	if opt.Corpus != "-" {
+		f, err := os.Open(opt.Corpus)
+		if err != nil {
+			return nil, fmt.Errorf("os.Open: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	inputList, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, input := range inputList {
+		queries = append(queries, input.Query)
+	}
+
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no query in %s", opt.Corpus)
+	}
+
+	return queries, nil
+}
+
+// benchRun sends the requests of a run
+type benchRun struct {
+	c        *client
+	opt      *BenchOptions
+	queries  []string
+	next     atomic.Int64
+	recorder *benchRecorder
+}
+
+// send sends the next query of the corpus, and records its latency
+// from the intended start
+func (b *benchRun) send(ctx context.Context, intended time.Time, late bool) {
+	query := b.queries[int(b.next.Add(1)-1)%len(b.queries)]
+
+	callCtx, cancel := b.c.opt.callContext(ctx)
+	start := time.Now()
+	_, err := pb.NewMusicResearcherClient(b.c.conn).Search(callCtx, &pb.Parameters{
+		Query:        query,
+		GenreFilters: b.opt.GenreFilters,
+		Limit:        b.opt.Limit,
+	})
+	end := time.Now()
+	cancel()
+
+	// the requests cut by an interruption are not recorded
+	if ctx.Err() != nil {
+		return
+	}
+
+	b.recorder.record(end.Sub(intended), end.Sub(start), status.Code(err), late)
+}
+
+// runs the closed loop: each worker sends a request after the other,
+// until the end of the run, the last requests being let finish
+func (b *benchRun) closedLoop(ctx context.Context, runCtx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < b.opt.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				b.send(runCtx, time.Now(), false)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runs the open loop: the requests are scheduled at the target rate,
+// whatever the latency of the previous ones
+func (b *benchRun) openLoop(ctx context.Context, runCtx context.Context, end time.Time) {
+	interval := time.Duration(float64(time.Second) / b.opt.RPS)
+	inFlight := make(chan struct{}, b.opt.Concurrency)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; ; i++ {
+		intended := start.Add(time.Duration(i) * interval)
+		if !intended.Before(end) {
+			break
+		}
+
+		timer := time.NewTimer(time.Until(intended))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			// the requests still due when the run ended are counted
+			due := int(math.Ceil(float64(end.Sub(intended)) / float64(interval)))
+			b.recorder.recordUnsent(max(due, 1))
+			break
+		}
+		late := time.Since(intended) > lateStartThreshold
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			b.send(runCtx, intended, late)
+		}()
+	}
+	wg.Wait()
+}
+
+func runBench(cmd *cobra.Command, c *client, opt *BenchOptions, args []string) error {
+	queries, err := opt.readQueries(cmd.InOrStdin(), args)
+	if err != nil {
+		return usageError{fmt.Errorf("failed to read the corpus: %v", err)}
+	}
+
+	var baseline *BenchReport
+	if opt.Baseline != "" {
+		if baseline, err = readReport(opt.Baseline); err != nil {
+			return usageError{fmt.Errorf("failed to read the baseline: %v", err)}
+		}
+
+		// the latencies of the open and the closed loops do not compare
+		if baseline.Mode != opt.mode() {
+			return usageError{fmt.Errorf("the baseline is a %s loop run, not a %s loop one",
+				baseline.Mode, opt.mode())}
+		}
+	}
+
+	if _, err := c.connect(); err != nil {
+		return err
+	}
+
+	b := &benchRun{
+		c:        c,
+		opt:      opt,
+		queries:  queries,
+		recorder: &benchRecorder{statusCodes: make(map[codes.Code]int)},
+	}
+
+	// the requests in flight at the end of the run are let finish,
+	// within their call timeout
+	startedAt := time.Now()
+	end := startedAt.Add(opt.Duration)
+	ctx, cancel := context.WithDeadline(cmd.Context(), end)
+	defer cancel()
+
+	if opt.RPS > 0 {
+		b.openLoop(ctx, cmd.Context(), end)
+	} else {
+		b.closedLoop(ctx, cmd.Context())
+	}
+	elapsed := time.Since(startedAt)
+
+	if err := cmd.Context().Err(); err != nil {
+		return status.Error(codes.Canceled, "the bench was interrupted")
+	}
+
+	report := b.recorder.report(opt, len(queries), startedAt, elapsed)
+
+	for _, warning := range report.Warnings {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Warning:", warning)
+	}
+
+	if opt.Report != "" {
+		if err := writeReport(opt.Report, report); err != nil {
+			return err
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	if c.out.Format == formatJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("json.Encode: %v", err)
+		}
+	} else if err := printReport(out, report, baseline); err != nil {
+		return err
+	}
+
+	return checkRegression(report, baseline, opt.MaxRegression)
+}
+
+func readReport(path string) (*BenchReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %v", err)
+	}
+
+	report := &BenchReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+
+	return report, nil
+}
+
+func writeReport(path string, report *BenchReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %v", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("os.WriteFile: %v", err)
+	}
+
+	return nil
+}
+
+// formats the relative change from the baseline, e.g. +12.5%
+func formatDelta(baseline float64, current float64) string {
+	if baseline == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%+.1f%%", (current-baseline)/baseline*100)
+}
+
+// prints the report, compared with the baseline when there is one
+func printReport(w io.Writer, report *BenchReport, baseline *BenchReport) error {
+	fmt.Fprintf(w, "%s, %s loop, %d requests in %.1fs, %.2f rps, %.2f%% errors\n\n",
+		report.Method, report.Mode, report.Requests, report.DurationSec,
+		report.AchievedRPS, report.ErrorRate*100)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	rows := []struct {
+		name    string
+		current float64
+		base    func(*BenchReport) float64
+	}{
+		{"p50 (ms)", report.Latency.P50, func(r *BenchReport) float64 { return r.Latency.P50 }},
+		{"p90 (ms)", report.Latency.P90, func(r *BenchReport) float64 { return r.Latency.P90 }},
+		{"p95 (ms)", report.Latency.P95, func(r *BenchReport) float64 { return r.Latency.P95 }},
+		{"p99 (ms)", report.Latency.P99, func(r *BenchReport) float64 { return r.Latency.P99 }},
+		{"p99.9 (ms)", report.Latency.P999, func(r *BenchReport) float64 { return r.Latency.P999 }},
+		{"max (ms)", report.Latency.Max, func(r *BenchReport) float64 { return r.Latency.Max }},
+		{"rps", report.AchievedRPS, func(r *BenchReport) float64 { return r.AchievedRPS }},
+		{"error rate", report.ErrorRate, func(r *BenchReport) float64 { return r.ErrorRate }},
+	}
+
+	if baseline == nil {
+		fmt.Fprintln(tw, "METRIC\tVALUE")
+		for _, row := range rows {
+			fmt.Fprintf(tw, "%s\t%.3f\n", row.name, row.current)
+		}
+	} else {
+		fmt.Fprintln(tw, "METRIC\tBASELINE\tCURRENT\tDELTA")
+		for _, row := range rows {
+			base := row.base(baseline)
+			fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%s\n",
+				row.name, base, row.current, formatDelta(base, row.current))
+		}
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "LATENCY\tREQUESTS")
+	lower := 0.0
+	for _, bucket := range report.Histogram {
+		if bucket.UpperBoundMs == 0 {
+			fmt.Fprintf(tw, "> %gms\t%d\n", lower, bucket.Count)
+			continue
+		}
+		fmt.Fprintf(tw, "<= %gms\t%d\n", bucket.UpperBoundMs, bucket.Count)
+		lower = bucket.UpperBoundMs
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "STATUS\tREQUESTS")
+	names := make([]string, 0, len(report.StatusCodes))
+	for name := range report.StatusCodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%d\n", strings.ToUpper(name), report.StatusCodes[name])
+	}
+
+	return tw.Flush()
+}
+
+// fails when the p99 latency regressed by more than the ratio
+// against the baseline
+func checkRegression(report *BenchReport, baseline *BenchReport, maxRegression float64) error {
+	if baseline == nil || maxRegression <= 0 || baseline.Latency.P99 <= 0 {
+		return nil
+	}
+	if baseline.Mode != report.Mode {
+		return status.Errorf(codes.FailedPrecondition,
+			"the baseline is a %s loop run, not a %s loop one", baseline.Mode, report.Mode)
+	}
+
+	regression := (report.Latency.P99 - baseline.Latency.P99) / baseline.Latency.P99
+	if regression > maxRegression {
+		return status.Errorf(codes.FailedPrecondition,
+			"the p99 latency regressed by %.1f%%, from %.3fms to %.3fms, over the %.1f%% allowed",
+			regression*100, baseline.Latency.P99, report.Latency.P99, maxRegression*100)
+	}
+
+	return nil
+}
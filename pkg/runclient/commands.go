@@ -0,0 +1,234 @@
+package runclient
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/pkg/extension"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	offsetMetadataKey  = "x-offset"
+	warningMetadataKey = "x-warning"
+)
+
+var errNegative = errors.New("the limit and the offset must not be negative")
+
+// the services of the health checks, for the completion
+var healthServices = []string{
+	pb.MusicResearcher_ServiceDesc.ServiceName,
+	extension.ServiceName,
+}
+
+func newSearchCommand(c *client) *cobra.Command {
+	var genreFilters []string
+	var limit int32
+	var offset int
+
+	cmd := &cobra.Command{
+		Use:   "search <query>...",
+		Short: "Searches the tracks matching the query",
+		Args:  usageArgs(cobra.MinimumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if limit < 0 || offset < 0 {
+				return usageError{errNegative}
+			}
+
+			conn, err := c.connect()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := c.opt.callContext(cmd.Context())
+			defer cancel()
+			if offset > 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx,
+					offsetMetadataKey, strconv.Itoa(offset))
+			}
+
+			var trailer metadata.MD
+			results, err := pb.NewMusicResearcherClient(conn).Search(ctx, &pb.Parameters{
+				Query:        strings.Join(args, " "),
+				GenreFilters: genreFilters,
+				Limit:        limit,
+			}, grpc.Trailer(&trailer))
+			if err != nil {
+				return err
+			}
+
+			printWarnings(cmd.ErrOrStderr(), trailer.Get(warningMetadataKey))
+			return c.out.writeResults(cmd.OutOrStdout(), results)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringSliceVarP(&genreFilters, "genre", "g", nil,
+		"the genres to filter, repeated or separated by commas")
+	flags.Int32VarP(&limit, "limit", "l", 0, "the maximum number of tracks, the server default when 0")
+	flags.IntVar(&offset, "offset", 0, "the number of tracks to skip")
+
+	_ = cmd.RegisterFlagCompletionFunc("genre", func(cmd *cobra.Command,
+		_ []string, _ string) ([]string, cobra.ShellCompDirective) {
+
+		genreList, err := c.getGenreList(cmd)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return genreList.Genres, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
+
+func (c *client) getGenreList(cmd *cobra.Command) (*pb.GenreList, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.opt.callContext(cmd.Context())
+	defer cancel()
+
+	return pb.NewMusicResearcherClient(conn).GetGenreList(ctx, &pb.Empty{})
+}
+
+func newGenresCommand(c *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "genres",
+		Short: "Lists the genres available to filter the searches",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			genreList, err := c.getGenreList(cmd)
+			if err != nil {
+				return err
+			}
+
+			return c.out.writeGenres(cmd.OutOrStdout(), genreList)
+		},
+	}
+}
+
+func newArtistCommand(c *client) *cobra.Command {
+	var limit int32
+
+	cmd := &cobra.Command{
+		Use:   "artist <id>",
+		Short: "Shows the artist along with its albums",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if limit < 0 {
+				return usageError{errNegative}
+			}
+
+			return c.callExtension(cmd, extension.MusicResearcherExtensionClient.GetArtist,
+				&pb.Parameters{Query: args[0], Limit: limit})
+		},
+	}
+	cmd.Flags().Int32Var(&limit, "albums", 0, "the maximum number of albums, the server default when 0")
+
+	return cmd
+}
+
+func newAlbumCommand(c *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "album <id>",
+		Short: "Shows the album along with its artists and its tracks",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.callExtension(cmd, extension.MusicResearcherExtensionClient.GetAlbum,
+				&pb.Parameters{Query: args[0]})
+		},
+	}
+}
+
+func newLookupCommand(c *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "lookup <id|uri|url>...",
+		Short: "Looks the tracks, albums and artists up by spotify ID, URI or URL",
+		Long: "Looks the tracks, albums and artists up by spotify ID, URI or URL.\n" +
+			"The IDs without type, neither in a URI nor in a URL, are tracks.",
+		Args: usageArgs(cobra.MinimumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.callExtension(cmd, extension.MusicResearcherExtensionClient.Lookup,
+				&pb.Parameters{Query: strings.Join(args, ",")})
+		},
+	}
+}
+
+// calls a method of the extension service, and prints its results
+func (c *client) callExtension(cmd *cobra.Command,
+	method func(extension.MusicResearcherExtensionClient, context.Context,
+		*pb.Parameters, ...grpc.CallOption) (*pb.Results, error),
+	params *pb.Parameters) error {
+
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.opt.callContext(cmd.Context())
+	defer cancel()
+
+	results, err := method(extension.NewMusicResearcherExtensionClient(conn), ctx, params)
+	if err != nil {
+		return err
+	}
+
+	return c.out.writeResults(cmd.OutOrStdout(), results)
+}
+
+func newHealthCommand(c *client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "health [service]",
+		Short: "Checks the health of the server, or of one of its services",
+		Long: "Checks the health of the server, or of one of its services.\n" +
+			"The command fails with UNAVAILABLE when the status is not SERVING.",
+		Args: usageArgs(cobra.MaximumNArgs(1)),
+		ValidArgsFunction: func(_ *cobra.Command, args []string,
+			_ string) ([]string, cobra.ShellCompDirective) {
+
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return healthServices, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service := ""
+			if len(args) > 0 {
+				service = args[0]
+			}
+
+			conn, err := c.connect()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := c.opt.callContext(cmd.Context())
+			defer cancel()
+
+			resp, err := healthpb.NewHealthClient(conn).Check(ctx,
+				&healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				return err
+			}
+
+			if err := c.out.writeHealth(cmd.OutOrStdout(), service, resp.Status); err != nil {
+				return err
+			}
+			if resp.Status != healthpb.HealthCheckResponse_SERVING {
+				return status.Errorf(codes.Unavailable, "the status is %s", resp.Status)
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package runclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	defaultHost    = "music-researcher-twecq3u42q-ew.a.run.app:443"
+	defaultTimeout = 10 * time.Second
+
+	apiKeyMetadataKey = "x-api-key"
+	apiKeyEnvKey      = "MUSICRESEARCHER_API_KEY"
+)
+
+// ConnOptions are the connection flags, shared by the subcommands
+type ConnOptions struct {
+	Host string
+	TLS  bool
+
+	// CACert is the PEM CA of the server certificate, the system roots when empty
+	CACert string
+	// Cert and Key are the PEM client certificate and key, for mutual TLS
+	Cert string
+	Key  string
+	// ServerName is the name expected in the server certificate
+	ServerName string
+
+	// APIKey is sent in the x-api-key metadata, when not empty
+	APIKey string
+
+	// Timeout bounds each call
+	Timeout time.Duration
+}
+
+func (opt *ConnOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&opt.Host, "host", defaultHost, "the service's host")
+	flags.BoolVar(&opt.TLS, "tls", true, "use tls")
+	flags.StringVar(&opt.CACert, "ca-cert", "", "the PEM CA of the server certificate, the system roots when empty")
+	flags.StringVar(&opt.Cert, "cert", "", "the PEM client certificate, for mutual TLS")
+	flags.StringVar(&opt.Key, "key", "", "the PEM client key, for mutual TLS")
+	flags.StringVar(&opt.ServerName, "server-name", "", "the server name expected in the server certificate")
+	flags.StringVar(&opt.APIKey, "api-key", os.Getenv(apiKeyEnvKey),
+		"the API key, "+apiKeyEnvKey+" by default")
+	flags.DurationVar(&opt.Timeout, "timeout", defaultTimeout, "the timeout of each call")
+}
+
+// builds the TLS config from the certificate flags
+func (opt *ConnOptions) tlsConfig() (*tls.Config, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("x509.SystemCertPool: %v", err)
+	}
+
+	if opt.CACert != "" {
+		pem, err := os.ReadFile(opt.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("os.ReadFile: %v", err)
+		}
+
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", opt.CACert)
+		}
+	}
+
+	config := &tls.Config{
+		RootCAs:    roots,
+		ServerName: opt.ServerName,
+	}
+
+	if opt.Cert != "" || opt.Key != "" {
+		cert, err := tls.LoadX509KeyPair(opt.Cert, opt.Key)
+		if err != nil {
+			return nil, fmt.Errorf("tls.LoadX509KeyPair: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// dial opens the connection to the service
+func (opt *ConnOptions) dial() (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if opt.TLS {
+		tlsConfig, err := opt.tlsConfig()
+		if err != nil {
+			return nil, fmt.Errorf("tlsConfig: %v", err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.Dial(opt.Host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("grpc.Dial: %v", err)
+	}
+
+	return conn, nil
+}
+
+// callContext returns the context of a call, bounded by
+// the timeout and carrying the API key
+func (opt *ConnOptions) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if opt.APIKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, apiKeyMetadataKey, opt.APIKey)
+	}
+
+	if opt.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, opt.Timeout)
+}
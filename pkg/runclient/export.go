@@ -0,0 +1,139 @@
+package runclient
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/internal/playlist"
+	"github.com/planetfall/musicresearcher/pkg/extension"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	trackIDsMetadataKey       = "x-track-ids"
+	playlistFormatMetadataKey = "x-playlist-format"
+	playlistTitleMetadataKey  = "x-playlist-title"
+)
+
+// returns the playlist format of the file extension, m3u by default
+func formatFromFile(path string) playlist.Format {
+	format, err := playlist.ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return playlist.FormatM3U
+	}
+
+	return format
+}
+
+func newExportCommand(c *client) *cobra.Command {
+	var ids, genreFilters []string
+	var format, title, file string
+	var limit int32
+	var offset int
+
+	cmd := &cobra.Command{
+		Use:   "export [query]...",
+		Short: "Exports the tracks found by the search, or given by ID, as a playlist",
+		Long: "Exports the tracks found by the search, or given by ID, as a playlist\n" +
+			"in the extended M3U, the XSPF or the JSPF format.",
+		Example: "  musicresearcher export chilly gonzales --genre piano --file piano.xspf\n" +
+			"  musicresearcher export --ids 3Nf8Ex8ewyYXbkE8xXUkbW,spotify:track:4uLU6hMCjMI75M1A2tKUQC -f jspf",
+		Args: usageArgs(func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && len(ids) == 0 {
+				return fmt.Errorf("a query or --ids is required")
+			}
+			if len(args) > 0 && len(ids) > 0 {
+				return fmt.Errorf("a query and --ids are exclusive")
+			}
+			return nil
+		}),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if limit < 0 || offset < 0 {
+				return usageError{errNegative}
+			}
+
+			playlistFormat := formatFromFile(file)
+			if format != "" {
+				var err error
+				if playlistFormat, err = playlist.ParseFormat(format); err != nil {
+					return usageError{err}
+				}
+			}
+
+			conn, err := c.connect()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := c.opt.callContext(cmd.Context())
+			defer cancel()
+
+			ctx = metadata.AppendToOutgoingContext(ctx,
+				playlistFormatMetadataKey, string(playlistFormat))
+			if title != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, playlistTitleMetadataKey, title)
+			}
+			if len(ids) > 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx,
+					trackIDsMetadataKey, strings.Join(ids, ","))
+			}
+			if offset > 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx,
+					offsetMetadataKey, strconv.Itoa(offset))
+			}
+
+			var trailer metadata.MD
+			body, err := extension.NewMusicResearcherExtensionClient(conn).ExportPlaylist(ctx,
+				&pb.Parameters{
+					Query:        strings.Join(args, " "),
+					GenreFilters: genreFilters,
+					Limit:        limit,
+				}, grpc.Trailer(&trailer))
+			if err != nil {
+				return err
+			}
+
+			printWarnings(cmd.ErrOrStderr(), trailer.Get(warningMetadataKey))
+
+			if file == "" {
+				_, err := cmd.OutOrStdout().Write(body.Data)
+				return err
+			}
+
+			if err := os.WriteFile(file, body.Data, 0o644); err != nil {
+				return fmt.Errorf("os.WriteFile: %v", err)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "playlist written to %s\n", file)
+
+			return nil
+		},
+	}
+
+	formatNames := make([]string, 0, len(playlist.Formats))
+	for _, f := range playlist.Formats {
+		formatNames = append(formatNames, string(f))
+	}
+
+	flags := cmd.Flags()
+	flags.StringSliceVar(&ids, "ids", nil,
+		"the spotify IDs, URIs or URLs of the tracks, instead of a search")
+	flags.StringVarP(&format, "format", "f", "",
+		"the playlist format: "+strings.Join(formatNames, ", ")+", from the file extension by default")
+	flags.StringVar(&title, "title", "", "the title of the playlist, the query by default")
+	flags.StringVar(&file, "file", "", "the file of the playlist, the standard output when empty")
+	flags.StringSliceVarP(&genreFilters, "genre", "g", nil,
+		"the genres to filter, repeated or separated by commas")
+	flags.Int32VarP(&limit, "limit", "l", 0, "the maximum number of tracks, the server default when 0")
+	flags.IntVar(&offset, "offset", 0, "the number of tracks to skip")
+
+	_ = cmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(
+		formatNames, cobra.ShellCompDirectiveNoFileComp))
+
+	return cmd
+}
@@ -0,0 +1,486 @@
+package runclient
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/spf13/pflag"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// the output formats
+const (
+	formatTable  = "table"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatYAML   = "yaml"
+)
+
+var outputFormats = []string{formatTable, formatJSON, formatNDJSON, formatCSV, formatYAML}
+
+// the kinds of the entities of the results
+const (
+	kindTrack  = "track"
+	kindAlbum  = "album"
+	kindArtist = "artist"
+)
+
+// the fields of the entities, that can be picked for the csv output
+var entityFields = []string{
+	"type", "id", "name", "artists", "album", "album_id", "year", "release_date",
+	"duration", "duration_ms", "popularity", "genres", "spotify_url", "preview_url", "image_url",
+}
+
+// the csv fields of the results holding a single kind of entity
+var defaultFields = map[string][]string{
+	kindTrack:  {"id", "name", "artists", "album", "year", "duration", "popularity"},
+	kindAlbum:  {"id", "name", "release_date"},
+	kindArtist: {"id", "name", "genres"},
+}
+
+// the csv fields of the results mixing the kinds of entities
+var mixedFields = []string{"type", "id", "name"}
+
+// column is a column of the table output
+type column struct {
+	header string
+	field  string
+}
+
+// the table columns of each kind of entity
+var tableColumns = map[string][]column{
+	kindTrack: {
+		{"TRACK", "name"}, {"ARTISTS", "artists"}, {"ALBUM", "album"},
+		{"YEAR", "year"}, {"DURATION", "duration"}, {"POPULARITY", "popularity"},
+	},
+	kindAlbum: {
+		{"ALBUM ID", "id"}, {"ALBUM", "name"}, {"YEAR", "year"},
+	},
+	kindArtist: {
+		{"ARTIST ID", "id"}, {"ARTIST", "name"}, {"GENRES", "genres"},
+	},
+}
+
+// the order of the tables of the results
+var tableKinds = []string{kindArtist, kindAlbum, kindTrack}
+
+// OutputOptions are the output flags, shared by the subcommands
+type OutputOptions struct {
+	// Format is one of table, json, ndjson, csv and yaml
+	Format string
+
+	// Fields are the columns of the csv output,
+	// depending on the entities when empty
+	Fields []string
+}
+
+func (opt *OutputOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&opt.Format, "output", "o", formatTable,
+		"the output format: "+strings.Join(outputFormats, ", "))
+	flags.StringSliceVar(&opt.Fields, "fields", nil,
+		"the columns of the csv output, among: "+strings.Join(entityFields, ", "))
+}
+
+func (opt *OutputOptions) validate() error {
+	if !contains(outputFormats, opt.Format) {
+		return fmt.Errorf("unknown output format %q, expected one of: %s",
+			opt.Format, strings.Join(outputFormats, ", "))
+	}
+
+	if len(opt.Fields) > 0 && opt.Format != formatCSV {
+		return fmt.Errorf("--fields is only supported by the csv output")
+	}
+
+	for _, field := range opt.Fields {
+		if !contains(entityFields, field) {
+			return fmt.Errorf("unknown field %q, expected some of: %s",
+				field, strings.Join(entityFields, ", "))
+		}
+	}
+
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// entity is a track, an album or an artist of the results,
+// along with its fields formatted as text
+type entity struct {
+	kind   string
+	msg    proto.Message
+	values map[string]string
+}
+
+// formats the duration as minutes and seconds, e.g. 3:07
+func formatDuration(durationMs int32) string {
+	seconds := durationMs / 1000
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// returns the year of a spotify release date, e.g. 2004-05-24
+func releaseYear(releaseDate string) string {
+	year, _, _ := strings.Cut(releaseDate, "-")
+	return year
+}
+
+func artistNames(artistList []*pb.Artist) string {
+	names := make([]string, 0, len(artistList))
+	for _, artist := range artistList {
+		names = append(names, artist.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func trackEntity(track *pb.Track) entity {
+	album := track.GetAlbum()
+
+	return entity{kind: kindTrack, msg: track, values: map[string]string{
+		"type":         kindTrack,
+		"id":           track.ID,
+		"name":         track.Name,
+		"artists":      artistNames(track.Artists),
+		"album":        album.GetName(),
+		"album_id":     album.GetID(),
+		"year":         releaseYear(album.GetReleaseDate()),
+		"release_date": album.GetReleaseDate(),
+		"duration":     formatDuration(track.DurationMs),
+		"duration_ms":  strconv.Itoa(int(track.DurationMs)),
+		"popularity":   strconv.Itoa(int(track.Popularity)),
+		"spotify_url":  track.SpotifyUrl,
+		"preview_url":  track.PreviewUrl,
+		"image_url":    album.GetImageUrl(),
+	}}
+}
+
+func albumEntity(album *pb.Album) entity {
+	return entity{kind: kindAlbum, msg: album, values: map[string]string{
+		"type":         kindAlbum,
+		"id":           album.ID,
+		"name":         album.Name,
+		"album":        album.Name,
+		"album_id":     album.ID,
+		"year":         releaseYear(album.ReleaseDate),
+		"release_date": album.ReleaseDate,
+		"spotify_url":  album.SpotifyUrl,
+		"image_url":    album.ImageUrl,
+	}}
+}
+
+func artistEntity(artist *pb.Artist) entity {
+	return entity{kind: kindArtist, msg: artist, values: map[string]string{
+		"type":        kindArtist,
+		"id":          artist.ID,
+		"name":        artist.Name,
+		"artists":     artist.Name,
+		"genres":      strings.Join(artist.Genres, ", "),
+		"spotify_url": artist.SpotifyUrl,
+		"image_url":   artist.ImageUrl,
+	}}
+}
+
+// lists the entities of the results, artists first, then albums and tracks
+func listEntities(results *pb.Results) []entity {
+	entityList := make([]entity, 0,
+		len(results.Artists)+len(results.Albums)+len(results.Tracks))
+	for _, artist := range results.Artists {
+		entityList = append(entityList, artistEntity(artist))
+	}
+	for _, album := range results.Albums {
+		entityList = append(entityList, albumEntity(album))
+	}
+	for _, track := range results.Tracks {
+		entityList = append(entityList, trackEntity(track))
+	}
+
+	return entityList
+}
+
+// marshals the message as indented json
+func marshalJSON(msg proto.Message) ([]byte, error) {
+	out, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("protojson.Marshal: %v", err)
+	}
+
+	return append(out, '\n'), nil
+}
+
+// marshals the message as a single json line
+func marshalJSONLine(msg proto.Message) ([]byte, error) {
+	out, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("protojson.Marshal: %v", err)
+	}
+
+	// the protojson output is not stable, compact it
+	line := &bytes.Buffer{}
+	if err := json.Compact(line, out); err != nil {
+		return nil, fmt.Errorf("json.Compact: %v", err)
+	}
+	line.WriteByte('\n')
+
+	return line.Bytes(), nil
+}
+
+// marshals the message as yaml, keeping the order of its json fields
+func marshalYAML(msg proto.Message) ([]byte, error) {
+	out, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("protojson.Marshal: %v", err)
+	}
+
+	// json is yaml, in flow style
+	var node yaml.Node
+	if err := yaml.Unmarshal(out, &node); err != nil {
+		return nil, fmt.Errorf("yaml.Unmarshal: %v", err)
+	}
+	resetStyle(&node)
+
+	return encodeYAML(&node)
+}
+
+// encodes the value as yaml, indented with two spaces
+func encodeYAML(v interface{}) ([]byte, error) {
+	out := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return nil, fmt.Errorf("yaml.Encode: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("yaml.Close: %v", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// switches the node and its children to the block style
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+// writes the message in the json or yaml format
+func writeMessage(w io.Writer, format string, msg proto.Message) error {
+	var out []byte
+	var err error
+	switch format {
+	case formatYAML:
+		out, err = marshalYAML(msg)
+	default:
+		out, err = marshalJSON(msg)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+// writes the entities as tables, one per kind, separated by a blank line
+func writeTables(w io.Writer, entityList []entity) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	first := true
+	for _, kind := range tableKinds {
+		columns := tableColumns[kind]
+		rows := 0
+		for _, e := range entityList {
+			if e.kind != kind {
+				continue
+			}
+
+			if rows == 0 {
+				if !first {
+					fmt.Fprintln(tw)
+				}
+				headers := make([]string, 0, len(columns))
+				for _, c := range columns {
+					headers = append(headers, c.header)
+				}
+				fmt.Fprintln(tw, strings.Join(headers, "\t"))
+			}
+
+			cells := make([]string, 0, len(columns))
+			for _, c := range columns {
+				cells = append(cells, e.values[c.field])
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+
+			rows++
+			first = false
+		}
+	}
+
+	if first {
+		fmt.Fprintln(tw, "no results")
+	}
+
+	return tw.Flush()
+}
+
+// returns the csv fields of the entities
+func (opt *OutputOptions) csvFields(entityList []entity) []string {
+	if len(opt.Fields) > 0 {
+		return opt.Fields
+	}
+
+	kind := kindTrack
+	for i, e := range entityList {
+		if i > 0 && e.kind != kind {
+			return mixedFields
+		}
+		kind = e.kind
+	}
+
+	return defaultFields[kind]
+}
+
+// writes the rows with a header
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("csv.Write: %v", err)
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("csv.WriteAll: %v", err)
+	}
+
+	return nil
+}
+
+// writes the results in the output format
+func (opt *OutputOptions) writeResults(w io.Writer, results *pb.Results) error {
+	entityList := listEntities(results)
+
+	switch opt.Format {
+	case formatJSON, formatYAML:
+		return writeMessage(w, opt.Format, results)
+	case formatNDJSON:
+		for _, e := range entityList {
+			line, err := marshalJSONLine(e.msg)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatCSV:
+		fields := opt.csvFields(entityList)
+		rows := make([][]string, 0, len(entityList))
+		for _, e := range entityList {
+			row := make([]string, 0, len(fields))
+			for _, field := range fields {
+				row = append(row, e.values[field])
+			}
+			rows = append(rows, row)
+		}
+		return writeCSV(w, fields, rows)
+	default:
+		return writeTables(w, entityList)
+	}
+}
+
+// writes the genres in the output format
+func (opt *OutputOptions) writeGenres(w io.Writer, genreList *pb.GenreList) error {
+	switch opt.Format {
+	case formatJSON, formatYAML:
+		return writeMessage(w, opt.Format, genreList)
+	case formatNDJSON:
+		for _, genre := range genreList.Genres {
+			line, err := json.Marshal(genre)
+			if err != nil {
+				return fmt.Errorf("json.Marshal: %v", err)
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatCSV:
+		rows := make([][]string, 0, len(genreList.Genres))
+		for _, genre := range genreList.Genres {
+			rows = append(rows, []string{genre})
+		}
+		return writeCSV(w, []string{"genre"}, rows)
+	default:
+		for _, genre := range genreList.Genres {
+			if _, err := fmt.Fprintln(w, genre); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// healthStatus is the status of a health check, in the json and yaml formats
+type healthStatus struct {
+	Service string `json:"service" yaml:"service"`
+	Status  string `json:"status" yaml:"status"`
+}
+
+// writes the status of the health check in the output format
+func (opt *OutputOptions) writeHealth(w io.Writer, service string,
+	st healthpb.HealthCheckResponse_ServingStatus) error {
+
+	if service == "" {
+		service = "server"
+	}
+	check := healthStatus{Service: service, Status: st.String()}
+
+	var out []byte
+	var err error
+	switch opt.Format {
+	case formatJSON:
+		out, err = json.MarshalIndent(check, "", "  ")
+		out = append(out, '\n')
+	case formatNDJSON:
+		out, err = json.Marshal(check)
+		out = append(out, '\n')
+	case formatYAML:
+		out, err = encodeYAML(check)
+	case formatCSV:
+		return writeCSV(w, []string{"service", "status"},
+			[][]string{{check.Service, check.Status}})
+	default:
+		out = []byte(fmt.Sprintf("%s: %s\n", check.Service, check.Status))
+	}
+	if err != nil {
+		return fmt.Errorf("marshal: %v", err)
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+// prints the warnings of a partial response
+func printWarnings(w io.Writer, warnings []string) {
+	for _, warning := range warnings {
+		fmt.Fprintln(w, "Warning:", warning)
+	}
+}
@@ -0,0 +1,362 @@
+package runclient
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/pkg/extension"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	replPrompt       = "musicresearcher> "
+	defaultPageSize  = 10
+	genreQueryPrefix = "genre:"
+)
+
+const replHelp = `Enter a query to search the tracks, with inline genre filters
+such as "gogol genre:piano", or one of the commands:
+  :next            the next page of the results
+  :prev            the previous page of the results
+  :open <n>        prints the spotify URL of the result n
+  :artist <n>      shows the first artist of the result n, along with its albums
+  :genres [prefix] lists the genres, starting with the prefix
+  :limit <n>       sets the number of results per page
+  :history         lists the lines of the session
+  !<n>             runs the line n of the history again
+  :help            prints this help
+  :quit            quits, as does end of file
+`
+
+// session is the state of an interactive session
+type session struct {
+	c   *client
+	cmd *cobra.Command
+	out io.Writer
+	err io.Writer
+
+	history  []string
+	pageSize int
+
+	// the search of the current page, and its results
+	query        string
+	genreFilters []string
+	offset       int
+	results      []*pb.Track
+
+	// the genres, loaded by the first :genres
+	genreList []string
+}
+
+func newREPLCommand(c *client) *cobra.Command {
+	var pageSize int
+
+	cmd := &cobra.Command{
+		Use:   "repl",
+		Short: "Runs an interactive session, on a single connection",
+		Long:  "Runs an interactive session, on a single connection.\n\n" + replHelp,
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if pageSize <= 0 {
+				return usageError{fmt.Errorf("the page size must be positive")}
+			}
+
+			s := &session{
+				c:        c,
+				cmd:      cmd,
+				out:      cmd.OutOrStdout(),
+				err:      cmd.ErrOrStderr(),
+				pageSize: pageSize,
+			}
+
+			return s.run(cmd.InOrStdin())
+		},
+	}
+	cmd.Flags().IntVar(&pageSize, "page-size", defaultPageSize, "the number of results per page")
+
+	return cmd
+}
+
+// reports whether the input is a terminal, to print the prompt
+func isTerminal(in io.Reader) bool {
+	f, check := in.(*os.File)
+	if !check {
+		return false
+	}
+
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// run reads and runs the lines until the end of the input or :quit,
+// the errors of a line being printed without ending the session
+func (s *session) run(in io.Reader) error {
+	interactive := isTerminal(in)
+	scanner := bufio.NewScanner(in)
+
+	for {
+		if interactive {
+			fmt.Fprint(s.out, replPrompt)
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// runs a line of the history again
+		if strings.HasPrefix(line, "!") {
+			n, err := parseIndex(line[1:], len(s.history))
+			if err != nil {
+				fmt.Fprintln(s.err, "Error:", err)
+				continue
+			}
+			line = s.history[n]
+			fmt.Fprintln(s.out, line)
+		}
+		s.history = append(s.history, line)
+
+		if line == ":quit" || line == ":q" {
+			return nil
+		}
+
+		if err := s.exec(line); err != nil {
+			fmt.Fprintln(s.err, "Error:", err)
+		}
+	}
+
+	if interactive {
+		fmt.Fprintln(s.out)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scanner.Scan: %v", err)
+	}
+
+	return nil
+}
+
+// exec runs a command or searches the query of the line
+func (s *session) exec(line string) error {
+	if !strings.HasPrefix(line, ":") {
+		query, genreFilters := parseQuery(line)
+		if query == "" {
+			return fmt.Errorf("the query is empty")
+		}
+
+		s.query, s.genreFilters = query, genreFilters
+		return s.search(0)
+	}
+
+	name, arg, _ := strings.Cut(line[1:], " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "next":
+		if s.query == "" {
+			return fmt.Errorf("no search to page")
+		}
+		if len(s.results) < s.pageSize {
+			return fmt.Errorf("no more results")
+		}
+		return s.search(s.offset + s.pageSize)
+	case "prev":
+		if s.query == "" || s.offset == 0 {
+			return fmt.Errorf("no previous page")
+		}
+		return s.search(max(s.offset-s.pageSize, 0))
+	case "open":
+		track, err := s.result(arg)
+		if err != nil {
+			return err
+		}
+		if track.SpotifyUrl == "" {
+			return fmt.Errorf("no spotify URL for %q", track.Name)
+		}
+		fmt.Fprintln(s.out, track.SpotifyUrl)
+		return nil
+	case "artist":
+		track, err := s.result(arg)
+		if err != nil {
+			return err
+		}
+		if len(track.Artists) == 0 {
+			return fmt.Errorf("no artist for %q", track.Name)
+		}
+		return s.artist(track.Artists[0].ID)
+	case "genres":
+		return s.genres(arg)
+	case "limit":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid limit %q, expected a positive integer", arg)
+		}
+		s.pageSize = n
+		return nil
+	case "history":
+		for i, line := range s.history {
+			fmt.Fprintf(s.out, "%4d  %s\n", i+1, line)
+		}
+		return nil
+	case "help":
+		fmt.Fprint(s.out, replHelp)
+		return nil
+	default:
+		return fmt.Errorf("unknown command :%s, see :help", name)
+	}
+}
+
+// splits the genre filters, such as genre:piano, from the query
+func parseQuery(line string) (string, []string) {
+	var words, genreFilters []string
+	for _, word := range strings.Fields(line) {
+		if genre, check := strings.CutPrefix(word, genreQueryPrefix); check {
+			if genre != "" {
+				genreFilters = append(genreFilters, genre)
+			}
+			continue
+		}
+		words = append(words, word)
+	}
+
+	return strings.Join(words, " "), genreFilters
+}
+
+// parses the 1-based index of an item among n
+func parseIndex(arg string, n int) (int, error) {
+	i, err := strconv.Atoi(arg)
+	if err != nil || i < 1 || i > n {
+		return 0, fmt.Errorf("invalid number %q, expected 1 to %d", arg, n)
+	}
+
+	return i - 1, nil
+}
+
+// returns the result whose number is the argument
+func (s *session) result(arg string) (*pb.Track, error) {
+	if len(s.results) == 0 {
+		return nil, fmt.Errorf("no results")
+	}
+
+	i, err := parseIndex(arg, len(s.results))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.results[i], nil
+}
+
+// searches the page of the current query, starting at the offset
+func (s *session) search(offset int) error {
+	conn, err := s.c.connect()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.c.opt.callContext(s.cmd.Context())
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, offsetMetadataKey, strconv.Itoa(offset))
+
+	var trailer metadata.MD
+	results, err := pb.NewMusicResearcherClient(conn).Search(ctx, &pb.Parameters{
+		Query:        s.query,
+		GenreFilters: s.genreFilters,
+		Limit:        int32(s.pageSize),
+	}, grpc.Trailer(&trailer))
+	if err != nil {
+		return err
+	}
+
+	s.offset = offset
+	s.results = results.Tracks
+
+	printWarnings(s.err, trailer.Get(warningMetadataKey))
+	return writeNumberedTracks(s.out, s.results, s.offset)
+}
+
+// shows the artist along with its albums
+func (s *session) artist(id string) error {
+	conn, err := s.c.connect()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.c.opt.callContext(s.cmd.Context())
+	defer cancel()
+
+	results, err := extension.NewMusicResearcherExtensionClient(conn).GetArtist(ctx,
+		&pb.Parameters{Query: id})
+	if err != nil {
+		return err
+	}
+
+	return writeTables(s.out, listEntities(results))
+}
+
+// lists the genres starting with the prefix
+func (s *session) genres(prefix string) error {
+	if s.genreList == nil {
+		genreList, err := s.c.getGenreList(s.cmd)
+		if err != nil {
+			return err
+		}
+		s.genreList = genreList.Genres
+	}
+
+	found := false
+	for _, genre := range s.genreList {
+		if strings.HasPrefix(genre, prefix) {
+			fmt.Fprintln(s.out, genre)
+			found = true
+		}
+	}
+	if !found {
+		fmt.Fprintln(s.out, "no genres")
+	}
+
+	return nil
+}
+
+// writes the tracks as a table, numbered from 1 for :open and :artist,
+// after the offset of the page
+func writeNumberedTracks(w io.Writer, trackList []*pb.Track, offset int) error {
+	if len(trackList) == 0 {
+		_, err := fmt.Fprintln(w, "no results")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	columns := tableColumns[kindTrack]
+
+	headers := []string{"#"}
+	for _, c := range columns {
+		headers = append(headers, c.header)
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+	for i, track := range trackList {
+		e := trackEntity(track)
+		cells := []string{strconv.Itoa(i + 1)}
+		for _, c := range columns {
+			cells = append(cells, e.values[c.field])
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	if offset > 0 {
+		fmt.Fprintf(tw, "(from result %d)\n", offset+1)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,162 @@
+// Package runclient is the command line client of the music researcher.
+//
+// Each subcommand calls one method of the service, the connection
+// being configured by the flags shared by all of them. The exit code
+// of a failed command is the code of the gRPC status of its call.
+package runclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// usageError is an error in the arguments or the flags of a command
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+// ExitCode maps the error of a command to its exit code: 0 on success,
+// the code of the gRPC status of the failed call, codes.InvalidArgument for
+// the usage errors, and codes.Unknown for the other errors
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		return int(codes.InvalidArgument)
+	}
+
+	if st, check := status.FromError(err); check {
+		return int(st.Code())
+	}
+
+	return int(codes.Unknown)
+}
+
+// wraps the validation of the positional arguments,
+// so that its errors are usage errors
+func usageArgs(validate cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := validate(cmd, args); err != nil {
+			return usageError{err}
+		}
+
+		return nil
+	}
+}
+
+// client holds the connection shared by the subcommands,
+// opened by the first call
+type client struct {
+	opt  ConnOptions
+	out  OutputOptions
+	conn *grpc.ClientConn
+}
+
+func (c *client) connect() (*grpc.ClientConn, error) {
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	conn, err := c.opt.dial()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to connect to %s: %v", c.opt.Host, err)
+	}
+	c.conn = conn
+
+	return conn, nil
+}
+
+func (c *client) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// NewCommand creates the root command, along with its subcommands
+func NewCommand() *cobra.Command {
+	c := &client{}
+
+	root := &cobra.Command{
+		Use:           "musicresearcher",
+		Short:         "Searches music in the Spotify catalog through the music researcher",
+		Args:          usageArgs(cobra.NoArgs),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PersistentPreRunE: func(*cobra.Command, []string) error {
+			if err := c.out.validate(); err != nil {
+				return usageError{err}
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+		PersistentPostRun: func(*cobra.Command, []string) {
+			c.close()
+		},
+	}
+	root.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return usageError{err}
+	})
+	c.opt.addFlags(root.PersistentFlags())
+	c.out.addFlags(root.PersistentFlags())
+	_ = root.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(
+		outputFormats, cobra.ShellCompDirectiveNoFileComp))
+	_ = root.RegisterFlagCompletionFunc("fields", cobra.FixedCompletions(
+		entityFields, cobra.ShellCompDirectiveNoFileComp))
+
+	root.AddCommand(
+		newSearchCommand(c),
+		newGenresCommand(c),
+		newArtistCommand(c),
+		newAlbumCommand(c),
+		newLookupCommand(c),
+		newHealthCommand(c),
+		newREPLCommand(c),
+		newExportCommand(c),
+		newBatchCommand(c),
+		newBenchCommand(c),
+	)
+
+	return root
+}
+
+// Run runs the command with the arguments, and returns its exit code
+func Run(ctx context.Context, args []string) int {
+	cmd := NewCommand()
+	cmd.SetArgs(args)
+
+	err := cmd.ExecuteContext(ctx)
+	if err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Error:", err)
+	}
+
+	return ExitCode(err)
+}
+
+func RunClient() {
+	// an interrupted command, such as a batch, stops cleanly
+	ctx, stop := signal.NotifyContext(context.Background(),
+		os.Interrupt, syscall.SIGTERM)
+	code := Run(ctx, os.Args[1:])
+	stop()
+
+	os.Exit(code)
+}
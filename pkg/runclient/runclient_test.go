@@ -0,0 +1,578 @@
+package runclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/pkg/extension"
+	"github.com/planetfall/musicresearcher/pkg/runclient"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type serverFake struct {
+	pb.UnimplementedMusicResearcherServer
+	mu     sync.Mutex
+	params *pb.Parameters
+	md     metadata.MD
+}
+
+func (s *serverFake) Search(ctx context.Context, params *pb.Parameters) (*pb.Results, error) {
+	s.mu.Lock()
+	s.params = params
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	s.mu.Unlock()
+
+	switch {
+	case strings.Contains(params.Query, "nothing"):
+		return &pb.Results{}, nil
+	case strings.Contains(params.Query, "fail"):
+		return nil, status.Error(codes.Internal, "spotify failed")
+	case strings.Contains(params.Query, "slow"):
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	return &pb.Results{Tracks: []*pb.Track{{
+		ID:         "track-1",
+		Name:       "Gogol",
+		Album:      &pb.Album{Name: "Solo Piano", ReleaseDate: "2004-05-24"},
+		Artists:    []*pb.Artist{{ID: "artist-1", Name: "Chilly Gonzales"}},
+		SpotifyUrl: "https://open.spotify.com/track/track-1",
+		DurationMs: 187000,
+		Popularity: 61,
+	}}}, nil
+}
+
+func (s *serverFake) GetGenreList(context.Context, *pb.Empty) (*pb.GenreList, error) {
+	return &pb.GenreList{Genres: []string{"jazz", "piano"}}, nil
+}
+
+type extensionFake struct {
+	extension.UnimplementedMusicResearcherExtensionServer
+	params *pb.Parameters
+	md     metadata.MD
+}
+
+func (s *extensionFake) ExportPlaylist(ctx context.Context, params *pb.Parameters) (*httpbody.HttpBody, error) {
+	s.params = params
+	s.md, _ = metadata.FromIncomingContext(ctx)
+
+	return &httpbody.HttpBody{ContentType: "application/xspf+xml", Data: []byte("<playlist/>")}, nil
+}
+
+func (s *extensionFake) GetArtist(_ context.Context, params *pb.Parameters) (*pb.Results, error) {
+	if params.Query != "artist-1" {
+		return nil, status.Errorf(codes.NotFound, "artist %s not found", params.Query)
+	}
+
+	return &pb.Results{
+		Artists: []*pb.Artist{{ID: "artist-1", Name: "Chilly Gonzales", Genres: []string{"piano"}}},
+		Albums:  []*pb.Album{{ID: "album-1", Name: "Solo Piano", ReleaseDate: "2004"}},
+	}, nil
+}
+
+func startServer(t *testing.T) (string, *serverFake, *health.Server) {
+	addr, serverGiven, _, healthGiven := startServerWithExtension(t)
+	return addr, serverGiven, healthGiven
+}
+
+func startServerWithExtension(t *testing.T) (string, *serverFake, *extensionFake, *health.Server) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	serverGiven := &serverFake{}
+	extensionGiven := &extensionFake{}
+	healthGiven := health.NewServer()
+
+	s := grpc.NewServer()
+	pb.RegisterMusicResearcherServer(s, serverGiven)
+	extension.RegisterMusicResearcherExtensionServer(s, extensionGiven)
+	healthpb.RegisterHealthServer(s, healthGiven)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	return lis.Addr().String(), serverGiven, extensionGiven, healthGiven
+}
+
+func execute(addr string, args ...string) (string, error) {
+	return executeWithInput(addr, "", args...)
+}
+
+func executeWithInput(addr string, input string, args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	cmd := runclient.NewCommand()
+	cmd.SetIn(strings.NewReader(input))
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs(append([]string{"--host", addr, "--tls=false", "--api-key", "key-1"}, args...))
+
+	err := cmd.ExecuteContext(context.Background())
+	return out.String(), err
+}
+
+func TestSearch(t *testing.T) {
+
+	addr, serverGiven, _ := startServer(t)
+
+	out, err := execute(addr, "search", "chilly", "gonzales",
+		"--genre", "piano", "-g", "jazz", "--limit", "3", "--offset", "10")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "chilly gonzales", serverGiven.params.Query)
+	assert.Equal(t, []string{"piano", "jazz"}, serverGiven.params.GenreFilters)
+	assert.Equal(t, int32(3), serverGiven.params.Limit)
+	assert.Equal(t, []string{"10"}, serverGiven.md.Get("x-offset"))
+	assert.Equal(t, []string{"key-1"}, serverGiven.md.Get("x-api-key"))
+
+	assert.Equal(t, ""+
+		"TRACK  ARTISTS          ALBUM       YEAR  DURATION  POPULARITY\n"+
+		"Gogol  Chilly Gonzales  Solo Piano  2004  3:07      61\n", out)
+}
+
+func TestSearch_withOutputFormats(t *testing.T) {
+
+	addr, _, _ := startServer(t)
+
+	out, err := execute(addr, "search", "gogol", "-o", "json")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"tracks": [{
+		"ID": "track-1", "name": "Gogol", "durationMs": 187000, "popularity": 61,
+		"spotifyUrl": "https://open.spotify.com/track/track-1",
+		"album": {"name": "Solo Piano", "releaseDate": "2004-05-24"},
+		"artists": [{"ID": "artist-1", "name": "Chilly Gonzales"}]
+	}]}`, out)
+
+	out, err = execute(addr, "search", "gogol", "-o", "ndjson")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"ID":"track-1","name":"Gogol","spotifyUrl":"https://open.spotify.com/track/track-1",`+
+		`"album":{"name":"Solo Piano","releaseDate":"2004-05-24"},`+
+		`"artists":[{"ID":"artist-1","name":"Chilly Gonzales"}],"durationMs":187000,"popularity":61}`+"\n", out)
+
+	out, err = execute(addr, "search", "gogol", "-o", "csv")
+	assert.Nil(t, err)
+	assert.Equal(t, "id,name,artists,album,year,duration,popularity\n"+
+		"track-1,Gogol,Chilly Gonzales,Solo Piano,2004,3:07,61\n", out)
+
+	out, err = execute(addr, "search", "gogol", "-o", "csv", "--fields", "name,duration_ms")
+	assert.Nil(t, err)
+	assert.Equal(t, "name,duration_ms\nGogol,187000\n", out)
+
+	out, err = execute(addr, "search", "gogol", "-o", "yaml")
+	assert.Nil(t, err)
+	assert.Contains(t, out, "tracks:\n  - ID: track-1\n    name: Gogol\n")
+
+	_, err = execute(addr, "search", "gogol", "-o", "xml")
+	assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err))
+
+	_, err = execute(addr, "search", "gogol", "-o", "csv", "--fields", "unknown")
+	assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err))
+
+	_, err = execute(addr, "search", "gogol", "--fields", "name")
+	assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err))
+}
+
+func TestSearch_withoutGenre(t *testing.T) {
+
+	addr, serverGiven, _ := startServer(t)
+
+	_, err := execute(addr, "search", "chilly gonzales")
+	assert.Nil(t, err)
+
+	assert.Empty(t, serverGiven.params.GenreFilters)
+	assert.Equal(t, int32(0), serverGiven.params.Limit)
+	assert.Empty(t, serverGiven.md.Get("x-offset"))
+}
+
+func TestGenres(t *testing.T) {
+
+	addr, _, _ := startServer(t)
+
+	out, err := execute(addr, "genres")
+	assert.Nil(t, err)
+	assert.Equal(t, "jazz\npiano\n", out)
+
+	out, err = execute(addr, "genres", "-o", "ndjson")
+	assert.Nil(t, err)
+	assert.Equal(t, "\"jazz\"\n\"piano\"\n", out)
+}
+
+func TestArtist(t *testing.T) {
+
+	addr, _, _ := startServer(t)
+
+	out, err := execute(addr, "artist", "artist-1")
+	assert.Nil(t, err)
+	assert.Equal(t, ""+
+		"ARTIST ID  ARTIST           GENRES\n"+
+		"artist-1   Chilly Gonzales  piano\n"+
+		"\n"+
+		"ALBUM ID  ALBUM       YEAR\n"+
+		"album-1   Solo Piano  2004\n", out)
+
+	out, err = execute(addr, "artist", "artist-1", "-o", "csv")
+	assert.Nil(t, err)
+	assert.Equal(t, "type,id,name\nartist,artist-1,Chilly Gonzales\nalbum,album-1,Solo Piano\n", out)
+
+	_, err = execute(addr, "artist", "artist-2")
+	assert.Equal(t, int(codes.NotFound), runclient.ExitCode(err))
+}
+
+func TestLookup_withUnimplemented(t *testing.T) {
+
+	addr, _, _ := startServer(t)
+
+	_, err := execute(addr, "lookup", "spotify:track:track-1")
+	assert.Equal(t, int(codes.Unimplemented), runclient.ExitCode(err))
+}
+
+func TestHealth(t *testing.T) {
+
+	addr, _, healthGiven := startServer(t)
+
+	out, err := execute(addr, "health")
+	assert.Nil(t, err)
+	assert.Equal(t, "server: SERVING\n", out)
+
+	healthGiven.SetServingStatus(extension.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	out, err = execute(addr, "health", extension.ServiceName)
+	assert.Equal(t, int(codes.Unavailable), runclient.ExitCode(err))
+	assert.Contains(t, out, "NOT_SERVING")
+}
+
+func TestExitCode_withUsageError(t *testing.T) {
+
+	addr, _, _ := startServer(t)
+
+	for _, args := range [][]string{
+		{"search"},
+		{"search", "query", "--limit", "-1"},
+		{"artist", "a", "b"},
+		{"unknown"},
+		{"genres", "--unknown"},
+	} {
+		_, err := execute(addr, args...)
+		assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err), args)
+	}
+
+	assert.Equal(t, 0, runclient.ExitCode(nil))
+}
+
+func TestREPL(t *testing.T) {
+
+	addr, serverGiven, _ := startServer(t)
+
+	out, err := executeWithInput(addr, strings.Join([]string{
+		"gogol genre:piano",
+		":open 1",
+		":next",
+		":artist 1",
+		":genres pi",
+		":open 2",
+		":history",
+		"!2",
+		":quit",
+		"ignored",
+	}, "\n"), "repl", "--page-size", "1")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "gogol", serverGiven.params.Query)
+	assert.Equal(t, []string{"piano"}, serverGiven.params.GenreFilters)
+	assert.Equal(t, int32(1), serverGiven.params.Limit)
+	assert.Equal(t, []string{"1"}, serverGiven.md.Get("x-offset"))
+
+	assert.Equal(t, ""+
+		// gogol genre:piano
+		"#  TRACK  ARTISTS          ALBUM       YEAR  DURATION  POPULARITY\n"+
+		"1  Gogol  Chilly Gonzales  Solo Piano  2004  3:07      61\n"+
+		// :open 1
+		"https://open.spotify.com/track/track-1\n"+
+		// :next
+		"#  TRACK  ARTISTS          ALBUM       YEAR  DURATION  POPULARITY\n"+
+		"1  Gogol  Chilly Gonzales  Solo Piano  2004  3:07      61\n"+
+		"(from result 2)\n"+
+		// :artist 1
+		"ARTIST ID  ARTIST           GENRES\n"+
+		"artist-1   Chilly Gonzales  piano\n"+
+		"\n"+
+		"ALBUM ID  ALBUM       YEAR\n"+
+		"album-1   Solo Piano  2004\n"+
+		// :genres pi
+		"piano\n"+
+		// :open 2
+		"Error: invalid number \"2\", expected 1 to 1\n"+
+		// :history
+		"   1  gogol genre:piano\n"+
+		"   2  :open 1\n"+
+		"   3  :next\n"+
+		"   4  :artist 1\n"+
+		"   5  :genres pi\n"+
+		"   6  :open 2\n"+
+		"   7  :history\n"+
+		// !2
+		":open 1\n"+
+		"https://open.spotify.com/track/track-1\n", out)
+}
+
+func TestExport(t *testing.T) {
+
+	addr, _, extensionGiven, _ := startServerWithExtension(t)
+	file := filepath.Join(t.TempDir(), "piano.xspf")
+
+	_, err := execute(addr, "export", "chilly", "gonzales", "--genre", "piano",
+		"--offset", "5", "--file", file)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "chilly gonzales", extensionGiven.params.Query)
+	assert.Equal(t, []string{"piano"}, extensionGiven.params.GenreFilters)
+	assert.Equal(t, []string{"xspf"}, extensionGiven.md.Get("x-playlist-format"))
+	assert.Equal(t, []string{"5"}, extensionGiven.md.Get("x-offset"))
+	assert.Empty(t, extensionGiven.md.Get("x-track-ids"))
+
+	data, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "<playlist/>", string(data))
+
+	out, err := execute(addr, "export", "--ids", "track-1,track-2", "-f", "jspf", "--title", "mine")
+	assert.Nil(t, err)
+	assert.Equal(t, "<playlist/>", out)
+	assert.Equal(t, []string{"track-1,track-2"}, extensionGiven.md.Get("x-track-ids"))
+	assert.Equal(t, []string{"jspf"}, extensionGiven.md.Get("x-playlist-format"))
+	assert.Equal(t, []string{"mine"}, extensionGiven.md.Get("x-playlist-title"))
+
+	for _, args := range [][]string{
+		{"export"},
+		{"export", "query", "--ids", "track-1"},
+		{"export", "query", "-f", "pls"},
+	} {
+		_, err := execute(addr, args...)
+		assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err), args)
+	}
+}
+
+// reads the ndjson batch rows, by line, each line having one row
+func readBatchRows(t *testing.T, path string) map[float64]map[string]interface{} {
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+
+	rows := make(map[float64]map[string]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		row := make(map[string]interface{})
+		assert.Nil(t, json.Unmarshal([]byte(line), &row))
+		assert.NotContains(t, rows, row["line"], "the line has several rows")
+		rows[row["line"].(float64)] = row
+	}
+
+	return rows
+}
+
+func TestBatch(t *testing.T) {
+
+	addr, _, _ := startServer(t)
+	dir := t.TempDir()
+	results := filepath.Join(dir, "results.ndjson")
+	checkpoint := filepath.Join(dir, "checkpoint")
+	input := strings.Join([]string{
+		"Chilly Gonzales - Gogol",
+		"Daft Punk - Gogol",
+		"nothing here",
+		"fail",
+		"# comment",
+		"gogol",
+	}, "\n")
+	args := []string{"batch", "-o", "ndjson", "--results", results, "--checkpoint", checkpoint,
+		"--concurrency", "2", "--rate", "0", "--retries", "0"}
+
+	out, err := executeWithInput(addr, input, args...)
+	assert.Equal(t, int(codes.Internal), runclient.ExitCode(err))
+	assert.Contains(t, out, "5 queries, 0 skipped from the checkpoint: "+
+		"1 matched, 1 uncertain, 1 found, 1 not found, 1 failed\n"+
+		"  line 4 \"fail\": spotify failed\n")
+
+	rows := readBatchRows(t, results)
+	assert.Len(t, rows, 5)
+	assert.Equal(t, "matched", rows[1]["status"])
+	assert.Equal(t, "Chilly Gonzales Gogol", rows[1]["query"])
+	assert.Equal(t, "track-1", rows[1]["trackId"])
+	assert.Equal(t, "uncertain", rows[2]["status"])
+	assert.Equal(t, "not_found", rows[3]["status"])
+	assert.Equal(t, "error", rows[4]["status"])
+	assert.Equal(t, "spotify failed", rows[4]["error"])
+	assert.Equal(t, "found", rows[6]["status"])
+
+	// resumed, only the failed line is searched again,
+	// its previous row being replaced
+	out, err = executeWithInput(addr, input, args...)
+	assert.Equal(t, int(codes.Internal), runclient.ExitCode(err))
+	assert.Contains(t, out, "5 queries, 4 skipped from the checkpoint: "+
+		"0 matched, 0 uncertain, 0 found, 0 not found, 1 failed\n")
+
+	rows = readBatchRows(t, results)
+	assert.Len(t, rows, 5)
+	assert.Equal(t, "matched", rows[1]["status"])
+	assert.Equal(t, "error", rows[4]["status"])
+
+	// the checkpoint of another input is refused
+	_, err = executeWithInput(addr, strings.Replace(input, "Daft Punk", "Air", 1), args...)
+	assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err))
+	assert.Len(t, readBatchRows(t, results), 5)
+}
+
+func TestBatch_withCSVResume(t *testing.T) {
+
+	addr, _, _ := startServer(t)
+	dir := t.TempDir()
+	results := filepath.Join(dir, "results.csv")
+	checkpoint := filepath.Join(dir, "checkpoint")
+	input := "gogol\nfail\n"
+	args := []string{"batch", "--results", results, "--checkpoint", checkpoint,
+		"--rate", "0", "--retries", "0"}
+
+	for i := 0; i < 2; i++ {
+		_, err := executeWithInput(addr, input, args...)
+		assert.Equal(t, int(codes.Internal), runclient.ExitCode(err))
+	}
+
+	data, err := os.ReadFile(results)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, strings.Join([]string{
+		"line", "query", "status", "track_id", "track", "artists", "album", "spotify_url", "error",
+	}, ","), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "1,gogol,found,"))
+	assert.True(t, strings.HasPrefix(lines[2], "2,fail,error,"))
+}
+
+func TestBatch_withCSV(t *testing.T) {
+
+	addr, serverGiven, _ := startServer(t)
+	input := filepath.Join(t.TempDir(), "tracks.csv")
+	assert.Nil(t, os.WriteFile(input, []byte("title,artist,year\nGogol,Chilly Gonzales,2004\n"), 0o644))
+
+	out, err := execute(addr, "batch", "--input", input, "--genre", "piano")
+	assert.Nil(t, err)
+	assert.Equal(t, "line,query,status,track_id,track,artists,album,spotify_url,error\n"+
+		"2,Chilly Gonzales Gogol,matched,track-1,Gogol,Chilly Gonzales,Solo Piano,"+
+		"https://open.spotify.com/track/track-1,\n"+
+		"1 queries, 0 skipped from the checkpoint: "+
+		"1 matched, 0 uncertain, 0 found, 0 not found, 0 failed\n", out)
+	assert.Equal(t, []string{"piano"}, serverGiven.params.GenreFilters)
+	assert.Equal(t, int32(5), serverGiven.params.Limit)
+
+	_, err = execute(addr, "batch", "--input", input, "-o", "json")
+	assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err))
+}
+
+func TestBench(t *testing.T) {
+	addr, _, _ := startServer(t)
+	report := filepath.Join(t.TempDir(), "bench.json")
+
+	out, err := executeWithInput(addr, "gogol\nfail\n", "bench", "--corpus", "-",
+		"--rps", "40", "--duration", "300ms", "--report", report)
+	assert.Nil(t, err)
+	assert.Contains(t, out, "/musicresearcher.MusicResearcher/Search, open loop")
+	assert.Contains(t, out, "p99 (ms)")
+	assert.Contains(t, out, "INTERNAL")
+
+	data, err := os.ReadFile(report)
+	assert.Nil(t, err)
+	reportGiven := &runclient.BenchReport{}
+	assert.Nil(t, json.Unmarshal(data, reportGiven))
+	assert.Equal(t, "open", reportGiven.Mode)
+	assert.Equal(t, float64(40), reportGiven.TargetRPS)
+	assert.Equal(t, 2, reportGiven.Queries)
+	assert.Greater(t, reportGiven.Requests, 1)
+	assert.Equal(t, reportGiven.Requests, reportGiven.StatusCodes["OK"]+reportGiven.StatusCodes["Internal"])
+	assert.Greater(t, reportGiven.StatusCodes["Internal"], 0)
+	assert.Greater(t, reportGiven.ErrorRate, 0.0)
+	assert.LessOrEqual(t, reportGiven.Latency.P50, reportGiven.Latency.P99)
+	assert.LessOrEqual(t, reportGiven.ServiceTime.Max, reportGiven.Latency.Max)
+
+	requests := 0
+	for _, bucket := range reportGiven.Histogram {
+		requests += bucket.Count
+	}
+	assert.Equal(t, reportGiven.Requests, requests)
+}
+
+func TestBench_withSlowRequests(t *testing.T) {
+	addr, _, _ := startServer(t)
+	dir := t.TempDir()
+
+	// the in-flight requests of the closed loop finish after the end of the run
+	closedReport := filepath.Join(dir, "closed.json")
+	_, err := execute(addr, "bench", "slow", "--concurrency", "2", "--duration", "100ms",
+		"--report", closedReport)
+	assert.Nil(t, err)
+
+	reportGiven := &runclient.BenchReport{}
+	data, err := os.ReadFile(closedReport)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(data, reportGiven))
+	assert.Equal(t, 2, reportGiven.Requests)
+	assert.Equal(t, 2, reportGiven.StatusCodes["OK"])
+
+	// the open loop counts the requests it could not send
+	openReport := filepath.Join(dir, "open.json")
+	out, err := execute(addr, "bench", "slow", "--rps", "100", "--concurrency", "1",
+		"--duration", "100ms", "--report", openReport)
+	assert.Nil(t, err)
+	assert.Contains(t, out, "were not sent")
+
+	reportGiven = &runclient.BenchReport{}
+	data, err = os.ReadFile(openReport)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(data, reportGiven))
+	assert.Equal(t, 1, reportGiven.Requests)
+	assert.Equal(t, 9, reportGiven.Unsent)
+}
+
+func TestBench_withBaseline(t *testing.T) {
+	addr, _, _ := startServer(t)
+	baseline := filepath.Join(t.TempDir(), "baseline.json")
+	data, err := json.Marshal(runclient.BenchReport{
+		Mode:    "closed",
+		Latency: runclient.LatencyStats{P50: 0.001, P99: 0.001},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(baseline, data, 0o644))
+
+	out, err := execute(addr, "bench", "gogol", "--concurrency", "2", "--duration", "100ms",
+		"--baseline", baseline, "--max-regression", "0.1")
+	assert.Equal(t, int(codes.FailedPrecondition), runclient.ExitCode(err))
+	assert.Contains(t, out, "coordinated omission")
+	assert.Contains(t, out, "METRIC      BASELINE")
+
+	_, err = execute(addr, "bench", "gogol", "--max-regression", "0.1")
+	assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err))
+
+	// the baseline of a closed loop run does not compare with an open loop one
+	_, err = execute(addr, "bench", "gogol", "--rps", "10", "--duration", "100ms",
+		"--baseline", baseline, "--max-regression", "0.1")
+	assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err))
+
+	_, err = execute(addr, "bench")
+	assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err))
+
+	_, err = execute(addr, "bench", "gogol", "-o", "csv")
+	assert.Equal(t, int(codes.InvalidArgument), runclient.ExitCode(err))
+}
@@ -0,0 +1,147 @@
+package runserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/planetfall/musicresearcher/internal/logging"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configWatcher reloads the config file on SIGHUP, or when it changes,
+// and applies its reloadable options to the server
+type configWatcher struct {
+	path     string
+	levelVar *slog.LevelVar
+	logger   *slog.Logger
+
+	// the last accepted config, nil until a reload
+	current atomic.Pointer[viper.Viper]
+	modTime time.Time
+}
+
+func newConfigWatcher(path string, levelVar *slog.LevelVar,
+	logger *slog.Logger) *configWatcher {
+
+	w := &configWatcher{
+		path:     path,
+		levelVar: levelVar,
+		logger:   logger,
+	}
+	w.modTime = w.getModTime()
+
+	return w
+}
+
+// settings returns the effective configuration
+func (w *configWatcher) settings() map[string]interface{} {
+	if v := w.current.Load(); v != nil {
+		return v.AllSettings()
+	}
+
+	return viper.AllSettings()
+}
+
+func (w *configWatcher) getModTime() time.Time {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// watch reloads the config on SIGHUP, and every interval when the
+// config file changed, until the context is done
+func (w *configWatcher) watch(ctx context.Context, s *Server, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.logger.Info("SIGHUP received, reloading the config")
+		case <-tick:
+			modTime := w.getModTime()
+			if modTime.Equal(w.modTime) {
+				continue
+			}
+			w.logger.Info("the config file changed, reloading it")
+		}
+
+		w.modTime = w.getModTime()
+		if err := w.reload(ctx, s); err != nil {
+			w.logger.Error("the config was rejected, the previous one is kept",
+				"error", err)
+		}
+	}
+}
+
+// reload reads the config and applies it to the server,
+// the previous config being kept when invalid
+func (w *configWatcher) reload(ctx context.Context, s *Server) error {
+	v, err := readConfig(w.path)
+	if err != nil {
+		return fmt.Errorf("readConfig: %v", err)
+	}
+
+	level, err := logging.ParseLevel(v.GetString(logLevelFlag))
+	if err != nil {
+		return fmt.Errorf("logging.ParseLevel: %v", err)
+	}
+
+	r, err := getReloadable(v)
+	if err != nil {
+		return fmt.Errorf("getReloadable: %v", err)
+	}
+
+	if err := s.Reload(ctx, r); err != nil {
+		return fmt.Errorf("s.Reload: %v", err)
+	}
+
+	w.levelVar.Set(level)
+	w.current.Store(v)
+
+	return nil
+}
+
+// readConfig reads the config file into a new viper, with the same
+// precedence as at startup: the flags, the environment, the file
+// and the defaults
+func readConfig(path string) (*viper.Viper, error) {
+	v := viper.New()
+	for _, entry := range getEntries() {
+		v.SetDefault(entry.Flag, entry.DefaultValue)
+		if err := v.BindEnv(entry.Flag, entry.EnvKey); err != nil {
+			return nil, fmt.Errorf("v.BindEnv: %v", err)
+		}
+	}
+
+	if err := v.BindPFlags(pflag.CommandLine); err != nil {
+		return nil, fmt.Errorf("v.BindPFlags: %v", err)
+	}
+
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("v.ReadInConfig: %v", err)
+	}
+
+	return v, nil
+}
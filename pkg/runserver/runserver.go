@@ -1,36 +1,157 @@
 package runserver
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"net"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/planetfall/framework/pkg/config"
 	"github.com/planetfall/framework/pkg/server"
-	"github.com/planetfall/musicresearcher/internal/service"
+	"github.com/planetfall/musicresearcher/internal/auth"
+	"github.com/planetfall/musicresearcher/internal/certs"
+	"github.com/planetfall/musicresearcher/internal/deadline"
+	"github.com/planetfall/musicresearcher/internal/graph"
+	"github.com/planetfall/musicresearcher/internal/logging"
+	"github.com/planetfall/musicresearcher/internal/ratelimit"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/tracing"
 	"github.com/spf13/viper"
-	"google.golang.org/grpc"
 )
 
 const (
 	portFlag                = "port"
+	adminPortFlag           = "admin-port"
+	restPortFlag            = "rest-port"
+	logLevelFlag            = "log-level"
+	traceExporterFlag       = "trace-exporter"
+	otlpEndpointFlag        = "otlp-endpoint"
 	serviceFlag             = "service"
+	apiKeysFileFlag         = "api-keys-file"
+	apiKeysFlag             = "api-keys"
+	defaultDeadlineFlag     = "default-deadline"
+	methodDeadlinesFlag     = "method-deadlines"
+	tlsCertFlag             = "tls-cert"
+	tlsKeyFlag              = "tls-key"
+	tlsClientCAFlag         = "tls-client-ca"
+	tlsReloadIntervalFlag   = "tls-reload-interval"
+	drainTimeoutFlag        = "drain-timeout"
+	rateLimitFlag           = "rate-limit"
+	rateLimitBurstFlag      = "rate-limit-burst"
+	upstreamConcurrencyFlag = "upstream-concurrency"
 	spotifyClientIdFlag     = "spotify-client-id"
 	spotifyClientSecretFlag = "spotify-client-secret"
+	defaultSearchLimitFlag  = "default-search-limit"
+	relaxationFlag          = "feature-relaxation"
+	suggestUpstreamFlag     = "feature-suggest-upstream"
+	configReloadFlag        = "config-reload-interval"
+	multiplexFlag           = "multiplex"
+	multiplexAdminFlag      = "multiplex-admin"
+	corsAllowedOriginsFlag  = "cors-allowed-origins"
+	graphQLComplexityFlag   = "graphql-max-complexity"
+	graphQLDepthFlag        = "graphql-max-depth"
 )
 
-func getConfig() (config.Config, error) {
-
-	entries := []config.Entry{{
+// returns the config entries of the server
+func getEntries() []config.Entry {
+	return []config.Entry{{
 		Flag:         portFlag,
 		DefaultValue: "8080",
 		Description:  "the exposed port of the service",
 		EnvKey:       "PORT",
+	}, {
+		Flag:         adminPortFlag,
+		DefaultValue: "",
+		Description:  "the port of the admin HTTP server, disabled when empty",
+		EnvKey:       "ADMIN_PORT",
+	}, {
+		Flag:         restPortFlag,
+		DefaultValue: "",
+		Description:  "the port of the REST/JSON gateway, disabled when empty",
+		EnvKey:       "REST_PORT",
+	}, {
+		Flag:         logLevelFlag,
+		DefaultValue: "info",
+		Description:  "the log level: debug, info, warn or error",
+		EnvKey:       "LOG_LEVEL",
+	}, {
+		Flag:         traceExporterFlag,
+		DefaultValue: tracing.ExporterNone,
+		Description:  "the trace exporter: none, stdout or otlp",
+		EnvKey:       "TRACE_EXPORTER",
+	}, {
+		Flag:         otlpEndpointFlag,
+		DefaultValue: "",
+		Description:  "the host:port of the OTLP gRPC collector",
+		EnvKey:       "OTLP_ENDPOINT",
 	}, {
 		Flag:         serviceFlag,
 		DefaultValue: "cloud-microservice",
 		Description:  "the service name",
 		EnvKey:       "K_SERVICE",
+	}, {
+		Flag:         apiKeysFileFlag,
+		DefaultValue: "",
+		Description:  "the YAML or JSON file of the API keys",
+		EnvKey:       "API_KEYS_FILE",
+	}, {
+		Flag:         apiKeysFlag,
+		DefaultValue: "",
+		Description:  "the API keys, as id:key:scope1|scope2:quota separated by commas",
+		EnvKey:       "API_KEYS",
+	}, {
+		Flag:         tlsCertFlag,
+		DefaultValue: "",
+		Description:  "the PEM server certificate, the TLS is disabled when empty",
+		EnvKey:       "TLS_CERT",
+	}, {
+		Flag:         tlsKeyFlag,
+		DefaultValue: "",
+		Description:  "the PEM server private key",
+		EnvKey:       "TLS_KEY",
+	}, {
+		Flag:         tlsClientCAFlag,
+		DefaultValue: "",
+		Description:  "the PEM CAs of the client certificates, enabling the mutual TLS",
+		EnvKey:       "TLS_CLIENT_CA",
+	}, {
+		Flag:         tlsReloadIntervalFlag,
+		DefaultValue: "30s",
+		Description:  "the interval between two checks of the certificate files",
+		EnvKey:       "TLS_RELOAD_INTERVAL",
+	}, {
+		Flag:         drainTimeoutFlag,
+		DefaultValue: "10s",
+		Description:  "the time left to the in-flight requests on stop, before they are aborted",
+		EnvKey:       "DRAIN_TIMEOUT",
+	}, {
+		Flag:         defaultDeadlineFlag,
+		DefaultValue: "10s",
+		Description:  "the deadline of the requests received without one, none when 0",
+		EnvKey:       "DEFAULT_DEADLINE",
+	}, {
+		Flag:         methodDeadlinesFlag,
+		DefaultValue: "Search=8s,GetGenreList=5s,Suggest=2s",
+		Description:  "the default deadline of each method, as Method=duration separated by commas",
+		EnvKey:       "METHOD_DEADLINES",
+	}, {
+		Flag:         rateLimitFlag,
+		DefaultValue: "5",
+		Description:  "the requests per second allowed to each caller, unlimited when 0",
+		EnvKey:       "RATE_LIMIT",
+	}, {
+		Flag:         rateLimitBurstFlag,
+		DefaultValue: "10",
+		Description:  "the burst of requests allowed to each caller",
+		EnvKey:       "RATE_LIMIT_BURST",
+	}, {
+		Flag:         upstreamConcurrencyFlag,
+		DefaultValue: "16",
+		Description:  "the maximum in-flight spotify calls, shared across the callers, unlimited when 0",
+		EnvKey:       "UPSTREAM_CONCURRENCY",
 	}, {
 		Flag:         spotifyClientIdFlag,
 		DefaultValue: "",
@@ -41,10 +162,57 @@ func getConfig() (config.Config, error) {
 		DefaultValue: "",
 		Description:  "the client secret for Spotify OAuth authentication",
 		EnvKey:       "SPOTIFY_CLIENT_SECRET",
+	}, {
+		Flag:         defaultSearchLimitFlag,
+		DefaultValue: "10",
+		Description:  "the limit of the searches without one",
+		EnvKey:       "DEFAULT_SEARCH_LIMIT",
+	}, {
+		Flag:         relaxationFlag,
+		DefaultValue: "true",
+		Description:  "relaxes the searches without results",
+		EnvKey:       "FEATURE_RELAXATION",
+	}, {
+		Flag:         suggestUpstreamFlag,
+		DefaultValue: "true",
+		Description:  "searches spotify for the suggestions when none is known",
+		EnvKey:       "FEATURE_SUGGEST_UPSTREAM",
+	}, {
+		Flag:         configReloadFlag,
+		DefaultValue: "10s",
+		Description:  "the interval between two checks of the config file, disabled when 0",
+		EnvKey:       "CONFIG_RELOAD_INTERVAL",
+	}, {
+		Flag:         multiplexFlag,
+		DefaultValue: "false",
+		Description:  "serves the gRPC-Web and the REST gateway on the port of the gRPC server",
+		EnvKey:       "MULTIPLEX",
+	}, {
+		Flag:         multiplexAdminFlag,
+		DefaultValue: "false",
+		Description:  "also serves the admin routes on the multiplexed port, to the admin API keys",
+		EnvKey:       "MULTIPLEX_ADMIN",
+	}, {
+		Flag:         corsAllowedOriginsFlag,
+		DefaultValue: "",
+		Description:  "the browser origins allowed to call the multiplexed port, separated by commas, * for any",
+		EnvKey:       "CORS_ALLOWED_ORIGINS",
+	}, {
+		Flag:         graphQLComplexityFlag,
+		DefaultValue: "5000",
+		Description:  "the maximum cost of a GraphQL query, a field costing 1 for each item of its parent lists",
+		EnvKey:       "GRAPHQL_MAX_COMPLEXITY",
+	}, {
+		Flag:         graphQLDepthFlag,
+		DefaultValue: "10",
+		Description:  "the maximum depth of a GraphQL query",
+		EnvKey:       "GRAPHQL_MAX_DEPTH",
 	},
 	}
+}
 
-	c, err := config.NewConfig(entries)
+func getConfig() (config.Config, error) {
+	c, err := config.NewConfig(getEntries())
 	if err != nil {
 		return nil, fmt.Errorf("config.NewConfig: %v", err)
 	}
@@ -63,24 +231,13 @@ func getServer(cfg config.Config) (*server.Server, error) {
 	return s, nil
 }
 
-func getListener() (net.Listener, error) {
-	port := viper.GetString(portFlag)
-	addr := fmt.Sprintf(":%s", port)
-	lis, err := net.Listen("tcp4", addr)
-	if err != nil {
-		return nil, fmt.Errorf("net.Listen: %v", err)
-	}
-
-	return lis, nil
-}
-
-func getSpotifyCredentials() (string, string, error) {
-	spotifyClientId := viper.GetString(spotifyClientIdFlag)
+func getSpotifyCredentials(v *viper.Viper) (string, string, error) {
+	spotifyClientId := v.GetString(spotifyClientIdFlag)
 	if spotifyClientId == "" {
 		return "", "", fmt.Errorf("spotify client ID not provided")
 	}
 
-	spotifyClientSecret := viper.GetString(spotifyClientSecretFlag)
+	spotifyClientSecret := v.GetString(spotifyClientSecretFlag)
 	if spotifyClientSecret == "" {
 		return "", "", fmt.Errorf("spotify client secret not provided")
 	}
@@ -88,43 +245,212 @@ func getSpotifyCredentials() (string, string, error) {
 	return spotifyClientId, spotifyClientSecret, nil
 }
 
+// loads the API key store from the file or the environment,
+// nil when no key is configured
+func getKeyStore(v *viper.Viper) (*auth.Store, error) {
+	if path := v.GetString(apiKeysFileFlag); path != "" {
+		store, err := auth.LoadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("auth.LoadFile: %v", err)
+		}
+		return store, nil
+	}
+
+	if keys := v.GetString(apiKeysFlag); keys != "" {
+		store, err := auth.ParseEnv(keys)
+		if err != nil {
+			return nil, fmt.Errorf("auth.ParseEnv: %v", err)
+		}
+		return store, nil
+	}
+
+	return nil, nil
+}
+
+func getDeadlineOptions(v *viper.Viper) (deadline.Options, error) {
+	methods, err := deadline.ParseMethods(v.GetString(methodDeadlinesFlag))
+	if err != nil {
+		return deadline.Options{}, fmt.Errorf("deadline.ParseMethods: %v", err)
+	}
+
+	return deadline.Options{
+		Default: v.GetDuration(defaultDeadlineFlag),
+		Methods: methods,
+	}, nil
+}
+
+// builds the reloadable options from the config
+func getReloadable(v *viper.Viper) (Reloadable, error) {
+	spotifyClientId, spotifyClientSecret, err := getSpotifyCredentials(v)
+	if err != nil {
+		return Reloadable{}, fmt.Errorf("getSpotifyCredentials: %v", err)
+	}
+
+	deadlineOpt, err := getDeadlineOptions(v)
+	if err != nil {
+		return Reloadable{}, fmt.Errorf("getDeadlineOptions: %v", err)
+	}
+
+	return Reloadable{
+		SpotifyClientId:     spotifyClientId,
+		SpotifyClientSecret: spotifyClientSecret,
+		SpotifySettings: &myspotify.Settings{
+			DefaultSearchLimit:      v.GetInt(defaultSearchLimitFlag),
+			Relaxation:              v.GetBool(relaxationFlag),
+			SuggestUpstreamFallback: v.GetBool(suggestUpstreamFlag),
+		},
+		RateLimit: ratelimit.Options{
+			Rate:  v.GetFloat64(rateLimitFlag),
+			Burst: v.GetInt(rateLimitBurstFlag),
+		},
+		Deadlines: deadlineOpt,
+	}, nil
+}
+
+// builds the server options from the flags
+func getOptions(v *viper.Viper) (Options, error) {
+	reloadable, err := getReloadable(v)
+	if err != nil {
+		return Options{}, fmt.Errorf("getReloadable: %v", err)
+	}
+
+	keyStore, err := getKeyStore(v)
+	if err != nil {
+		return Options{}, fmt.Errorf("getKeyStore: %v", err)
+	}
+
+	return Options{
+		Port:      v.GetString(portFlag),
+		AdminPort: v.GetString(adminPortFlag),
+		RestPort:  v.GetString(restPortFlag),
+
+		Reloadable: reloadable,
+
+		APIKeys:             keyStore,
+		UpstreamConcurrency: v.GetInt(upstreamConcurrencyFlag),
+
+		TLS: certs.Options{
+			CertFile:     v.GetString(tlsCertFlag),
+			KeyFile:      v.GetString(tlsKeyFlag),
+			ClientCAFile: v.GetString(tlsClientCAFlag),
+		},
+		TLSReloadInterval: v.GetDuration(tlsReloadIntervalFlag),
+		DrainTimeout:      v.GetDuration(drainTimeoutFlag),
+
+		Multiplex:          v.GetBool(multiplexFlag),
+		MultiplexAdmin:     v.GetBool(multiplexAdminFlag),
+		CORSAllowedOrigins: splitList(v.GetString(corsAllowedOriginsFlag)),
+
+		GraphQL: graph.Options{
+			MaxComplexity: v.GetInt(graphQLComplexityFlag),
+			MaxDepth:      v.GetInt(graphQLDepthFlag),
+		},
+	}, nil
+}
+
+// splits the comma-separated list, ignoring the empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// creates the logger, along with its level to be changed on reload
+func getLogger(v *viper.Viper) (*slog.Logger, *slog.LevelVar, error) {
+	level, err := logging.ParseLevel(v.GetString(logLevelFlag))
+	if err != nil {
+		return nil, nil, fmt.Errorf("logging.ParseLevel: %v", err)
+	}
+
+	levelVar := new(slog.LevelVar)
+	levelVar.Set(level)
+
+	logger := logging.NewLogger(os.Stdout, levelVar).
+		With("service", v.GetString(serviceFlag))
+
+	return logger, levelVar, nil
+}
+
+// RunServer runs the server configured by the flags and the environment,
+// until it receives an interrupt or a termination signal
 func RunServer() {
-	log.SetPrefix("[RUNSERVER] ")
+	logger := logging.NewLogger(os.Stdout, slog.LevelInfo).
+		With("component", "runserver")
+
+	if err := run(logger); err != nil {
+		logger.Error("the server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(logger *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(),
+		os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// config
-	log.Printf("setting up the config")
+	logger.Info("setting up the config")
 	cfg, err := getConfig()
 	if err != nil {
-		log.Fatalf("getConfig: %v", err)
+		return fmt.Errorf("getConfig: %v", err)
+	}
+
+	// logger
+	baseLogger, levelVar, err := getLogger(viper.GetViper())
+	if err != nil {
+		return fmt.Errorf("getLogger: %v", err)
+	}
+	logger = baseLogger.With("component", "runserver")
+
+	// tracing
+	logger.Info("setting up the tracing")
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:     viper.GetString(traceExporterFlag),
+		OTLPEndpoint: viper.GetString(otlpEndpointFlag),
+		ServiceName:  viper.GetString(serviceFlag),
+	})
+	if err != nil {
+		return fmt.Errorf("tracing.Setup: %v", err)
 	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("shutdownTracing failed", "error", err)
+		}
+	}()
 
 	// server
-	log.Printf("setting up the server")
+	logger.Info("setting up the server")
 	srv, err := getServer(cfg)
 	if err != nil {
-		log.Fatalf("getServer: %v", err)
+		return fmt.Errorf("getServer: %v", err)
 	}
+	defer func() {
+		if err := srv.Close(); err != nil {
+			logger.Error("srv.Close failed", "error", err)
+		}
+	}()
 
-	// service
-	log.Printf("setting up the service")
-	grpc := grpc.NewServer()
-	spotifyClientId, spotifyClientSecret, err := getSpotifyCredentials()
+	opt, err := getOptions(viper.GetViper())
 	if err != nil {
-		log.Fatalf("getSpotifyCredentials: %v", err)
+		return fmt.Errorf("getOptions: %v", err)
 	}
-	svc := service.NewService(
-		grpc, srv, spotifyClientId, spotifyClientSecret)
+	opt.Logger = baseLogger
+	opt.Reporter = srv
+
+	w := newConfigWatcher(viper.GetString(config.ConfigFlag), levelVar, logger)
+	opt.Settings = w.settings
 
-	// service start
-	lis, err := getListener()
+	s, err := New(opt)
 	if err != nil {
-		log.Fatalf("getListener: %v", err)
+		return fmt.Errorf("New: %v", err)
 	}
 
-	log.Printf("starting listening on %s", lis.Addr().String())
-	if err := svc.Start(lis); err != nil {
-		log.Fatalf("svc.Start: %v", err)
-	}
+	go w.watch(ctx, s, viper.GetDuration(configReloadFlag))
 
-	log.Printf("service stopped")
+	return s.Run(ctx)
 }
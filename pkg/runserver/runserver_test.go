@@ -0,0 +1,325 @@
+package runserver_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/planetfall/musicresearcher/internal/auth"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"github.com/planetfall/musicresearcher/internal/spotify/mocks"
+	"github.com/planetfall/musicresearcher/pkg/extension"
+	"github.com/planetfall/musicresearcher/pkg/runserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zmb3/spotify/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1024 * 1024
+
+func getSearchResults(artistId spotify.ID) *spotify.SearchResult {
+	return &spotify.SearchResult{
+		Tracks: &spotify.FullTrackPage{
+			Tracks: []spotify.FullTrack{{
+				SimpleTrack: spotify.SimpleTrack{
+					ID:      "track-id-1",
+					Name:    "Crying",
+					Artists: []spotify.SimpleArtist{{ID: artistId}},
+				},
+			}},
+		},
+	}
+}
+
+// newSpotify creates a spotify client over mocks
+func newSpotify(logger *slog.Logger) (myspotify.MySpotify, *mocks.ProviderMock) {
+	artistIdGiven := spotify.ID("artist-id-1")
+
+	clientGiven := &mocks.ClientMock{}
+	clientGiven.On("Search", mock.Anything).Return(getSearchResults(artistIdGiven), nil)
+	clientGiven.On("NextPage").Return(spotify.ErrNoMorePages)
+	clientGiven.On("GetArtist", artistIdGiven).Return(&spotify.FullArtist{
+		SimpleArtist: spotify.SimpleArtist{ID: artistIdGiven, Name: "Chilly Gonzales"},
+	}, nil)
+	clientGiven.On("GetAvailableGenreSeeds").Return([]string{"piano"}, nil)
+
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.
+		On("NewClient", "client-id", "client-secret").
+		Return(clientGiven, time.Now().Add(time.Hour), nil)
+
+	return myspotify.NewMySpotify(myspotify.MySpotifyOptions{
+		ClientId:     "client-id",
+		ClientSecret: "client-secret",
+		Logger:       logger,
+		Provider:     providerGiven,
+	}), providerGiven
+}
+
+// startServer runs the server of the options on an in-memory listener,
+// stopping it at the end of the test
+func startServer(t *testing.T, opt runserver.Options) *bufconn.Listener {
+	t.Helper()
+
+	lis := bufconn.Listen(bufSize)
+	ready := make(chan net.Addr, 1)
+	opt.Listener = lis
+	opt.DrainTimeout = time.Second
+	opt.OnReady = func(addr net.Addr) { ready <- addr }
+
+	s, err := runserver.New(opt)
+	if err != nil {
+		t.Fatalf("runserver.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run(ctx) }()
+
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-runErr:
+			assert.Nil(t, err)
+		case <-time.After(5 * time.Second):
+			t.Error("the server did not stop")
+		}
+	})
+
+	select {
+	case addr := <-ready:
+		assert.Equal(t, s.Addr(), addr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server is not ready")
+	}
+
+	return lis
+}
+
+// dial connects a gRPC client to the in-memory listener
+func dial(t *testing.T, lis *bufconn.Listener) *grpc.ClientConn {
+	t.Helper()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// newHTTPClient creates an HTTP client of the in-memory listener
+func newHTTPClient(lis *bufconn.Listener) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		},
+	}}
+}
+
+func TestRun(t *testing.T) {
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	spotifyGiven, _ := newSpotify(logger)
+
+	lis := startServer(t, runserver.Options{
+		Logger:  logger,
+		Spotify: spotifyGiven,
+	})
+	conn := dial(t, lis)
+
+	// liveness
+	health, err := healthpb.NewHealthClient(conn).Check(context.Background(),
+		&healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, health.Status)
+
+	// search, through the interceptors
+	results, err := pb.NewMusicResearcherClient(conn).Search(context.Background(),
+		&pb.Parameters{Query: "chilly gonzales crying", Limit: 3})
+	assert.Nil(t, err)
+	assert.Len(t, results.Tracks, 1)
+	assert.Equal(t, "Chilly Gonzales", results.Tracks[0].Artists[0].Name)
+}
+
+func TestRun_exportPlaylist(t *testing.T) {
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	spotifyGiven, _ := newSpotify(logger)
+
+	lis := startServer(t, runserver.Options{
+		Logger:  logger,
+		Spotify: spotifyGiven,
+	})
+	conn := dial(t, lis)
+
+	// playlist of the search
+	var trailer metadata.MD
+	body, err := extension.NewMusicResearcherExtensionClient(conn).ExportPlaylist(
+		metadata.AppendToOutgoingContext(context.Background(), "x-playlist-format", "xspf"),
+		&pb.Parameters{Query: "chilly gonzales crying", Limit: 3}, grpc.Trailer(&trailer))
+	assert.Nil(t, err)
+	assert.Equal(t, "application/xspf+xml", body.ContentType)
+	assert.Contains(t, string(body.Data), "<title>chilly gonzales crying</title>")
+	assert.Contains(t, string(body.Data), "<creator>Chilly Gonzales</creator>")
+
+	// the track found has no URL
+	assert.Equal(t, []string{"1 of the 1 tracks have no location, the players skip them"},
+		trailer.Get("x-warning"))
+}
+
+func TestNew_withoutListener(t *testing.T) {
+
+	_, err := runserver.New(runserver.Options{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.NotNil(t, err)
+}
+
+func TestServer_Reload(t *testing.T) {
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	spotifyGiven, providerGiven := newSpotify(logger)
+	providerGiven.
+		On("NewClient", "bad-id", "bad-secret").
+		Return((*mocks.ClientMock)(nil), time.Time{}, errors.New("invalid_client"))
+	providerGiven.
+		On("NewClient", "new-id", "new-secret").
+		Return(&mocks.ClientMock{}, time.Now().Add(time.Hour), nil)
+
+	s, err := runserver.New(runserver.Options{
+		Listener: bufconn.Listen(bufSize),
+		Logger:   logger,
+		Spotify:  spotifyGiven,
+	})
+	assert.Nil(t, err)
+
+	reloadable := runserver.Reloadable{
+		SpotifyClientId:     "client-id",
+		SpotifyClientSecret: "client-secret",
+		SpotifySettings: &myspotify.Settings{
+			DefaultSearchLimit: 20,
+		},
+	}
+
+	// settings
+	err = s.Reload(context.Background(), reloadable)
+	assert.Nil(t, err)
+
+	// invalid settings
+	reloadable.SpotifySettings = &myspotify.Settings{}
+	err = s.Reload(context.Background(), reloadable)
+	assert.NotNil(t, err)
+
+	// rejected credentials
+	reloadable.SpotifySettings = nil
+	reloadable.SpotifyClientId = "bad-id"
+	reloadable.SpotifyClientSecret = "bad-secret"
+	err = s.Reload(context.Background(), reloadable)
+	assert.NotNil(t, err)
+
+	// rotated credentials
+	reloadable.SpotifyClientId = "new-id"
+	reloadable.SpotifyClientSecret = "new-secret"
+	err = s.Reload(context.Background(), reloadable)
+	assert.Nil(t, err)
+	providerGiven.AssertCalled(t, "NewClient", "new-id", "new-secret")
+}
+
+func TestRun_multiplex(t *testing.T) {
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	spotifyGiven, _ := newSpotify(logger)
+
+	lis := startServer(t, runserver.Options{
+		Logger:    logger,
+		Spotify:   spotifyGiven,
+		Multiplex: true,
+	})
+
+	// native gRPC
+	results, err := pb.NewMusicResearcherClient(dial(t, lis)).Search(context.Background(),
+		&pb.Parameters{Query: "chilly gonzales crying", Limit: 3})
+	assert.Nil(t, err)
+	assert.Len(t, results.Tracks, 1)
+
+	// REST gateway, on the same listener
+	resp, err := newHTTPClient(lis).Get("http://bufnet/v1/search?q=chilly+gonzales+crying")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRun_multiplexAdmin(t *testing.T) {
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	spotifyGiven, _ := newSpotify(logger)
+
+	// the admin routes are not served without API keys
+	_, err := runserver.New(runserver.Options{
+		Listener:       bufconn.Listen(bufSize),
+		Logger:         logger,
+		Spotify:        spotifyGiven,
+		Multiplex:      true,
+		MultiplexAdmin: true,
+	})
+	assert.NotNil(t, err)
+
+	storeGiven, err := auth.NewStore([]auth.Key{
+		{ID: "search-1", Key: "search-key", Scopes: []string{auth.ScopeSearch}},
+		{ID: "admin-1", Key: "admin-key", Scopes: []string{auth.ScopeAdmin}},
+	})
+	assert.Nil(t, err)
+
+	lis := startServer(t, runserver.Options{
+		Logger:         logger,
+		Spotify:        spotifyGiven,
+		APIKeys:        storeGiven,
+		Multiplex:      true,
+		MultiplexAdmin: true,
+	})
+
+	client := newHTTPClient(lis)
+	flush := func(apiKey string) int {
+		req, err := http.NewRequest(http.MethodPost, "http://bufnet/caches/flush", nil)
+		assert.Nil(t, err)
+		if apiKey != "" {
+			req.Header.Set(auth.APIKeyMetadataKey, apiKey)
+		}
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, flush(""))
+	assert.Equal(t, http.StatusForbidden, flush("search-key"))
+	assert.Equal(t, http.StatusOK, flush("admin-key"))
+
+	// the GraphQL queries are granted by the search scope
+	req, err := http.NewRequest(http.MethodPost, "http://bufnet/graphql",
+		strings.NewReader(`{"query": "{ __typename }"}`))
+	assert.Nil(t, err)
+	req.Header.Set(auth.APIKeyMetadataKey, "search-key")
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
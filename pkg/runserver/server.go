@@ -0,0 +1,459 @@
+package runserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/planetfall/musicresearcher/internal/admin"
+	"github.com/planetfall/musicresearcher/internal/auth"
+	"github.com/planetfall/musicresearcher/internal/certs"
+	"github.com/planetfall/musicresearcher/internal/deadline"
+	"github.com/planetfall/musicresearcher/internal/gateway"
+	"github.com/planetfall/musicresearcher/internal/graph"
+	"github.com/planetfall/musicresearcher/internal/logging"
+	"github.com/planetfall/musicresearcher/internal/metrics"
+	"github.com/planetfall/musicresearcher/internal/mux"
+	"github.com/planetfall/musicresearcher/internal/ratelimit"
+	"github.com/planetfall/musicresearcher/internal/service"
+	myspotify "github.com/planetfall/musicresearcher/internal/spotify"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	httpShutdownTimeout = 5 * time.Second
+
+	defaultTLSReloadInterval = 30 * time.Second
+
+	// the REST gateway routes, when multiplexed
+	gatewayPathPrefix = "/v1/"
+)
+
+// Options configures the server, independently of the flags
+// and of the environment, so that it can be embedded
+type Options struct {
+	// Listener is the listener of the gRPC server,
+	// opened on Port when nil (e.g. a bufconn listener in tests)
+	Listener net.Listener
+	Port     string
+
+	// AdminPort and RestPort are the ports of the admin server
+	// and of the REST/JSON gateway, disabled when empty
+	AdminPort string
+	RestPort  string
+
+	// Logger is the base logger, slog.Default when nil
+	Logger *slog.Logger
+
+	// Reporter reports the errors to the cloud error reporting,
+	// the errors are only logged when nil
+	Reporter *server.Server
+
+	// Reloadable holds the options that can be changed while
+	// the server runs, with Reload
+	Reloadable
+
+	// Spotify replaces the spotify client created from the credentials
+	Spotify myspotify.MySpotify
+
+	// APIKeys authenticates the callers, the authentication
+	// is disabled when nil
+	APIKeys *auth.Store
+
+	UpstreamConcurrency int
+
+	// TLS configures the certificates, the server is served
+	// in plaintext when no certificate is provided
+	TLS               certs.Options
+	TLSReloadInterval time.Duration
+
+	// DrainTimeout bounds the drain of the in-flight requests on stop,
+	// after which they are aborted, unbounded when not positive
+	DrainTimeout time.Duration
+
+	// Multiplex serves the gRPC-Web and the REST gateway on the
+	// listener of the gRPC server, along with the admin server
+	// when MultiplexAdmin is set, for the API keys granting the
+	// admin scope only (APIKeys is then required)
+	Multiplex      bool
+	MultiplexAdmin bool
+
+	// CORSAllowedOrigins are the origins of the browsers
+	// allowed to call the multiplexed server
+	CORSAllowedOrigins []string
+
+	// GraphQL bounds the GraphQL queries, served by the REST gateway,
+	// its Spotify being set by the server
+	GraphQL graph.Options
+
+	// Settings returns the effective configuration,
+	// served by the admin server
+	Settings func() map[string]interface{}
+
+	// OnReady is called once the server is listening
+	OnReady func(addr net.Addr)
+}
+
+// Reloadable holds the options that can be changed while the server runs
+type Reloadable struct {
+	SpotifyClientId     string
+	SpotifyClientSecret string
+
+	// SpotifySettings are the runtime settings of the spotify client,
+	// myspotify.DefaultSettings when nil
+	SpotifySettings *myspotify.Settings
+
+	RateLimit ratelimit.Options
+	Deadlines deadline.Options
+}
+
+func (r Reloadable) getSpotifySettings() myspotify.Settings {
+	if r.SpotifySettings == nil {
+		return myspotify.DefaultSettings
+	}
+
+	return *r.SpotifySettings
+}
+
+// Validate checks the reloadable options
+func (r Reloadable) Validate() error {
+	if r.SpotifyClientId == "" || r.SpotifyClientSecret == "" {
+		return fmt.Errorf("the spotify credentials are required")
+	}
+
+	if err := r.getSpotifySettings().Validate(); err != nil {
+		return fmt.Errorf("invalid spotify settings: %v", err)
+	}
+
+	if r.RateLimit.Rate < 0 || r.RateLimit.Burst < 0 {
+		return fmt.Errorf("the rate limit and its burst must not be negative")
+	}
+
+	return nil
+}
+
+func (opt Options) getLogger() *slog.Logger {
+	if opt.Logger == nil {
+		return slog.Default()
+	}
+
+	return opt.Logger
+}
+
+func (opt Options) getSettings() func() map[string]interface{} {
+	if opt.Settings == nil {
+		return func() map[string]interface{} { return map[string]interface{}{} }
+	}
+
+	return opt.Settings
+}
+
+func (opt Options) getTLSReloadInterval() time.Duration {
+	if opt.TLSReloadInterval <= 0 {
+		return defaultTLSReloadInterval
+	}
+
+	return opt.TLSReloadInterval
+}
+
+// Server is the MusicResearcher server along with its side-servers
+type Server struct {
+	opt    Options
+	logger *slog.Logger
+
+	svc       *service.Service
+	transport *mux.Server
+	reloader  *certs.Reloader
+	tlsConfig *tls.Config
+	limiter   *ratelimit.Limiter
+	deadlines *deadline.Deadlines
+
+	// serializes the reloads
+	reloadMu sync.Mutex
+
+	lis      net.Listener
+	adminLis net.Listener
+	restLis  net.Listener
+
+	adminHandler http.Handler
+	restHandler  http.Handler
+}
+
+// opens a TCP listener on the port, nil when no port is provided
+func listen(port string) (net.Listener, error) {
+	if port == "" {
+		return nil, nil
+	}
+
+	lis, err := net.Listen("tcp4", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return nil, fmt.Errorf("net.Listen: %v", err)
+	}
+
+	return lis, nil
+}
+
+// New creates the server and opens its listeners
+func New(opt Options) (_ *Server, err error) {
+	logger := opt.getLogger()
+	s := &Server{
+		opt:    opt,
+		logger: logger.With("component", "runserver"),
+	}
+
+	// the listeners opened so far are closed on failure
+	defer func() {
+		if err != nil {
+			s.closeListeners()
+		}
+	}()
+
+	// tls
+	if opt.TLS.Enabled() {
+		s.reloader, err = certs.NewReloader(opt.TLS, logger.With("component", "certs"))
+		if err != nil {
+			return nil, fmt.Errorf("certs.NewReloader: %v", err)
+		}
+		s.tlsConfig = s.reloader.TLSConfig()
+	} else {
+		s.logger.Warn("no TLS certificate configured, serving plaintext")
+	}
+
+	// interceptors
+	m := metrics.New()
+	s.deadlines = deadline.New(opt.Deadlines)
+	interceptors := []grpc.UnaryServerInterceptor{
+		s.deadlines.UnaryServerInterceptor(),
+		logging.UnaryServerInterceptor(logger.With("component", "grpc")),
+		certs.UnaryServerInterceptor(),
+		m.UnaryServerInterceptor(),
+	}
+	if opt.APIKeys != nil {
+		// the graph package imports auth, through the spotify client
+		auth.SetMethodScope(graph.QueryMethod, auth.ScopeSearch)
+		interceptors = append(interceptors, auth.UnaryServerInterceptor(
+			opt.APIKeys, m, logger.With("component", "auth")))
+	} else {
+		s.logger.Warn("no API key configured, the authentication is disabled")
+	}
+	// the rate limiter identifies the callers by key, hence runs after
+	// the authentication, giving back the quota of the requests it rejects
+	s.limiter = ratelimit.NewLimiter(opt.RateLimit)
+	interceptors = append(interceptors, s.limiter.UnaryServerInterceptor(
+		logger.With("component", "ratelimit")))
+
+	// service
+	serverOpts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(interceptors...),
+	}
+	// the multiplexing server terminates the TLS itself
+	if s.tlsConfig != nil && !opt.Multiplex {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+	grpcSrv := grpc.NewServer(serverOpts...)
+	s.svc = service.NewService(service.Options{
+		GRPCServer:          grpcSrv,
+		Reporter:            opt.Reporter,
+		Logger:              logger,
+		Metrics:             m,
+		Upstream:            ratelimit.NewFairSemaphore(opt.UpstreamConcurrency),
+		Spotify:             opt.Spotify,
+		SpotifyClientId:     opt.SpotifyClientId,
+		SpotifyClientSecret: opt.SpotifyClientSecret,
+		SpotifySettings:     opt.SpotifySettings,
+	})
+
+	// side-servers
+	s.adminHandler = admin.NewHandler(admin.Options{
+		Spotify:  s.svc.Spotify(),
+		Settings: opt.getSettings(),
+		Metrics:  m,
+		Logger:   logger.With("component", "admin"),
+	})
+	graphOpt := opt.GraphQL
+	graphOpt.Spotify = s.svc.Spotify()
+	schema, err := graph.NewSchema(graphOpt)
+	if err != nil {
+		return nil, fmt.Errorf("graph.NewSchema: %v", err)
+	}
+	s.restHandler = gateway.NewHandler(gateway.Options{
+		Server:       s.svc,
+		Interceptors: interceptors,
+		Logger:       logger.With("component", "gateway"),
+		Graph:        schema,
+	})
+
+	// multiplexing
+	if opt.Multiplex {
+		routes := http.NewServeMux()
+		routes.Handle(gatewayPathPrefix, s.restHandler)
+		routes.Handle(gateway.GraphQLPath, s.restHandler)
+		if opt.MultiplexAdmin {
+			// the admin routes are public on this port, hence restricted
+			// to the keys granting the admin scope
+			if opt.APIKeys == nil {
+				return nil, fmt.Errorf("the multiplexed admin routes require API keys")
+			}
+			routes.Handle("/", auth.HTTPHandler(opt.APIKeys, auth.ScopeAdmin,
+				s.adminHandler, logger.With("component", "admin")))
+		}
+
+		s.transport, err = mux.NewServer(mux.Options{
+			GRPC: grpcSrv,
+			HTTP: routes,
+			CORS: mux.CORSOptions{
+				AllowedOrigins: opt.CORSAllowedOrigins,
+				ExposedHeaders: append([]string{logging.RequestIDMetadataKey, "retry-after"},
+					service.ResponseMetadataKeys...),
+			},
+			TLSConfig: s.tlsConfig,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("mux.NewServer: %v", err)
+		}
+	}
+
+	// listeners
+	s.lis = opt.Listener
+	if s.lis == nil {
+		if s.lis, err = listen(opt.Port); err != nil {
+			return nil, err
+		}
+		if s.lis == nil {
+			return nil, fmt.Errorf("no listener nor port provided")
+		}
+	}
+	if s.adminLis, err = listen(opt.AdminPort); err != nil {
+		return nil, err
+	}
+	if s.restLis, err = listen(opt.RestPort); err != nil {
+		return nil, err
+	}
+	if s.restLis != nil && s.tlsConfig != nil {
+		s.restLis = tls.NewListener(s.restLis, s.tlsConfig)
+	}
+
+	return s, nil
+}
+
+func (s *Server) closeListeners() {
+	for _, lis := range []net.Listener{s.lis, s.adminLis, s.restLis} {
+		if lis != nil {
+			_ = lis.Close()
+		}
+	}
+}
+
+// Addr returns the address of the gRPC listener
+func (s *Server) Addr() net.Addr {
+	return s.lis.Addr()
+}
+
+// Run serves the requests until the context is done, then drains
+// the in-flight requests and stops. It returns when the server is stopped.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if s.reloader != nil {
+		go s.reloader.Watch(ctx, s.opt.getTLSReloadInterval())
+	}
+
+	adminSrv := s.startHTTPServer("admin", s.adminLis, s.adminHandler)
+	defer s.stopHTTPServer(adminSrv)
+
+	restSrv := s.startHTTPServer("rest", s.restLis, s.restHandler)
+	defer s.stopHTTPServer(restSrv)
+
+	s.logger.Info("starting listening", "addr", s.lis.Addr().String())
+	var transport service.Transport
+	if s.transport != nil {
+		transport = s.transport
+	}
+
+	err := s.svc.ServeTransport(ctx, s.lis, transport, s.opt.DrainTimeout, func() {
+		if s.opt.OnReady != nil {
+			s.opt.OnReady(s.lis.Addr())
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("svc.ServeTransport: %v", err)
+	}
+
+	s.logger.Info("service stopped")
+	return nil
+}
+
+// Reload applies the reloadable options to the running server. The new
+// options are rejected when invalid, or when no spotify token can be
+// obtained with the new credentials, the previous options being kept.
+func (s *Server) Reload(ctx context.Context, r Reloadable) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	// the credential rotation is the only change that can fail,
+	// so it is applied first
+	if err := s.svc.Spotify().UpdateCredentials(ctx,
+		r.SpotifyClientId, r.SpotifyClientSecret); err != nil {
+		return fmt.Errorf("UpdateCredentials: %v", err)
+	}
+
+	if err := s.svc.Spotify().UpdateSettings(r.getSpotifySettings()); err != nil {
+		return fmt.Errorf("UpdateSettings: %v", err)
+	}
+	s.limiter.SetOptions(r.RateLimit)
+	s.deadlines.Set(r.Deadlines)
+
+	s.logger.InfoContext(ctx, "options reloaded")
+	return nil
+}
+
+// starts an HTTP side-server on the listener, when provided
+func (s *Server) startHTTPServer(name string, lis net.Listener,
+	handler http.Handler) *http.Server {
+
+	if lis == nil {
+		return nil
+	}
+
+	httpSrv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	s.logger.Info("starting http server", "server", name, "addr", lis.Addr().String())
+	go func() {
+		if err := httpSrv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("http server stopped", "server", name, "error", err)
+		}
+	}()
+
+	return httpSrv
+}
+
+func (s *Server) stopHTTPServer(httpSrv *http.Server) {
+	if httpSrv == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+
+	if err := httpSrv.Shutdown(ctx); err != nil {
+		s.logger.Error("httpSrv.Shutdown failed", "error", err)
+	}
+}